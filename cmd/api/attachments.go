@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for Event Attachments
+*/
+
+// maxMultipartOverhead is the space allowed in an
+// upload request body for the multipart boundaries and
+// headers, and any other form fields, on top of the
+// largest file that can be attached.
+const maxMultipartOverhead = 1_048_576
+
+// errFileTooLarge is returned by an uploadReader when
+// a file is larger than the attachment size limit.
+var errFileTooLarge = errors.New("file too large")
+
+// uploadReader reads the content of an uploaded file,
+// returning errFileTooLarge once more than remaining
+// bytes are read. The first error it returns is kept,
+// so a failed upload can be told apart from a failure
+// to store it.
+type uploadReader struct {
+	r         io.Reader
+	remaining int64
+	err       error
+}
+
+// Read reads from the uploaded file.
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.remaining -= int64(n)
+	if u.remaining < 0 {
+		err = errFileTooLarge
+	}
+	if err != nil && err != io.EOF && u.err == nil {
+		u.err = err
+	}
+	return n, err
+}
+
+// listAttachmentsHandler returns the attachments of an
+// event.
+// A METHOD on the APPLICATION struct.
+func (app *application) listAttachmentsHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	attachments, err := app.models.Attachments.GetAllForEvent(event.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attachments": attachments}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createAttachmentHandler attaches a file to an event.
+// The file is uploaded as the "file" field of a
+// multipart/form-data body, and streamed to storage
+// rather than held in memory. Its MIME type is sniffed
+// from its content, rather than trusted from the
+// client.
+// A METHOD on the APPLICATION struct.
+func (app *application) createAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" {
+		app.unsupportedMediaTypeResponse(w, r, "multipart/form-data")
+		return
+	}
+
+	// Limit the size of the request body to the largest
+	// file, plus room for the multipart encoding. The
+	// file itself is limited by an uploadReader below.
+	maxSize := app.config.attachments.maxSize
+	r.Body = http.MaxBytesReader(w, r.Body, maxSize+maxMultipartOverhead)
+
+	part, err := readFilePart(r, "file")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.contentTooLargeResponse(w, r, maxSize)
+			return
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	defer part.Close()
+
+	// Read the first 512 bytes of the file, which is
+	// all http.DetectContentType() considers.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		app.uploadErrorResponse(w, r, err)
+		return
+	}
+	head = head[:n]
+
+	attachment := &data.Attachment{
+		EventID:     event.ID,
+		UserID:      app.contextGetUser(r).ID,
+		Filename:    strings.TrimSpace(part.FileName()),
+		ContentType: http.DetectContentType(head),
+		Size:        int64(n),
+	}
+
+	v := validator.New()
+	if data.ValidateAttachment(v, attachment); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Store the file, starting with the bytes already
+	// read, and insert the attachment using it. Until
+	// the attachment is inserted, a blob with the same
+	// content may still be recorded as orphaned, so hold
+	// the read lock on blobs to stop removeOrphanedBlobs()
+	// removing it from storage in the meantime.
+	content := &uploadReader{r: io.MultiReader(bytes.NewReader(head), part), remaining: maxSize}
+	app.blobs.RLock()
+	blob, err := app.storage.Put(content)
+	if err != nil {
+		app.blobs.RUnlock()
+		if content.err != nil {
+			app.uploadErrorResponse(w, r, content.err)
+			return
+		}
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	attachment.Size = blob.Size
+	attachment.Checksum = blob.Checksum
+
+	err = app.models.Attachments.Insert(attachment)
+	app.blobs.RUnlock()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/events/%d/attachments/%d", event.ID, attachment.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"attachment": attachment}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readFilePart returns the part of a multipart/form-data
+// request body holding the form field with the name,
+// skipping any other fields before it.
+func readFilePart(r *http.Request, name string) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("body must contain a %s field", name)
+			}
+			return nil, err
+		}
+		if part.FormName() == name {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// uploadErrorResponse sends the response for an error
+// reading an uploaded file: 413 Content Too Large if it
+// is larger than the attachment size limit, or else
+// 400 Bad Request.
+// A METHOD on the APPLICATION struct.
+func (app *application) uploadErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesError *http.MaxBytesError
+	if errors.Is(err, errFileTooLarge) || errors.As(err, &maxBytesError) {
+		app.contentTooLargeResponse(w, r, app.config.attachments.maxSize)
+		return
+	}
+	app.badRequestResponse(w, r, fmt.Errorf("body contains a badly-formed file: %v", err))
+}
+
+// showAttachmentHandler sends the content of an
+// attachment, as a download with its file name. Range
+// and conditional requests are supported, with the
+// checksum as the ETag.
+// A METHOD on the APPLICATION struct.
+func (app *application) showAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	attachment, ok := app.readAttachment(w, r, event)
+	if !ok {
+		return
+	}
+
+	file, err := app.storage.Open(attachment.Checksum)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer file.Close()
+
+	// The content type was sniffed when the file was
+	// uploaded, so browsers must not sniff it again.
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", `"`+attachment.Checksum+`"`)
+
+	http.ServeContent(w, r, "", attachment.CreatedAt, file)
+}
+
+// deleteAttachmentHandler removes an attachment from
+// an event. Its content is removed from storage in the
+// background, unless another attachment shares it.
+// A METHOD on the APPLICATION struct.
+func (app *application) deleteAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	attachment, ok := app.readAttachment(w, r, event)
+	if !ok {
+		return
+	}
+
+	err := app.models.Attachments.Delete(attachment.ID, event.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.background(app.removeOrphanedBlobs)
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "attachment successfully removed"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readAttachment fetches the attachment of the event
+// with the ID in the attachment_id URL parameter. If it
+// is not found, a 404 Not Found response is sent, and
+// false is returned.
+// A METHOD on the APPLICATION struct.
+func (app *application) readAttachment(
+	w http.ResponseWriter,
+	r *http.Request,
+	event *data.Event,
+) (*data.Attachment, bool) {
+	id, err := app.readNamedIDParam(r, "attachment_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	attachment, err := app.models.Attachments.Get(id, event.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return attachment, true
+}
+
+// removeOrphanedBlobs removes the content of
+// attachments from storage once no attachment uses it,
+// because the attachments were removed, or purged with
+// their events. Each blob is claimed and removed under
+// the write lock on blobs, so it isn't removed while an
+// upload with the same content is stored but not yet
+// attached. Errors are logged, and content which can't
+// be removed is left in storage.
+// A METHOD on the APPLICATION struct.
+func (app *application) removeOrphanedBlobs() {
+	checksums, err := app.models.Attachments.Orphans()
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	for _, checksum := range checksums {
+		err = app.removeOrphanedBlob(checksum)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"checksum": checksum})
+		}
+	}
+}
+
+// removeOrphanedBlob claims an orphaned blob and
+// removes it from storage, unless the same content has
+// been attached again.
+// A METHOD on the APPLICATION struct.
+func (app *application) removeOrphanedBlob(checksum string) error {
+	app.blobs.Lock()
+	defer app.blobs.Unlock()
+
+	claimed, err := app.models.Attachments.ClaimOrphan(checksum)
+	if err != nil || !claimed {
+		return err
+	}
+
+	return app.storage.Delete(checksum)
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for Event Attendees
+*/
+
+// rsvpGracePeriod is how long an RSVP token stays
+// valid after its event ends, and the shortest time
+// any RSVP token is valid for.
+const rsvpGracePeriod = 7 * 24 * time.Hour
+
+// templateFS holds the templates of the pages the API
+// serves, such as the RSVP confirmation page.
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+// rsvpLabels maps the replies to an invitation to the
+// labels shown to attendees, which match the links in
+// the invitation email.
+var rsvpLabels = map[string]string{
+	data.StatusAccepted:  "Accept",
+	data.StatusDeclined:  "Decline",
+	data.StatusTentative: "Maybe",
+}
+
+// listAttendeesHandler returns the attendees of an
+// event.
+// A METHOD on the APPLICATION struct.
+func (app *application) listAttendeesHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	attendees, err := app.models.Attendees.GetAllForEvent(event.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attendees": attendees}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createAttendeeHandler adds an attendee to an event,
+// by email address, and emails them an invitation with
+// links to accept or decline it. Email addresses of
+// registered users are linked to the user.
+// A METHOD on the APPLICATION struct.
+func (app *application) createAttendeeHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	// Declare an anonymous struct to hold the info
+	// expected in the HTTP body.
+	var input struct {
+		Email string `json:"email"`
+		Name  string `json:"name,omitempty"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	attendee := &data.Attendee{
+		EventID: event.ID,
+		Name:    input.Name,
+		Email:   input.Email,
+		Status:  data.StatusNeedsAction,
+	}
+
+	v := validator.New()
+	if data.ValidateAttendee(v, attendee); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Link the attendee to the registered user with the
+	// email address, if there is one.
+	user, err := app.models.Users.GetByEmail(attendee.Email)
+	switch {
+	case err == nil:
+		attendee.UserID = user.ID
+		if attendee.Name == "" {
+			attendee.Name = user.Name
+		}
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Attendees.Insert(attendee)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateAttendee):
+			v.AddError("email", "is already an attendee of the event")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Create the RSVP token for the invitation links.
+	token, err := app.models.Tokens.NewForAttendee(attendee.ID, rsvpTokenTTL(event))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Email the invitation in a background goroutine, so
+	// the response is not held up by the SMTP server.
+	inviter := app.contextGetUser(r)
+	acceptURL := app.rsvpURL(token.Plaintext, data.StatusAccepted)
+	declineURL := app.rsvpURL(token.Plaintext, data.StatusDeclined)
+	maybeURL := app.rsvpURL(token.Plaintext, data.StatusTentative)
+	app.background(func() {
+		data := map[string]interface{}{
+			"eventTitle":  event.Title,
+			"eventStart":  eventStartText(event),
+			"inviterName": inviter.Name,
+			"name":        attendee.Name,
+			"acceptURL":   acceptURL,
+			"declineURL":  declineURL,
+			"maybeURL":    maybeURL,
+		}
+
+		err := app.mailer.Send(attendee.Email, "event_invitation.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"attendee": attendee}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateAttendeeHandler updates the participation
+// status of an attendee, such as when they reply other
+// than through their invitation.
+// A METHOD on the APPLICATION struct.
+func (app *application) updateAttendeeHandler(w http.ResponseWriter, r *http.Request) {
+	attendee, ok := app.readAttendee(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Status *string `json:"status"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Status != nil {
+		attendee.Status = *input.Status
+	}
+
+	v := validator.New()
+	if data.ValidateAttendee(v, attendee); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Attendees.UpdateStatus(attendee)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attendee": attendee}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAttendeeHandler removes an attendee from an
+// event. Their invitation links stop working.
+// A METHOD on the APPLICATION struct.
+func (app *application) deleteAttendeeHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	id, err := app.readNamedIDParam(r, "attendee_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Attendees.Delete(id, event.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "attendee successfully removed"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showRSVPHandler shows the page an attendee reaches
+// from the links in the invitation email, which asks
+// them to confirm their reply. It takes the RSVP token
+// and the reply from the query string rather than
+// requiring authentication. The reply is only recorded
+// when the page's form is submitted to rsvpHandler, so
+// mail scanners and prefetchers which follow the links
+// don't change it.
+// A METHOD on the APPLICATION struct.
+func (app *application) showRSVPHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	token := app.readString(qs, "token", "")
+	status := app.readString(qs, "status", "")
+
+	attendee, ok := app.readRSVP(w, r, token, status)
+	if !ok {
+		return
+	}
+
+	app.writeRSVPPage(w, r, http.StatusOK, "confirm", attendee, token, status)
+}
+
+// rsvpHandler records an attendee's reply to an
+// invitation. The RSVP token and the reply are taken
+// from the request body, which is the form on the page
+// shown by showRSVPHandler, or JSON. A form is answered
+// with a page, and JSON with the attendee. The reply
+// can be changed while the token is valid.
+// A METHOD on the APPLICATION struct.
+func (app *application) rsvpHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token  string `json:"token"`
+		Status string `json:"status"`
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	form := mediaType == "application/x-www-form-urlencoded"
+	if form {
+		r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+		err := r.ParseForm()
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		input.Token = r.PostForm.Get("token")
+		input.Status = r.PostForm.Get("status")
+	} else {
+		err := app.readJSON(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+
+	attendee, ok := app.readRSVP(w, r, input.Token, input.Status)
+	if !ok {
+		return
+	}
+
+	attendee.Status = input.Status
+
+	err := app.models.Attendees.UpdateStatus(attendee)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if form {
+		app.writeRSVPPage(w, r, http.StatusOK, "recorded", attendee, "", input.Status)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"attendee": attendee}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readRSVP checks an RSVP token and reply, and fetches
+// the attendee the token was sent to. If either is not
+// valid, an error response is sent and false is
+// returned.
+// A METHOD on the APPLICATION struct.
+func (app *application) readRSVP(
+	w http.ResponseWriter,
+	r *http.Request,
+	token string,
+	status string,
+) (*data.Attendee, bool) {
+	v := validator.New()
+	data.ValidateTokenPlaintext(v, token)
+	_, ok := rsvpLabels[status]
+	v.Check(ok, "status", "must be one of accepted, declined or tentative")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, false
+	}
+
+	attendee, err := app.models.Attendees.GetForToken(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired RSVP token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return attendee, true
+}
+
+// writeRSVPPage renders a page of the rsvp.tmpl
+// template for an attendee. The page holds the RSVP
+// token, so it is not cached, and its URL is not sent
+// as a referrer.
+// A METHOD on the APPLICATION struct.
+func (app *application) writeRSVPPage(
+	w http.ResponseWriter,
+	r *http.Request,
+	status int,
+	page string,
+	attendee *data.Attendee,
+	token string,
+	reply string,
+) {
+	// The event is only needed for its title, so the
+	// page is still shown if it can't be found.
+	eventTitle := ""
+	event, err := app.models.Events.Get(attendee.EventID, 0)
+	if err == nil {
+		eventTitle = event.Title
+	} else if !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tmpl, err := template.ParseFS(templateFS, "templates/rsvp.tmpl")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	buf := new(bytes.Buffer)
+	err = tmpl.ExecuteTemplate(buf, page, map[string]interface{}{
+		"name":       attendee.Name,
+		"eventTitle": eventTitle,
+		"token":      token,
+		"status":     reply,
+		"label":      rsvpLabels[reply],
+	})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// readAttendee reads the attendee with the ID in the
+// URL, of the event loaded by requireEventRole(). If
+// the attendee can't be read, an error response is
+// sent and false is returned.
+// A METHOD on the APPLICATION struct.
+func (app *application) readAttendee(w http.ResponseWriter, r *http.Request) (*data.Attendee, bool) {
+	event := app.contextGetEvent(r)
+
+	id, err := app.readNamedIDParam(r, "attendee_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	attendee, err := app.models.Attendees.Get(id, event.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return attendee, true
+}
+
+// addRSVPSummaries sets the RSVP summary of each event
+// which has attendees. Expanded occurrences share the
+// summary of their recurring event.
+// A METHOD on the APPLICATION struct.
+func (app *application) addRSVPSummaries(events ...*data.Event) error {
+	ids := make([]int64, 0, len(events))
+	for _, event := range events {
+		ids = append(ids, rsvpEventID(event))
+	}
+
+	summaries, err := app.models.Attendees.Summaries(ids...)
+	if err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		event.RSVP = summaries[rsvpEventID(event)]
+	}
+	return nil
+}
+
+// rsvpEventID returns the ID of the event attendees of
+// an event or occurrence are stored against.
+func rsvpEventID(event *data.Event) int64 {
+	if event.ParentID != 0 {
+		return event.ParentID
+	}
+	return event.ID
+}
+
+// rsvpURL returns the link an attendee follows to
+// reply to an invitation with a status.
+// A METHOD on the APPLICATION struct.
+func (app *application) rsvpURL(token, status string) string {
+	qs := url.Values{"token": {token}, "status": {status}}
+	return fmt.Sprintf("%s/v1/rsvp?%s", app.config.baseURL, qs.Encode())
+}
+
+// rsvpTokenTTL returns how long the RSVP token of an
+// event's attendee is valid for. This is until the
+// grace period after the event ends, or for a year for
+// recurring events, since attendees are invited to the
+// whole series.
+func rsvpTokenTTL(event *data.Event) time.Duration {
+	if event.RRule != "" {
+		return 365 * 24 * time.Hour
+	}
+
+	end := event.End
+	if end.Before(event.Start) {
+		end = event.Start
+	}
+
+	ttl := time.Until(end) + rsvpGracePeriod
+	if ttl < rsvpGracePeriod {
+		return rsvpGracePeriod
+	}
+	return ttl
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for Bulk Event Operations
+*/
+
+// Define the limits on bulk operations:
+//  1. maxBulkOperations: operations in one request
+//  2. maxBulkBytes: size of the request body, 10MB
+const (
+	maxBulkOperations = 1000
+	maxBulkBytes      = 10 * 1_048_576
+)
+
+// Define the modes of a bulk request:
+//  1. bulkAtomic: apply every operation or none
+//  2. bulkBestEffort: apply the operations which
+//     succeed, and report the rest as failed
+const (
+	bulkAtomic     = "atomic"
+	bulkBestEffort = "best_effort"
+)
+
+// bulkChangeTypes maps the action of a bulk operation
+// to the type of change sent to webhooks and event
+// streams.
+var bulkChangeTypes = map[string]string{
+	data.BulkCreate: data.EventCreated,
+	data.BulkUpdate: data.EventUpdated,
+	data.BulkDelete: data.EventDeleted,
+}
+
+// bulkOperation holds one operation of a bulk request.
+// Creates and updates take the same event fields as
+// the create and update endpoints. Updates and deletes
+// may give the version they expect the event to be
+// at, to detect edit conflicts.
+type bulkOperation struct {
+	Op      string          `json:"op"`
+	ID      int64           `json:"id,omitempty"`
+	Version int32           `json:"version,omitempty"`
+	Event   json.RawMessage `json:"event,omitempty"`
+}
+
+// bulkResult reports the outcome of one operation of
+// a bulk request. Status is one of "created",
+// "updated", "deleted", "failed", or "skipped" for
+// operations not applied because another operation
+// of an atomic request failed.
+type bulkResult struct {
+	Index   int               `json:"index"`
+	Op      string            `json:"op"`
+	ID      int64             `json:"id,omitempty"`
+	Version int32             `json:"version,omitempty"`
+	Status  string            `json:"status"`
+	Error   string            `json:"error,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// bulkEventsHandler applies a batch of create, update
+// and delete operations on events in a single
+// transaction. In the default atomic mode, nothing is
+// applied if any operation fails, and a 422
+// Unprocessable Entity response is sent. In the
+// best_effort mode, the operations which succeed are
+// applied. The response reports the outcome of every
+// operation.
+// A METHOD on the APPLICATION struct.
+func (app *application) bulkEventsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Mode       string          `json:"mode"`
+		Operations []bulkOperation `json:"operations"`
+	}
+
+	err := app.readJSONLimit(w, r, &input, maxBulkBytes)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Mode == "" {
+		input.Mode = bulkAtomic
+	}
+
+	v := validator.New()
+	v.Check(validator.In(input.Mode, []string{bulkAtomic, bulkBestEffort}), "mode", "must be atomic or best_effort")
+	v.Check(len(input.Operations) > 0, "operations", "must contain at least one operation")
+	v.Check(len(input.Operations) <= maxBulkOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBulkOperations))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Prepare each operation: read and validate its
+	// event, and check the user may edit the events it
+	// changes. Operations which can't be prepared fail
+	// without being applied.
+	results := make([]*bulkResult, len(input.Operations))
+	var operations []*data.BulkOperation
+	var positions []int
+	for i, op := range input.Operations {
+		results[i] = &bulkResult{Index: i, Op: op.Op, ID: op.ID}
+
+		operation, errs, err := app.prepareBulkOperation(r, op)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if errs != nil {
+			results[i].Status = "failed"
+			results[i].Errors = errs
+			continue
+		}
+
+		operations = append(operations, operation)
+		positions = append(positions, i)
+	}
+
+	// In the atomic mode, nothing is applied if any
+	// operation could not be prepared.
+	atomic := input.Mode == bulkAtomic
+	failed := len(operations) < len(results)
+	if !(atomic && failed) && len(operations) > 0 {
+		err = app.models.Events.Bulk(operations, atomic)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	for i, operation := range operations {
+		result := results[positions[i]]
+		switch {
+		case operation.Err != nil:
+			failed = true
+			result.Status = "failed"
+			switch {
+			case errors.Is(operation.Err, data.ErrEditConflict):
+				result.Error = "unable to update the record due to an edit conflict, please try again"
+			case errors.Is(operation.Err, data.ErrRecordNotFound):
+				result.Error = "the requested resource could not be found"
+			default:
+				app.logError(r, operation.Err)
+				result.Error = "the operation could not be applied"
+			}
+		default:
+			result.ID = operation.Event.ID
+			result.Status = operation.Action + "d"
+			if operation.Action != data.BulkDelete {
+				result.Version = operation.Event.Version
+			}
+		}
+	}
+
+	// Send the changes which were applied to webhooks
+	// and event streams. In the atomic mode, nothing was
+	// applied if any operation failed.
+	if !(atomic && failed) {
+		for _, operation := range operations {
+			if operation.Err == nil {
+				app.publishEventChange(bulkChangeTypes[operation.Action], operation.Event)
+			}
+		}
+	}
+
+	// In the atomic mode, report the operations which
+	// were rolled back, or never tried, as skipped.
+	status := http.StatusOK
+	if atomic && failed {
+		status = http.StatusUnprocessableEntity
+		for _, result := range results {
+			if result.Status != "failed" {
+				result.Status = "skipped"
+				result.Version = 0
+				if result.Op == data.BulkCreate {
+					result.ID = 0
+				}
+			}
+		}
+	}
+
+	// Count the outcomes.
+	counts := map[string]int{"created": 0, "updated": 0, "deleted": 0, "failed": 0, "skipped": 0}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+
+	err = app.writeJSON(
+		w,
+		status,
+		envelope{"bulk": envelope{
+			"mode":    input.Mode,
+			"created": counts["created"],
+			"updated": counts["updated"],
+			"deleted": counts["deleted"],
+			"failed":  counts["failed"],
+			"skipped": counts["skipped"],
+			"results": results,
+		}},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// prepareBulkOperation turns an operation of a bulk
+// request into a data.BulkOperation. If the operation
+// is invalid, or the user may not edit its event, the
+// error messages are returned instead. Events the user
+// can't see are reported as not found.
+// A METHOD on the APPLICATION struct.
+func (app *application) prepareBulkOperation(
+	r *http.Request,
+	op bulkOperation,
+) (*data.BulkOperation, map[string]string, error) {
+	v := validator.New()
+	user := app.contextGetUser(r)
+
+	var input eventUpdateInput
+	if op.Op == data.BulkCreate || op.Op == data.BulkUpdate {
+		if len(op.Event) == 0 {
+			v.AddError("event", "must be provided")
+			return nil, v.Errors, nil
+		}
+		dec := json.NewDecoder(bytes.NewReader(op.Event))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&input); err != nil {
+			v.AddError("event", "must be a valid event: "+err.Error())
+			return nil, v.Errors, nil
+		}
+	}
+
+	var event *data.Event
+	switch op.Op {
+	case data.BulkCreate:
+		// New events go in the user's default calendar,
+		// in the calendar's time zone, unless the event
+		// says otherwise.
+		var calendarID int64
+		if input.CalendarID != nil {
+			calendarID = *input.CalendarID
+			input.CalendarID = nil
+		}
+		calendar, err := app.eventCalendar(r, calendarID, v)
+		if err != nil {
+			return nil, nil, err
+		}
+		if calendar == nil {
+			return nil, v.Errors, nil
+		}
+		event = &data.Event{
+			UserID:     calendar.UserID,
+			CalendarID: calendar.ID,
+			TimeZone:   calendar.TimeZone,
+		}
+
+	case data.BulkUpdate, data.BulkDelete:
+		var err error
+		event, err = app.bulkEvent(r, op.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if event == nil {
+			v.AddError("id", "must be an event you can edit")
+			return nil, v.Errors, nil
+		}
+		if op.Version != 0 && op.Version != event.Version {
+			v.AddError("version", "unable to update the record due to an edit conflict, please try again")
+			return nil, v.Errors, nil
+		}
+
+	default:
+		v.AddError("op", "must be create, update or delete")
+		return nil, v.Errors, nil
+	}
+
+	if op.Op != data.BulkDelete {
+		err := app.applyEventUpdate(r, event, &input, v)
+		if err != nil {
+			return nil, nil, err
+		}
+		if data.ValidateEvent(v, event); !v.Valid() {
+			return nil, v.Errors, nil
+		}
+	}
+
+	event.UpdatedBy = user.ID
+	return &data.BulkOperation{Action: op.Op, Event: event}, nil, nil
+}
+
+// bulkEvent fetches the event with the ID for a bulk
+// update or delete. nil is returned if the event does
+// not exist or the user can't edit it.
+// A METHOD on the APPLICATION struct.
+func (app *application) bulkEvent(r *http.Request, id int64) (*data.Event, error) {
+	event, err := app.models.Events.Get(id, 0)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	role, err := app.resourceRole(r, event.UserID, event.CalendarID)
+	if err != nil {
+		return nil, err
+	}
+	if !data.RoleIncludes(role, data.RoleEditor) {
+		return nil, nil
+	}
+	return event, nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for Calendars
+*/
+
+// createCalendarHandler creates a calendar owned by
+// the authenticated user.
+// A METHOD on the APPLICATION struct.
+func (app *application) createCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an anonymous struct to hold the info
+	// expected in the HTTP body.
+	var input struct {
+		Name     string `json:"name"`
+		Color    string `json:"color,omitempty"`
+		TimeZone string `json:"time_zone,omitempty"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Calendars without a time zone default to UTC.
+	if input.TimeZone == "" {
+		input.TimeZone = "UTC"
+	}
+
+	calendar := &data.Calendar{
+		UserID:   app.contextGetUser(r).ID,
+		Name:     input.Name,
+		Color:    input.Color,
+		TimeZone: input.TimeZone,
+		Role:     data.RoleOwner,
+	}
+
+	// Validate the calendar, and send a response
+	// containing errors if any checks fail.
+	v := validator.New()
+	if data.ValidateCalendar(v, calendar); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Calendars.Insert(calendar)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Include a Location header for the new calendar.
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/calendars/%d", calendar.ID))
+
+	err = app.writeJSON(
+		w,
+		http.StatusCreated,
+		envelope{"calendar": calendar},
+		headers,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showCalendarHandler returns a calendar.
+// A METHOD on the APPLICATION struct.
+func (app *application) showCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	calendar := app.contextGetCalendar(r)
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"calendar": calendar}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCalendarsHandler returns the calendars owned by
+// or shared with the authenticated user, or of every
+// user for admins.
+// A METHOD on the APPLICATION struct.
+func (app *application) listCalendarsHandler(w http.ResponseWriter, r *http.Request) {
+	owner, err := app.eventOwner(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	calendars, err := app.models.Calendars.GetAll(owner)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"calendars": calendars}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCalendarHandler updates the name, color or
+// default time zone of a calendar.
+// A METHOD on the APPLICATION struct.
+func (app *application) updateCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	calendar := app.contextGetCalendar(r)
+
+	// Pointer fields are nil if they were not provided,
+	// in which case they are left unchanged.
+	var input struct {
+		Name     *string `json:"name"`
+		Color    *string `json:"color"`
+		TimeZone *string `json:"time_zone"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		calendar.Name = *input.Name
+	}
+	if input.Color != nil {
+		calendar.Color = *input.Color
+	}
+	if input.TimeZone != nil {
+		calendar.TimeZone = *input.TimeZone
+	}
+
+	v := validator.New()
+	if data.ValidateCalendar(v, calendar); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Calendars.Update(calendar, 0)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"calendar": calendar}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCalendarHandler deletes a calendar, and moves
+// its events to the trash.
+// A METHOD on the APPLICATION struct.
+func (app *application) deleteCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	calendar := app.contextGetCalendar(r)
+
+	events, err := app.models.Calendars.Delete(calendar.ID, 0, app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Send the events moved to the trash to webhooks
+	// and event streams.
+	for _, event := range events {
+		app.publishEventChange(data.EventDeleted, event)
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "calendar successfully deleted"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listCalendarEventsHandler returns the events in a
+// calendar, accepting the same query string values as
+// listEventsHandler.
+// A METHOD on the APPLICATION struct.
+func (app *application) listCalendarEventsHandler(w http.ResponseWriter, r *http.Request) {
+	calendar := app.contextGetCalendar(r)
+
+	// The calendar has already been checked, so its
+	// events are not scoped to an owner. Users it is
+	// shared with for free/busy time only see when it
+	// is busy.
+	app.listEvents(w, r, 0, calendar.ID, calendar.Role == data.RoleFreeBusy)
+}
@@ -35,3 +35,51 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 	}
 	return user
 }
+
+// Convert the strings "calendar" and "event" to
+// contextKey types. These constants are used as the
+// keys for the calendar and event loaded by the
+// requireCalendarRole() and requireEventRole()
+// middleware.
+const (
+	calendarContextKey = contextKey("calendar")
+	eventContextKey    = contextKey("event")
+)
+
+// contextSetCalendar method returns a new copy of the
+// request with the provided Calendar struct added to
+// the context.
+func (app *application) contextSetCalendar(r *http.Request, calendar *data.Calendar) *http.Request {
+	ctx := context.WithValue(r.Context(), calendarContextKey, calendar)
+	return r.WithContext(ctx)
+}
+
+// contextGetCalendar method retrieves the Calendar
+// struct from the request context. Only used by
+// handlers wrapped in requireCalendarRole().
+func (app *application) contextGetCalendar(r *http.Request) *data.Calendar {
+	calendar, ok := r.Context().Value(calendarContextKey).(*data.Calendar)
+	if !ok {
+		panic("missing calendar value in request context")
+	}
+	return calendar
+}
+
+// contextSetEvent method returns a new copy of the
+// request with the provided Event struct added to the
+// context.
+func (app *application) contextSetEvent(r *http.Request, event *data.Event) *http.Request {
+	ctx := context.WithValue(r.Context(), eventContextKey, event)
+	return r.WithContext(ctx)
+}
+
+// contextGetEvent method retrieves the Event struct
+// from the request context. Only used by handlers
+// wrapped in requireEventRole().
+func (app *application) contextGetEvent(r *http.Request) *data.Event {
+	event, ok := r.Context().Value(eventContextKey).(*data.Event)
+	if !ok {
+		panic("missing event value in request context")
+	}
+	return event
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+)
+
+/*
+	Delivery Queue for Webhooks
+*/
+
+// Define the settings of the webhook delivery queue:
+//  1. webhookBatchSize: deliveries sent on each run
+//  2. webhookTimeout: time allowed for a webhook's URL
+//     to respond
+//  3. webhookClaimLease: time before a delivery which
+//     was claimed, but not recorded as sent, is tried
+//     again, such as when the server stopped while
+//     sending it
+//  4. webhookMaxAttempts: attempts made to send a
+//     delivery before it fails
+//  5. webhookRetryDelay: delay before the first retry,
+//     doubled after each further attempt
+//  6. webhookRetention: time finished deliveries are
+//     kept in the history
+//  7. webhookPruneInterval: time between removals of
+//     deliveries older than the retention period
+const (
+	webhookBatchSize     = 50
+	webhookTimeout       = 10 * time.Second
+	webhookClaimLease    = time.Minute
+	webhookMaxAttempts   = 10
+	webhookRetryDelay    = time.Minute
+	webhookRetention     = 30 * 24 * time.Hour
+	webhookPruneInterval = time.Hour
+)
+
+// errWebhookAddress is returned when a webhook delivery
+// would be sent to an address which isn't allowed.
+var errWebhookAddress = errors.New("webhook address is not allowed")
+
+// blockedWebhookNetworks lists the networks webhooks
+// are not sent to, besides the loopback, private,
+// link-local and other addresses which aren't global
+// unicast: the "this network" block, and the shared
+// address space used by carrier-grade NAT and some
+// cloud metadata services.
+var blockedWebhookNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// webhookAddrAllowed reports whether webhooks may be
+// sent to an IP address: a public address, or one in a
+// network the operator allowed. Otherwise loopback,
+// private and link-local addresses are refused, so a
+// webhook can't reach the server itself, or services
+// on its network such as a cloud metadata endpoint.
+func webhookAddrAllowed(addr netip.Addr, allowed []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, prefix := range allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range blockedWebhookNetworks {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// newWebhookClient returns the client which sends
+// webhook deliveries. Each address a webhook's host
+// resolves to is checked with webhookAddrAllowed() as
+// it is dialled, so a host can't pass a check and then
+// resolve to another address. Proxies are not used,
+// since the proxy's address would be checked instead.
+// Redirects are not followed, so a delivery is only
+// sent to the URL it was signed for, and a redirect
+// fails the attempt.
+func newWebhookClient(allowed []netip.Prefix) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !webhookAddrAllowed(addrPort.Addr(), allowed) {
+				return fmt.Errorf("%w: %s", errWebhookAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// enqueueWebhooks queues the payload of a change to
+// an event to be sent to the webhooks subscribed to
+// it. The change has already been made, so errors are
+// logged rather than sent to the client.
+// A METHOD on the APPLICATION struct.
+func (app *application) enqueueWebhooks(changeType string, event *data.Event, payload []byte) {
+	_, err := app.models.Webhooks.Enqueue(changeType, event, payload)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{
+			"event_id": strconv.FormatInt(event.ID, 10),
+		})
+	}
+}
+
+// runWebhooks sends due webhook deliveries every
+// webhooks interval, and removes old deliveries from
+// the history every webhookPruneInterval, until the
+// context is cancelled. It is run in a background
+// goroutine by serve(), so the shutdown waits for it
+// to finish sending.
+// A METHOD on the APPLICATION struct.
+func (app *application) runWebhooks(ctx context.Context) {
+	ticker := time.NewTicker(app.config.webhooks.interval)
+	defer ticker.Stop()
+	pruneTicker := time.NewTicker(webhookPruneInterval)
+	defer pruneTicker.Stop()
+
+	app.pruneWebhookDeliveries()
+
+	for {
+		app.sendDueWebhooks(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-pruneTicker.C:
+			app.pruneWebhookDeliveries()
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDueWebhooks sends a batch of the webhook
+// deliveries which are due. Each delivery is claimed
+// before it is sent, so it is only sent once at a
+// time, and each attempt is recorded. A delivery which
+// is not accepted is tried again after a delay, which
+// doubles with each attempt, until it has been tried
+// webhookMaxAttempts times.
+// A METHOD on the APPLICATION struct.
+func (app *application) sendDueWebhooks(ctx context.Context) {
+	now := time.Now()
+
+	deliveries, err := app.models.Webhooks.DueDeliveries(now, webhookBatchSize)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		// Stop sending if the server is shutting down.
+		if ctx.Err() != nil {
+			return
+		}
+
+		claimed, err := app.models.Webhooks.ClaimDelivery(delivery, now, time.Now().Add(webhookClaimLease))
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		attempt := app.sendWebhook(delivery)
+
+		// Work out the status of the delivery after the
+		// attempt, and when it is next tried.
+		status := data.DeliverySucceeded
+		var next time.Time
+		if attempt.Error != "" {
+			attempts := delivery.AttemptsMade + 1
+			status = data.DeliveryPending
+			next = time.Now().Add(webhookRetryDelay << (attempts - 1))
+			if attempts >= webhookMaxAttempts {
+				status = data.DeliveryFailed
+			}
+		}
+
+		err = app.models.Webhooks.RecordAttempt(delivery, attempt, status, next)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"delivery_id": strconv.FormatInt(delivery.ID, 10),
+			})
+		}
+	}
+}
+
+// sendWebhook POSTs a delivery's payload to its
+// webhook's URL, and returns the outcome. The attempt
+// succeeds if the response has a 2xx status.
+// A METHOD on the APPLICATION struct.
+func (app *application) sendWebhook(delivery *data.WebhookDelivery) *data.WebhookAttempt {
+	attempt := &data.WebhookAttempt{AttemptedAt: time.Now()}
+
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	// Set the headers which identify the delivery, and
+	// sign the payload with the webhook's secret, so
+	// the receiver can check it came from this API.
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "greenlight-webhooks/"+version)
+	req.Header.Set("X-Greenlight-Event", delivery.EventType)
+	req.Header.Set("X-Greenlight-Delivery", strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set("X-Greenlight-Signature", webhookSignature(delivery.Secret, delivery.Payload))
+
+	res, err := app.webhookClient.Do(req)
+	attempt.DurationMs = time.Since(attempt.AttemptedAt).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer res.Body.Close()
+
+	// Read some of the response body, so the connection
+	// can be reused. The body itself is ignored.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64*1024))
+
+	attempt.StatusCode = res.StatusCode
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected response status %d", res.StatusCode)
+	}
+	return attempt
+}
+
+// webhookSignature returns the signature of a webhook
+// payload, sent in the X-Greenlight-Signature header.
+// It is "sha256=" followed by the hex HMAC-SHA256 of
+// the payload, keyed with the webhook's secret.
+func webhookSignature(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// pruneWebhookDeliveries removes the finished webhook
+// deliveries older than the retention period from the
+// history.
+// A METHOD on the APPLICATION struct.
+func (app *application) pruneWebhookDeliveries() {
+	pruned, err := app.models.Webhooks.PruneDeliveries(time.Now().Add(-webhookRetention))
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+	if pruned > 0 {
+		app.logger.PrintInfo("pruned webhook deliveries", map[string]string{
+			"deliveries": strconv.FormatInt(pruned, 10),
+		})
+	}
+}
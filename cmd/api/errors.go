@@ -114,6 +114,25 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// preconditionFailedResponse method.
+// Writes a 412 Precondition Failed and plain English
+// message, when the If-Match header of a request
+// doesn't match the current version of the record.
+// A METHOD on the APPLICATION struct.
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has changed since it was fetched, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// contentTooLargeResponse method.
+// Writes a 413 Content Too Large and the largest size
+// the endpoint accepts.
+// A METHOD on the APPLICATION struct.
+func (app *application) contentTooLargeResponse(w http.ResponseWriter, r *http.Request, maxBytes int64) {
+	message := fmt.Sprintf("the file must not be larger than %d bytes", maxBytes)
+	app.errorResponse(w, r, http.StatusRequestEntityTooLarge, message)
+}
+
 // rateLimitExceededResponse method.
 // A METHOD on the APPLICATION struct.
 func (app *application) rateLimitExceededResponse(
@@ -154,3 +173,11 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account does not have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+// unsupportedMediaTypeResponse method.
+// Writes a 415 Unsupported Media Type and the content
+// type the endpoint expects.
+func (app *application) unsupportedMediaTypeResponse(w http.ResponseWriter, r *http.Request, expected string) {
+	message := fmt.Sprintf("the request body must have the content type %s", expected)
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
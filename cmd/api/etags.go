@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+)
+
+/*
+	Helper Functions for Conditional Requests
+*/
+
+// eventETag returns the entity tag of an event's
+// version, a strong ETag made from its ID and version.
+// Every change to the event's own fields increments
+// its version, so a client can make an update
+// conditional on it with If-Match.
+func eventETag(event *data.Event) string {
+	return fmt.Sprintf(`"%d-%d"`, event.ID, event.Version)
+}
+
+// eventFieldsETag returns the entity tag of an event
+// as it is sent, with a sparse fieldset, converted to
+// a time zone, and with the RSVP summary of its
+// attendees. The replies of its attendees don't change
+// its version, and the bytes sent differ with each of
+// these, so a hash of them is added to the ID and
+// version, and a strong tag is still only shared by
+// identical representations. If none is given, it is
+// the tag returned by eventETag().
+func eventFieldsETag(event *data.Event, fields []string, loc *time.Location) string {
+	tag := fmt.Sprintf("%d-%d", event.ID, event.Version)
+	if len(fields) > 0 || loc != nil || event.RSVP != nil {
+		hash := sha256.New()
+		fmt.Fprintf(hash, "%s;", strings.Join(fields, ","))
+		if loc != nil {
+			fmt.Fprintf(hash, "%s;", loc)
+		}
+		writeRSVPSummary(hash, event.RSVP)
+		tag += "-" + hex.EncodeToString(hash.Sum(nil)[:8])
+	}
+	return `"` + tag + `"`
+}
+
+// writeRSVPSummary writes the counts of an RSVP
+// summary to an entity tag's hash, if the event has
+// one.
+func writeRSVPSummary(w io.Writer, rsvp *data.RSVPSummary) {
+	if rsvp == nil {
+		return
+	}
+	fmt.Fprintf(w, "rsvp:%d,%d,%d,%d;", rsvp.NeedsAction, rsvp.Accepted, rsvp.Declined, rsvp.Tentative)
+}
+
+// eventVersionTag returns the strong tag of the event
+// version an event ETag names, without the hash added
+// by eventFieldsETag(). Weak tags, and "*", are
+// returned unchanged.
+func eventVersionTag(tag string) string {
+	if !strings.HasPrefix(tag, `"`) {
+		return tag
+	}
+	parts := strings.SplitN(strings.Trim(tag, `"`), "-", 3)
+	if len(parts) < 3 {
+		return tag
+	}
+	return `"` + parts[0] + "-" + parts[1] + `"`
+}
+
+// eventListETag returns the entity tag of a page of
+// events, a weak ETag made from the ID and version of
+// each event on the page and the RSVP summary of its
+// attendees, the pagination metadata, and the fieldset
+// and time zone the page is sent with. It changes when
+// an event on the page changes, or the page itself
+// does.
+func eventListETag(events []*data.Event, metadata data.Metadata, fields []string, loc *time.Location) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s;", strings.Join(fields, ","))
+	if loc != nil {
+		fmt.Fprintf(hash, "%s;", loc)
+	}
+	for _, event := range events {
+		fmt.Fprintf(hash, "%d-%d-%d;", event.ID, event.Version, event.Start.Unix())
+		writeRSVPSummary(hash, event.RSVP)
+	}
+
+	// Encoding the metadata can't fail, so the error is
+	// ignored.
+	js, _ := json.Marshal(metadata)
+	hash.Write(js)
+
+	return `W/"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+}
+
+// etagMatch reports whether an If-Match or
+// If-None-Match header value, a list of entity tags or
+// "*", matches the ETag. With weak comparison, the
+// W/ prefix of either tag is ignored. With strong
+// comparison, weak tags never match.
+func etagMatch(header string, etag string, weak bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		if tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag header of a response, and
+// reports whether the request's If-None-Match header
+// matches it. If it does, a 304 Not Modified response
+// is sent, and the handler should return.
+// A METHOD on the APPLICATION struct.
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagMatch(header, etag, true) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// preconditionFailed reports whether the request's
+// If-Match header, if it has one, fails to match the
+// ETag of an event. The ID and version are compared
+// strongly, so the tag of any representation of the
+// current version matches, whatever its fieldset or
+// time zone. If it fails, a 412 Precondition Failed
+// response is sent, and the handler should return.
+// A METHOD on the APPLICATION struct.
+func (app *application) preconditionFailed(w http.ResponseWriter, r *http.Request, event *data.Event) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return false
+	}
+
+	tags := strings.Split(header, ",")
+	for i, tag := range tags {
+		tags[i] = eventVersionTag(strings.TrimSpace(tag))
+	}
+	if etagMatch(strings.Join(tags, ","), eventETag(event), false) {
+		return false
+	}
+
+	app.preconditionFailedResponse(w, r)
+	return true
+}
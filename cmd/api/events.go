@@ -1,12 +1,19 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/robwestbrook/greenlight/internal"
 	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/jsonpatch"
 	"github.com/robwestbrook/greenlight/internal/validator"
 )
 
@@ -21,12 +28,18 @@ func (app *application) createEventHandler(w http.ResponseWriter, r *http.Reques
 	// expected in the HTTP body. This struct is the
 	// *target decode destination*.
 	var input struct {
-		Title       string   `json:"title"`
-		Description string   `json:"description,omitempty"`
-		Tags        []string `json:"tags,omitempty"`
-		AllDay      bool     `json:"all_day"`
-		Start       string   `json:"start"`
-		End         string   `json:"end"`
+		CalendarID  int64       `json:"calendar_id,omitempty"`
+		Title       string      `json:"title"`
+		Description string      `json:"description,omitempty"`
+		Tags        []string    `json:"tags,omitempty"`
+		AllDay      bool        `json:"all_day"`
+		Start       string      `json:"start"`
+		End         string      `json:"end"`
+		TimeZone    string      `json:"time_zone,omitempty"`
+		RRule       string      `json:"rrule,omitempty"`
+		ExDates     []string    `json:"exdates,omitempty"`
+		Reminders   []int       `json:"reminders,omitempty"`
+		Location    *data.Place `json:"location,omitempty"`
 	}
 
 	// Use the readJSON() helper to decode request body
@@ -38,18 +51,50 @@ func (app *application) createEventHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Copy values from input struct to a new Event struct
+	// Initialize a new Validator, and read the time zone
+	// requested for the response.
+	v := validator.New()
+	loc := app.readTimeZone(r, v)
+
+	// Find the calendar the event is added to. The
+	// authenticated user must be able to edit it.
+	calendar, err := app.eventCalendar(r, input.CalendarID, v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Events without a time zone are scheduled in the
+	// default time zone of their calendar.
+	if input.TimeZone == "" {
+		input.TimeZone = calendar.TimeZone
+	}
+
+	// Copy values from input struct to a new Event struct,
+	// owned by the calendar's owner and made by the
+	// authenticated user. The times are read in the
+	// event's time zone, so they are converted once the
+	// rest is copied.
 	event := &data.Event{
+		UserID:      calendar.UserID,
+		CalendarID:  calendar.ID,
+		UpdatedBy:   app.contextGetUser(r).ID,
 		Title:       input.Title,
 		Description: input.Description,
 		Tags:        input.Tags,
 		AllDay:      input.AllDay,
-		Start:       internal.StringToTime(input.Start),
-		End:         internal.StringToTime(input.End),
+		TimeZone:    input.TimeZone,
+		RRule:       input.RRule,
+		Reminders:   input.Reminders,
+		Place:       input.Location,
 	}
-
-	// Initialize a new Validator
-	v := validator.New()
+	event.Start = eventTime(event, input.Start, v, "start")
+	event.End = eventTime(event, input.End, v, "end")
+	event.ExDates = eventTimes(event, input.ExDates, v, "exdates")
 
 	// Call the ValidateEvent() function and return a
 	// response contianing errors if any checks fail
@@ -68,6 +113,9 @@ func (app *application) createEventHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Send the new event to webhooks and event streams.
+	app.publishEventChange(data.EventCreated, event)
+
 	// With the HTTP response, include a Location header
 	// so the client knows which URL to find the resource.
 	// Create an empty http.Header map  and use the Set()
@@ -82,7 +130,7 @@ func (app *application) createEventHandler(w http.ResponseWriter, r *http.Reques
 	err = app.writeJSON(
 		w,
 		http.StatusCreated,
-		envelope{"event": event},
+		envelope{"event": event.In(loc)},
 		headers,
 	)
 	if err != nil {
@@ -93,25 +141,39 @@ func (app *application) createEventHandler(w http.ResponseWriter, r *http.Reques
 // showEventHandler
 // A METHOD on the APPLICATION struct.
 func (app *application) showEventHandler(w http.ResponseWriter, r *http.Request) {
-	// Use the readIDParam method in helpers.go
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
+	// Read the time zone requested for the response,
+	// and the sparse fieldset of the event to send.
+	v := validator.New()
+	loc := app.readTimeZone(r, v)
+	fields := app.readCSV(r.URL.Query(), "fields", []string{})
+	data.ValidateFields(v, fields, data.EventFields)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	// Call the Get() method to fetch data for a specific
-	// event. Use Errors.Is() to check if a
-	// data.ErrRecordNotFound is returned. If so, send a
-	// 404 Not Found response to client.
-	event, err := app.models.Events.Get(id)
-	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
-		default:
+	// The event has been loaded by the
+	// requireEventFieldsRole() middleware, which checked
+	// that the user may view it, and only read the
+	// fields in the fieldset from the events table. Add
+	// the replies of its attendees, if they were
+	// requested.
+	event := app.contextGetEvent(r)
+	if data.IncludesField(fields, "rsvp") {
+		err := app.addRSVPSummaries(event)
+		if err != nil {
 			app.serverErrorResponse(w, r, err)
+			return
 		}
+	}
+
+	// Send a 304 Not Modified response if the client's
+	// copy is still current. The replies are covered by
+	// the ETag, since they don't change the version.
+	// The time zone can be requested with a header, so
+	// caches must keep a copy for each time zone.
+	w.Header().Add("Vary", "Accept-Timezone")
+	if app.notModified(w, r, eventFieldsETag(event, fields, loc)) {
 		return
 	}
 
@@ -119,7 +181,12 @@ func (app *application) showEventHandler(w http.ResponseWriter, r *http.Request)
 	// the HTTP response. Use the envelope type in
 	// cmd/api/helpers.go to create an envelope instance
 	// of the event.
-	err = app.writeJSON(w, http.StatusOK, envelope{"event": event}, nil)
+	event = event.In(loc)
+	var out interface{} = event
+	if len(fields) > 0 {
+		out = event.Fields(fields)
+	}
+	err := app.writeJSON(w, http.StatusOK, envelope{"event": out}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
@@ -128,47 +195,143 @@ func (app *application) showEventHandler(w http.ResponseWriter, r *http.Request)
 // updateEventHandler updates a record in database
 // A METHOD on the APPLICATION struct.
 func (app *application) updateEventHandler(w http.ResponseWriter, r *http.Request) {
-	// Extract event ID from the URL
-	id, err := app.readIDParam(r)
+	// The existing event record has been loaded by the
+	// requireEventRole() middleware, which checked that
+	// the user may edit it. If the request is
+	// conditional on a version of the event, it must
+	// still be current.
+	event := app.contextGetEvent(r)
+	if app.preconditionFailed(w, r, event) {
+		return
+	}
+
+	// Read the update from the request body, dispatching
+	// on its content type. A plain JSON body holds the
+	// fields to change. A JSON Merge Patch or JSON Patch
+	// is applied to the event's fields, and the result
+	// holds every field.
+	var input eventUpdateInput
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "", "application/json":
+		err = app.readJSON(w, r, &input)
+	case "application/merge-patch+json":
+		err = app.readEventPatch(w, r, event, jsonpatch.MergePatch, jsonpatch.MergePatchMembers, &input)
+	case "application/json-patch+json":
+		err = app.readEventPatch(w, r, event, jsonpatch.Apply, jsonpatch.Members, &input)
+	default:
+		app.unsupportedMediaTypeResponse(w, r, "application/json, application/merge-patch+json or application/json-patch+json")
+		return
+	}
+	if err != nil {
+		var readOnlyField *readOnlyFieldError
+		switch {
+		case errors.As(err, &readOnlyField):
+			app.failedValidationResponse(w, r, map[string]string{readOnlyField.field: "is not a writable field"})
+		case errors.Is(err, jsonpatch.ErrPathNotFound), errors.Is(err, jsonpatch.ErrTestFailed):
+			app.errorResponse(w, r, http.StatusConflict, err.Error())
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	// Initialize a new Validator, and read the time zone
+	// requested for the response.
+	v := validator.New()
+	loc := app.readTimeZone(r, v)
+
+	// Copy the values from the request body to the
+	// event record.
+	err = app.applyEventUpdate(r, event, &input, v)
 	if err != nil {
-		app.notFoundResponse(w, r)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Get the existing event record from the database.
-	// Send a 404 Not Found response if matching record
-	// is not found.
-	event, err := app.models.Events.Get(id)
+	// Validate the updated event record. Send the client
+	// a 422 Unprocessible Entity response if fails.
+
+	if data.ValidateEvent(v, event); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Pass the updated event record to Update() method,
+	// recording the authenticated user as having made the
+	// new version. Check for edit conflict and server
+	// error. A conditional request is told its
+	// precondition failed.
+	event.UpdatedBy = app.contextGetUser(r).ID
+	err = app.models.Events.Update(event, 0)
 	if err != nil {
 		switch {
-		case errors.Is(err, data.ErrRecordNotFound):
-			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict) && r.Header.Get("If-Match") != "":
+			app.preconditionFailedResponse(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	// Declare an input struct to hold data from client
-	// Pointers have as their zero value: "nil". If an
-	// input field doesn't have any value, we can check
-	// for zero value. The empty fields will be "nil".
-	var input struct {
-		Title       *string  `json:"title"`
-		Description *string  `json:"description"`
-		Tags        []string `json:"tags"`
-		AllDay      *bool    `json:"all_day"`
-		Start       *string  `json:"start"`
-		End         *string  `json:"end"`
+	// Add the replies of the event's attendees, and
+	// send the updated event to webhooks and event
+	// streams. Write the updated event record in a JSON
+	// response.
+	err = app.addRSVPSummaries(event)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
 	}
+	app.publishEventChange(data.EventUpdated, event)
 
-	// Read the JSON request body data into input struct.
-	err = app.readJSON(w, r, &input)
+	headers := make(http.Header)
+	headers.Set("ETag", eventFieldsETag(event, nil, loc))
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"event": event.In(loc)},
+		headers,
+	)
 	if err != nil {
-		app.badRequestResponse(w, r, err)
-		return
+		app.serverErrorResponse(w, r, err)
 	}
+}
+
+// eventUpdateInput holds the fields of an update to
+// an event, read from a JSON request body. Pointers
+// have as their zero value: "nil". If an input field
+// doesn't have any value, we can check for zero value.
+// The empty fields will be "nil".
+type eventUpdateInput struct {
+	CalendarID  *int64      `json:"calendar_id"`
+	Title       *string     `json:"title"`
+	Description *string     `json:"description"`
+	Tags        []string    `json:"tags"`
+	AllDay      *bool       `json:"all_day"`
+	Start       *string     `json:"start"`
+	End         *string     `json:"end"`
+	TimeZone    *string     `json:"time_zone"`
+	RRule       *string     `json:"rrule"`
+	ExDates     []string    `json:"exdates"`
+	Reminders   []int       `json:"reminders"`
+	Location    *data.Place `json:"location"`
+}
 
+// applyEventUpdate copies the fields of an update to
+// an event. If the event is moved to a calendar the
+// user can't edit, an error message is recorded in the
+// validator. The event is not validated.
+// A METHOD on the APPLICATION struct.
+func (app *application) applyEventUpdate(
+	r *http.Request,
+	event *data.Event,
+	input *eventUpdateInput,
+	v *validator.Validator,
+) error {
 	// Copy values from request body to corresponding
 	// fields of the event record.
 	// If input values are nil, no corresponding
@@ -176,6 +339,19 @@ func (app *application) updateEventHandler(w http.ResponseWriter, r *http.Reques
 	// body. Therefore no changes are made. Since the
 	// input fields are pointers, they must be
 	// dereferenced, using the * operator.
+	// An event can only be moved to a calendar the user
+	// can edit, and is then owned by that calendar's
+	// owner.
+	if input.CalendarID != nil {
+		calendar, err := app.eventCalendar(r, *input.CalendarID, v)
+		if err != nil {
+			return err
+		}
+		if calendar != nil {
+			event.UserID = calendar.UserID
+			event.CalendarID = calendar.ID
+		}
+	}
 	if input.Title != nil {
 		event.Title = *input.Title
 	}
@@ -187,65 +363,218 @@ func (app *application) updateEventHandler(w http.ResponseWriter, r *http.Reques
 	if input.Tags != nil {
 		event.Tags = input.Tags
 	}
+	// The all day flag and time zone are copied before
+	// the times, which are read according to them.
 	if input.AllDay != nil {
 		event.AllDay = *input.AllDay
 	}
+	if input.TimeZone != nil {
+		event.TimeZone = *input.TimeZone
+	}
 	if input.Start != nil {
-		event.Start = internal.StringToTime(*input.Start)
+		event.Start = eventTime(event, *input.Start, v, "start")
 	}
 	if input.End != nil {
-		event.End = internal.StringToTime(*input.End)
+		event.End = eventTime(event, *input.End, v, "end")
+	}
+	if input.RRule != nil {
+		event.RRule = *input.RRule
+	}
+	if input.ExDates != nil {
+		event.ExDates = eventTimes(event, input.ExDates, v, "exdates")
+	}
+	if input.Reminders != nil {
+		event.Reminders = input.Reminders
+	}
+	// A location replaces the whole place, so an empty
+	// location removes it.
+	if input.Location != nil {
+		event.Place = input.Location
 	}
 
-	// Validate the updated event record. Send the client
-	// a 422 Unprocessible Entity response if fails.
-	v := validator.New()
+	return nil
+}
 
-	if data.ValidateEvent(v, event); !v.Valid() {
-		app.failedValidationResponse(w, r, v.Errors)
-		return
+// readOnlyFieldError is returned by readEventPatch()
+// when a patch refers to a member which is not one of
+// the writable fields of an event.
+type readOnlyFieldError struct {
+	field string
+}
+
+func (e *readOnlyFieldError) Error() string {
+	return fmt.Sprintf("%s is not a writable field", e.field)
+}
+
+// readEventPatch reads a JSON Merge Patch or JSON Patch
+// from the request body, applies it with the patch
+// function to the fields of the event, and decodes the
+// patched fields into dst. The members function lists
+// the fields the patch refers to, and a field which
+// isn't writable returns a *readOnlyFieldError. Every
+// field is set in dst, so a field the patch removed is
+// cleared, except the calendar, which is left
+// unchanged.
+// A METHOD on the APPLICATION struct.
+func (app *application) readEventPatch(
+	w http.ResponseWriter,
+	r *http.Request,
+	event *data.Event,
+	patch func(doc []byte, patch []byte) ([]byte, error),
+	members func(patch []byte) ([]string, error),
+	dst *eventUpdateInput,
+) error {
+	// Limit the size of the request body to 1MB, as
+	// readJSON() does.
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+		}
+		return err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return errors.New("body must not be empty")
 	}
 
-	// Pass the updated event record to Update() method.
-	// Check for edit conflict and server error
-	err = app.models.Events.Update(event)
+	// Encoding the fields can't fail, so the error is
+	// ignored.
+	doc, _ := json.Marshal(eventDocument(event))
+
+	// A patch may only refer to the writable fields, so
+	// a read-only field such as the version isn't
+	// reported as missing, or as an unknown field of
+	// the patched event.
+	var writable map[string]json.RawMessage
+	_ = json.Unmarshal(doc, &writable)
+	fields, err := members(body)
 	if err != nil {
-		switch {
-		case errors.Is(err, data.ErrEditConflict):
-			app.editConflictResponse(w, r)
-		default:
-			app.serverErrorResponse(w, r, err)
+		return err
+	}
+	for _, field := range fields {
+		if _, ok := writable[field]; !ok {
+			return &readOnlyFieldError{field: field}
 		}
-		return
 	}
 
-	// Write the updated event record in a JSON response.
-	err = app.writeJSON(
-		w,
-		http.StatusOK,
-		envelope{"event": event},
-		nil,
-	)
+	patched, err := patch(doc, body)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	err = dec.Decode(dst)
+	if err != nil {
+		return fmt.Errorf("patched event is not valid: %v", err)
+	}
+
+	// Clear the fields the patch removed.
+	for _, field := range []**string{&dst.Title, &dst.Description, &dst.Start, &dst.End, &dst.TimeZone, &dst.RRule} {
+		if *field == nil {
+			*field = new(string)
+		}
+	}
+	if dst.AllDay == nil {
+		dst.AllDay = new(bool)
+	}
+	if dst.Tags == nil {
+		dst.Tags = []string{}
+	}
+	if dst.ExDates == nil {
+		dst.ExDates = []string{}
+	}
+	if dst.Reminders == nil {
+		dst.Reminders = []int{}
+	}
+	if dst.Location == nil {
+		dst.Location = &data.Place{}
+	}
+
+	// The event only moves if the patch changes its
+	// calendar.
+	if dst.CalendarID != nil && *dst.CalendarID == event.CalendarID {
+		dst.CalendarID = nil
 	}
+
+	return nil
 }
 
-// deleteEventHandler deletes a record in database
+// eventDocument returns the fields of an event that
+// can be updated, in the form of an update request
+// body, for a patch to be applied to. The times are
+// written in the event's time zone, or as dates for an
+// all day event.
+func eventDocument(event *data.Event) *eventUpdateInput {
+	format := func(t time.Time) string {
+		if event.AllDay {
+			return t.Format("2006-01-02")
+		}
+		return t.In(event.Location()).Format(time.RFC3339Nano)
+	}
+
+	start := format(event.Start)
+	end := format(event.End)
+	exdates := make([]string, 0, len(event.ExDates))
+	for _, exdate := range event.ExDates {
+		exdates = append(exdates, format(exdate))
+	}
+
+	doc := &eventUpdateInput{
+		CalendarID:  &event.CalendarID,
+		Title:       &event.Title,
+		Description: &event.Description,
+		Tags:        event.Tags,
+		AllDay:      &event.AllDay,
+		Start:       &start,
+		End:         &end,
+		TimeZone:    &event.TimeZone,
+		RRule:       &event.RRule,
+		ExDates:     exdates,
+		Reminders:   event.Reminders,
+		Location:    event.Place,
+	}
+	if doc.Tags == nil {
+		doc.Tags = []string{}
+	}
+	if doc.Reminders == nil {
+		doc.Reminders = []int{}
+	}
+	if doc.Location == nil {
+		doc.Location = &data.Place{}
+	}
+	return doc
+}
+
+// deleteEventHandler moves a record in database to the
+// trash, from where it can be restored until it is
+// purged.
 // A METHOD on the APPLICATION struct.
 func (app *application) deleteEventHandler(w http.ResponseWriter, r *http.Request) {
-	// Get event ID from URL
-	id, err := app.readIDParam(r)
-	if err != nil {
-		app.notFoundResponse(w, r)
+	// The event has been loaded by the
+	// requireEventRole() middleware, which checked that
+	// the user may delete it. If the request is
+	// conditional on a version of the event, it must
+	// still be current, and is only deleted at that
+	// version.
+	event := app.contextGetEvent(r)
+	if app.preconditionFailed(w, r, event) {
 		return
 	}
+	var version int32
+	if r.Header.Get("If-Match") != "" {
+		version = event.Version
+	}
 
 	// Delete event from database. Send a 404 Not Found
 	// response to client if record not found.
-	err = app.models.Events.Delete(id)
+	err := app.models.Events.Delete(event.ID, 0, app.contextGetUser(r).ID, version)
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailedResponse(w, r)
 		case errors.Is(err, data.ErrRecordNotFound):
 			app.notFoundResponse(w, r)
 		default:
@@ -254,6 +583,10 @@ func (app *application) deleteEventHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	// Send the deleted event to webhooks and event
+	// streams.
+	app.publishEventChange(data.EventDeleted, event)
+
 	// Return a 200 OK status with success message
 	err = app.writeJSON(
 		w,
@@ -266,24 +599,98 @@ func (app *application) deleteEventHandler(w http.ResponseWriter, r *http.Reques
 	}
 }
 
-// listEventsHandler returns multiple events to client.
+// eventCalendar returns the calendar with the ID, for
+// an event to belong to. The authenticated user must
+// have the data.RoleEditor role or above on it. If the
+// ID is 0, the user's default calendar is returned. If
+// the user can't edit a calendar with the ID, an error
+// message is recorded in the validator and nil is
+// returned.
 // A METHOD on the APPLICATION struct.
-func (app *application) listEventsHandler(w http.ResponseWriter, r *http.Request) {
-	// Define an input struct to hold expected values
-	// from the request query string.
-	var input struct {
-		Title       string
-		Description string
-		Tags        []string
-		data.Filters
+func (app *application) eventCalendar(
+	r *http.Request,
+	calendarID int64,
+	v *validator.Validator,
+) (*data.Calendar, error) {
+	if calendarID == 0 {
+		return app.models.Calendars.GetDefault(app.contextGetUser(r).ID)
 	}
 
-	// Initialize a new Validator instance
-	v := validator.New()
+	calendar, err := app.models.Calendars.Get(calendarID, 0)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("calendar_id", "must be a calendar you can edit")
+			return nil, nil
+		}
+		return nil, err
+	}
 
-	// Call r.URL.Query() method to get the URL.Values
-	// map containing the query string data.
-	qs := r.URL.Query()
+	role, err := app.resourceRole(r, calendar.UserID, calendar.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !data.RoleIncludes(role, data.RoleEditor) {
+		v.AddError("calendar_id", "must be a calendar you can edit")
+		return nil, nil
+	}
+	return calendar, nil
+}
+
+// eventTime converts a start or end string from a
+// request body into a time for the event. Times without
+// a UTC offset are read in the event's time zone. All
+// day events keep only the date, which floats rather
+// than being shifted between time zones. If the string
+// can't be parsed, an error message is recorded in the
+// validator for the key, and the zero time is returned.
+func eventTime(event *data.Event, s string, v *validator.Validator, key string) time.Time {
+	var t time.Time
+	var err error
+	if event.AllDay {
+		t, err = internal.StringToDate(s)
+	} else {
+		t, err = internal.StringToTimeIn(s, event.Location())
+	}
+	if err != nil {
+		v.AddError(key, "must be a valid date or date and time")
+	}
+	return t
+}
+
+// eventTimes converts a slice of exdate strings from a
+// request body in the same way as eventTime().
+func eventTimes(event *data.Event, strs []string, v *validator.Validator, key string) []time.Time {
+	if strs == nil {
+		return nil
+	}
+	times := make([]time.Time, 0, len(strs))
+	for _, s := range strs {
+		times = append(times, eventTime(event, s, v, key))
+	}
+	return times
+}
+
+// eventListInput holds the query string values
+// accepted by the endpoints which list events.
+type eventListInput struct {
+	Title       string
+	Description string
+	Tags        []string
+	data.Filters
+}
+
+// readEventListInput reads the event list query string
+// values into an eventListInput, recording any errors
+// in the validator. The filters are validated with
+// data.ValidateFilters().
+// A METHOD on the APPLICATION struct.
+func (app *application) readEventListInput(
+	qs url.Values,
+	v *validator.Validator,
+) eventListInput {
+	// Define an input struct to hold expected values
+	// from the request query string.
+	var input eventListInput
 
 	// Use helpers to extract title and tags query string
 	// values, falling back to defaults. Defaults:
@@ -294,6 +701,55 @@ func (app *application) listEventsHandler(w http.ResponseWriter, r *http.Request
 	input.Description = app.readString(qs, "description", "")
 	input.Tags = app.readCSV(qs, "tags", []string{})
 
+	// Use the readString() helper to extract the
+	// tags_mode query string value. With "all" events
+	// must have every tag, and with "any" at least one
+	// of them. Default:
+	//	1.	tags_mode: all
+	input.Filters.TagsMode = app.readString(qs, "tags_mode", data.TagsModeAll)
+
+	// Use the readString() helper to extract the q query
+	// string value, a full-text search over the title,
+	// description and tags. It supports the FTS5 query
+	// syntax: "phrases", prefix* terms, AND, OR and NOT,
+	// and column filters such as title:party. Default:
+	//	1.	q: "" (no search)
+	input.Filters.Search = app.readString(qs, "q", "")
+
+	// Use the readTime() helper to extract the from and
+	// to query string values. When both are provided,
+	// only events overlapping the window are returned
+	// and recurring events are expanded into their
+	// occurrences. Defaults:
+	//	1.	from: zero time (no window)
+	//	2.	to: zero time (no window)
+	input.Filters.From = app.readTime(qs, "from", v)
+	input.Filters.To = app.readTime(qs, "to", v)
+
+	// Use helpers to extract the all_day, created_after
+	// and updated_since query string values. Defaults:
+	//	1.	all_day: nil (all and timed events)
+	//	2.	created_after: zero time (no filter)
+	//	3.	updated_since: zero time (no filter)
+	input.Filters.AllDay = app.readBool(qs, "all_day", v)
+	input.Filters.CreatedAfter = app.readTime(qs, "created_after", v)
+	input.Filters.UpdatedSince = app.readTime(qs, "updated_since", v)
+
+	// Use the readInt() helper to extract the
+	// calendar_id query string value. Default:
+	//	1.	calendar_id: 0 (all calendars)
+	input.Filters.CalendarID = int64(app.readInt(qs, "calendar_id", 0, v))
+
+	// Use helpers to extract the near and radius_km
+	// query string values. near is a "latitude,longitude"
+	// pair, and only events with coordinates within the
+	// radius of it are returned, with their distance
+	// from it. Defaults:
+	//	1.	near: nil (no radius search)
+	//	2.	radius_km: 10
+	input.Filters.Near = app.readPoint(qs, "near", v)
+	input.Filters.RadiusKm = app.readFloat(qs, "radius_km", 10, v)
+
 	// Use helpers to extract page and page_size query
 	// string values as integers. Read these values into
 	// the embedded Filters struct. Defaults:
@@ -302,11 +758,39 @@ func (app *application) listEventsHandler(w http.ResponseWriter, r *http.Request
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
+	// Use the readString() helper to extract the after
+	// and before query string values, the next_cursor
+	// and prev_cursor of another page. They page
+	// through the list from a record rather than by
+	// page number, which stays fast on deep pages and
+	// doesn't skip or repeat records inserted in
+	// between. Defaults:
+	//	1.	after: "" (no cursor)
+	//	2.	before: "" (no cursor)
+	input.Filters.After = app.readString(qs, "after", "")
+	input.Filters.Before = app.readString(qs, "before", "")
+
+	// Use the readBool() helper to extract the count
+	// query string value. Counting the total number of
+	// records is slow on large lists, so it is off by
+	// default for cursor pages. Default:
+	//	1.	count: true, or false with after or before
+	input.Filters.Count = input.Filters.After == "" && input.Filters.Before == ""
+	if count := app.readBool(qs, "count", v); count != nil {
+		input.Filters.Count = *count
+	}
+
 	// Use helpers to extract the sort query string value.
 	// Read the value into the embedded Filters struct.
-	// Default:
-	//	1.	id
-	input.Filters.Sort = app.readString(qs, "sort", "id")
+	// Searches are sorted by relevance, most relevant
+	// first, by default. Default:
+	//	1.	relevance, if q is provided
+	//	2.	id
+	defaultSort := "id"
+	if input.Filters.Search != "" {
+		defaultSort = "relevance"
+	}
+	input.Filters.Sort = app.readString(qs, "sort", defaultSort)
 
 	// Add supported values for sort to sort safelist
 	input.Filters.SortSafelist = []string{
@@ -315,38 +799,154 @@ func (app *application) listEventsHandler(w http.ResponseWriter, r *http.Request
 		"all_day",
 		"start",
 		"end",
+		"relevance",
+		"distance",
 		"-id",
 		"-title",
 		"-all_day",
 		"-start",
 		"-end",
+		"-relevance",
+		"-distance",
 	}
 
+	// Use the readCSV() helper to extract the fields
+	// query string value, a sparse fieldset of the
+	// events to send, checked against the fields
+	// safelist. Default:
+	//	1.	fields: empty slice (every field)
+	input.Filters.Fields = app.readCSV(qs, "fields", []string{})
+	input.Filters.FieldsSafelist = data.EventFields
+
 	// Execute the validation checks on the Filters
-	// struct, sending a response containing errors.
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+	// struct.
+	data.ValidateFilters(v, input.Filters)
+
+	return input
+}
+
+// eventFields returns the events to send in a list
+// response: the events themselves, or with a sparse
+// fieldset a map of the requested fields of each.
+func eventFields(events []*data.Event, fields []string) interface{} {
+	if len(fields) == 0 {
+		return events
+	}
+
+	values := make([]map[string]interface{}, 0, len(events))
+	for _, event := range events {
+		values = append(values, event.Fields(fields))
+	}
+	return values
+}
+
+// listEventsHandler returns multiple events to client.
+// A METHOD on the APPLICATION struct.
+func (app *application) listEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Scope the request to the user's own events,
+	// unless the user is an admin.
+	owner, err := app.eventOwner(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.listEvents(w, r, owner, 0, false)
+}
+
+// listEvents sends the events matching the query
+// string values of a list request, scoped to an owner,
+// to the client. If calendarID is not 0, only the
+// events in that calendar are listed. If freeBusy is
+// true, the events are sent without their details, and
+// can't be searched by them.
+// A METHOD on the APPLICATION struct.
+func (app *application) listEvents(
+	w http.ResponseWriter,
+	r *http.Request,
+	owner int64,
+	calendarID int64,
+	freeBusy bool,
+) {
+	// Initialize a new Validator instance
+	v := validator.New()
+
+	// Call r.URL.Query() method to get the URL.Values
+	// map containing the query string data, and read
+	// the search and filter values from it. Send a
+	// response containing errors if any checks fail.
+	input := app.readEventListInput(r.URL.Query(), v)
+	loc := app.readTimeZone(r, v)
+	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
+	if calendarID != 0 {
+		input.Filters.CalendarID = calendarID
+	}
+	if freeBusy {
+		input.Title, input.Description, input.Tags = "", "", []string{}
+		input.Filters.Search = ""
+		input.Filters.Near = nil
+	}
 
 	// Call the GetAll() method to get events,
 	// passing in filter parameters.
 	events, metadata, err := app.models.Events.GetAll(
+		owner,
 		input.Title,
 		input.Description,
 		input.Tags,
 		input.Filters,
 	)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, data.ErrInvalidSearch):
+			v.AddError("q", "must be a valid search query")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	// Send a JSON response containing the event data.
+	// Add the replies of the events' attendees, if
+	// they were requested. Free/busy views don't send
+	// them.
+	if data.IncludesField(input.Filters.Fields, "rsvp") && !freeBusy {
+		err = app.addRSVPSummaries(events...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	// Send a 304 Not Modified response if the client's
+	// copy of the page is still current. The replies are
+	// covered by the ETag, since they don't change the
+	// versions. The time zone can be requested with a
+	// header, so caches must keep a copy for each time
+	// zone.
+	w.Header().Add("Vary", "Accept-Timezone")
+	if app.notModified(w, r, eventListETag(events, metadata, input.Filters.Fields, loc)) {
+		return
+	}
+
+	// Convert the event times for output.
+	for i, event := range events {
+		if freeBusy {
+			event = event.FreeBusy()
+		}
+		events[i] = event.In(loc)
+	}
+
+	// Send a JSON response containing the event data,
+	// with only the requested fields of a sparse
+	// fieldset.
 	err = app.writeJSON(
 		w,
 		http.StatusOK,
-		envelope{"events": events, "metadata": metadata},
+		envelope{"events": eventFields(events, input.Filters.Fields), "metadata": metadata},
 		nil,
 	)
 	if err != nil {
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/ical"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for Free/Busy Queries
+*/
+
+// freeBusyUser reports when one user in a free/busy
+// query is busy. Users who could not be found, or
+// whose calendars are not shared with the
+// authenticated user, have an Error and no Busy times.
+// The same error is given for both, so the query
+// can't be used to find out which users exist.
+type freeBusyUser struct {
+	UserID int64                `json:"user_id,omitempty"`
+	Email  string               `json:"email,omitempty"`
+	Name   string               `json:"name,omitempty"`
+	Busy   []*data.BusyInterval `json:"busy"`
+	Error  string               `json:"error,omitempty"`
+}
+
+// freeBusyHandler returns when each of a list of
+// users, given by ID or email address, is busy in a
+// time window, without their event details. A user's
+// busy times are visible to themselves, to admins,
+// and to users any of their calendars are shared with.
+// The response is written in the iCalendar VFREEBUSY
+// format if the client accepts text/calendar.
+// A METHOD on the APPLICATION struct.
+func (app *application) freeBusyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserIDs []int64  `json:"user_ids"`
+		Emails  []string `json:"emails"`
+		From    string   `json:"from"`
+		To      string   `json:"to"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Validate the users and the window. Times without
+	// a UTC offset are read as UTC.
+	v := validator.New()
+	loc := app.readTimeZone(r, v)
+
+	validateFreeBusyUsers(v, input.UserIDs, input.Emails)
+
+	from, err := internal.ParseTimeString(input.From)
+	v.Check(err == nil, "from", "must be a valid date or date and time")
+	to, err := internal.ParseTimeString(input.To)
+	v.Check(err == nil, "to", "must be a valid date or date and time")
+	if v.Valid() {
+		data.ValidateWindow(v, from, to)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, err := app.freeBusyUsers(r, input.UserIDs, input.Emails, from, to)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if acceptsCalendar(r) {
+		app.writeFreeBusyCalendar(w, r, users, from, to)
+		return
+	}
+
+	// Convert the times for output.
+	if loc != nil {
+		from, to = from.In(loc), to.In(loc)
+		for _, user := range users {
+			for i, interval := range user.Busy {
+				user.Busy[i] = interval.In(loc)
+			}
+		}
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"freebusy": envelope{"from": from, "to": to, "users": users}},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// freeBusyUsers finds the users given by ID and by
+// email address, in the order they were given, and
+// when each is busy in the window [from, to). A user
+// given more than once is only returned once.
+// A METHOD on the APPLICATION struct.
+func (app *application) freeBusyUsers(
+	r *http.Request,
+	userIDs []int64,
+	emails []string,
+	from, to time.Time,
+) ([]*freeBusyUser, error) {
+	// Users see their own busy times, and admins see
+	// everyone's.
+	viewer, err := app.eventOwner(r)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []*freeBusyUser{}
+	seen := make(map[int64]bool)
+	add := func(user *data.User, err error, entry *freeBusyUser) error {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			entry.Error = "user not found or not shared with you"
+		case err != nil:
+			return err
+		case seen[user.ID]:
+			return nil
+		default:
+			seen[user.ID] = true
+			entry.Busy, err = app.userBusy(viewer, user, from, to)
+			if err != nil {
+				return err
+			}
+			if entry.Busy == nil {
+				entry.Error = "user not found or not shared with you"
+			} else {
+				entry.UserID = user.ID
+				entry.Email = user.Email
+				entry.Name = user.Name
+			}
+		}
+		users = append(users, entry)
+		return nil
+	}
+
+	for _, id := range userIDs {
+		user, err := app.models.Users.Get(id)
+		err = add(user, err, &freeBusyUser{UserID: id})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, email := range emails {
+		user, err := app.models.Users.GetByEmail(email)
+		err = add(user, err, &freeBusyUser{Email: email})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return users, nil
+}
+
+// validateFreeBusyUsers runs the validator to check
+// that a free/busy query names at least one user, and
+// not too many.
+func validateFreeBusyUsers(v *validator.Validator, userIDs []int64, emails []string) {
+	count := len(userIDs) + len(emails)
+	v.Check(count > 0, "user_ids", "must contain at least one user, or emails must be provided")
+	v.Check(count <= data.MaxFreeBusyUsers, "user_ids", fmt.Sprintf("must not contain more than %d users with emails", data.MaxFreeBusyUsers))
+}
+
+// userBusy returns when a user is busy in the window
+// [from, to), from the events the viewer may see the
+// busy times of. A viewer of 0 sees every event. nil
+// is returned if none of the user's calendars are
+// shared with the viewer.
+// A METHOD on the APPLICATION struct.
+func (app *application) userBusy(viewer int64, user *data.User, from, to time.Time) ([]*data.BusyInterval, error) {
+	if viewer == user.ID {
+		viewer = 0
+	}
+
+	if viewer != 0 {
+		shared, err := app.models.Shares.SharedWith(user.ID, viewer)
+		if err != nil || !shared {
+			return nil, err
+		}
+	}
+
+	return app.models.Events.Busy(user.ID, viewer, from, to)
+}
+
+// writeFreeBusyCalendar writes the result of a
+// free/busy query as an iCalendar (text/calendar)
+// stream, with a VFREEBUSY component for each user
+// whose busy times are shared. Busy periods are
+// written in UTC, as RFC 5545 requires.
+// A METHOD on the APPLICATION struct.
+func (app *application) writeFreeBusyCalendar(
+	w http.ResponseWriter,
+	r *http.Request,
+	users []*freeBusyUser,
+	from, to time.Time,
+) {
+	calendar := ical.NewComponent("VCALENDAR")
+	calendar.Add("VERSION", "2.0")
+	calendar.Add("PRODID", icsProductID)
+	calendar.Add("METHOD", "PUBLISH")
+
+	now := ical.FormatDateTime(time.Now())
+	for _, user := range users {
+		if user.Error != "" {
+			continue
+		}
+
+		freebusy := ical.NewComponent("VFREEBUSY")
+		freebusy.Add("UID", fmt.Sprintf("freebusy-%d-%s@greenlight", user.UserID, now))
+		freebusy.Add("DTSTAMP", now)
+		freebusy.Add("DTSTART", ical.FormatDateTime(from))
+		freebusy.Add("DTEND", ical.FormatDateTime(to))
+		if user.Name != "" {
+			freebusy.Add("ATTENDEE", "mailto:"+user.Email, ical.Param{Name: "CN", Value: user.Name})
+		} else {
+			freebusy.Add("ATTENDEE", "mailto:"+user.Email)
+		}
+		for _, interval := range user.Busy {
+			freebusy.Add(
+				"FREEBUSY",
+				ical.FormatDateTime(interval.Start)+"/"+ical.FormatDateTime(interval.End),
+				ical.Param{Name: "FBTYPE", Value: "BUSY"},
+			)
+		}
+		calendar.AddComponent(freebusy)
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	err := calendar.Encode(w)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// acceptsCalendar reports whether the Accept header of
+// a request lists the text/calendar media type.
+func acceptsCalendar(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err == nil && mediaType == "text/calendar" {
+			return true
+		}
+	}
+	return false
+}
@@ -5,12 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/data"
 	"github.com/robwestbrook/greenlight/internal/validator"
 )
 
@@ -26,20 +30,28 @@ type envelope map[string]interface{}
 // return. If not successful, return 0 and an error.
 // A METHOD on the APPLICATION struct.
 func (app *application) readIDParam(r *http.Request) (int64, error) {
+	return app.readNamedIDParam(r, "id")
+}
+
+// readNamedIDParam retrieves an ID parameter with the
+// given name, such as "share_id", from the current
+// request context in the same way as readIDParam().
+// A METHOD on the APPLICATION struct.
+func (app *application) readNamedIDParam(r *http.Request, name string) (int64, error) {
 	// Get URL parameters from ParamsFromContext() function
 	// to get a slice containing all parameter names
 	// and values.
 	params := httprouter.ParamsFromContext(r.Context())
 
-	// Use ByName() method to get the value of "id"
+	// Use ByName() method to get the value of the
 	// parameter from the params slice.
 	//
 	// The value is always a string. Convert it to a base
 	// 10 integer (64 bits). If it can't be converted, or is
 	// less than 1, the ID is invalid.
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id parameter")
+		return 0, fmt.Errorf("invalid %s parameter", name)
 	}
 
 	// Return the ID and nil error
@@ -90,16 +102,30 @@ func (app *application) writeJSON(
 
 // readJSON helper function will decode the JSON from
 // the request body, then triage the errors and replace
-// them with custom messages.
+// them with custom messages. The request body is
+// limited to 1MB.
 // A METHOD on the APPLICATION struct.
 func (app *application) readJSON(
 	w http.ResponseWriter,
 	r *http.Request,
 	dst interface{},
+) error {
+	return app.readJSONLimit(w, r, dst, 1_048_576)
+}
+
+// readJSONLimit helper function decodes the JSON from
+// the request body in the same way as readJSON(), for
+// endpoints which accept bodies larger than 1MB, such
+// as bulk operations.
+// A METHOD on the APPLICATION struct.
+func (app *application) readJSONLimit(
+	w http.ResponseWriter,
+	r *http.Request,
+	dst interface{},
+	maxBytes int,
 ) error {
 	// Use http.MaxBytesReader() to limit the size of
-	// the request body to 1MB.
-	maxBytes := 1_048_576
+	// the request body to maxBytes.
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes))
 
 	// Initialize the json.Decoder, and call the
@@ -159,7 +185,7 @@ func (app *application) readJSON(
 			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field")
 			return fmt.Errorf("body contains unknown key %s", fieldName)
 
-		// If request body exceeds 1MB in size the decode
+		// If request body exceeds maxBytes in size the decode
 		// will fail with the error "http: request body
 		// to large".
 		case err.Error() == "http: request body too large":
@@ -271,6 +297,227 @@ func (app *application) readInt(
 	return i
 }
 
+// readBool helper function reads a boolean value from
+// the query string. If no key is found, return nil. If
+// the value cannot be converted to a boolean, record
+// an error message to the Validator instance.
+// A METHOD on the APPLICATION struct.
+func (app *application) readBool(
+	qs url.Values,
+	key string,
+	v *validator.Validator,
+) *bool {
+	// Extract the value of key
+	s := qs.Get(key)
+
+	// If no key exists, return nil.
+	if s == "" {
+		return nil
+	}
+
+	// Convert value to a boolean. If this fails, add
+	// an error message to validator instance.
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	// Return converted boolean value.
+	return &b
+}
+
+// readFloat helper function reads a number from the
+// query string. If no key is found, return default
+// value. If the value cannot be converted to a number,
+// record an error message to Validator instance.
+// A METHOD on the APPLICATION struct.
+func (app *application) readFloat(
+	qs url.Values,
+	key string,
+	defaultValue float64,
+	v *validator.Validator,
+) float64 {
+	// Extract the value of key
+	s := qs.Get(key)
+
+	// If no key exists, return the default value.
+	if s == "" {
+		return defaultValue
+	}
+
+	// Convert value to a number. If this fails, or the
+	// value is not finite, add an error message to
+	// validator instance and return default value.
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+
+	// Return converted number.
+	return f
+}
+
+// readPoint helper function reads a "latitude,longitude"
+// pair of coordinates from the query string. If no key
+// is found, return nil. If the value is not a pair of
+// numbers, record an error message to the Validator
+// instance.
+// A METHOD on the APPLICATION struct.
+func (app *application) readPoint(
+	qs url.Values,
+	key string,
+	v *validator.Validator,
+) *data.Point {
+	// Extract the value of key
+	s := qs.Get(key)
+
+	// If no key exists, return nil.
+	if s == "" {
+		return nil
+	}
+
+	// Split the value and convert both halves. If this
+	// fails, add an error message to validator instance.
+	lat, lng, ok := strings.Cut(s, ",")
+	latitude, errLat := strconv.ParseFloat(strings.TrimSpace(lat), 64)
+	longitude, errLng := strconv.ParseFloat(strings.TrimSpace(lng), 64)
+	if !ok || errLat != nil || errLng != nil {
+		v.AddError(key, "must be a latitude and longitude separated by a comma")
+		return nil
+	}
+
+	// Return the converted point.
+	return &data.Point{Latitude: latitude, Longitude: longitude}
+}
+
+// readTime helper function reads a date or date and
+// time value from the query string. If no key is
+// found, return the zero time. If the value cannot be
+// parsed, record an error message to the Validator
+// instance.
+// A METHOD on the APPLICATION struct.
+func (app *application) readTime(
+	qs url.Values,
+	key string,
+	v *validator.Validator,
+) time.Time {
+	// Extract the value of key
+	s := qs.Get(key)
+
+	// If no key exists, return the zero time.
+	if s == "" {
+		return time.Time{}
+	}
+
+	// Parse the value. If this fails, add an error
+	// message to validator instance.
+	t, err := internal.ParseTimeString(s)
+	if err != nil {
+		v.AddError(key, "must be a valid date or date and time")
+		return time.Time{}
+	}
+
+	// Return parsed time value.
+	return t
+}
+
+// readTimeZone helper function reads the time zone a
+// client wants times converted to, from the "tz" query
+// string value or else the Accept-Timezone header. If
+// neither is set, return nil. If the time zone is not
+// in the tz database, record an error message to the
+// Validator instance.
+// A METHOD on the APPLICATION struct.
+func (app *application) readTimeZone(
+	r *http.Request,
+	v *validator.Validator,
+) *time.Location {
+	// Extract the time zone, preferring the query
+	// string over the header.
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		name = r.Header.Get("Accept-Timezone")
+	}
+
+	// If no time zone was requested, return nil.
+	if name == "" {
+		return nil
+	}
+
+	// Load the time zone. If this fails, add an error
+	// message to validator instance.
+	loc, err := internal.LoadTimeZone(name)
+	if err != nil {
+		v.AddError("tz", "must be a valid IANA time zone")
+		return nil
+	}
+
+	// Return the loaded time zone.
+	return loc
+}
+
+// eventOwner returns the owner ID that event queries
+// for a request are scoped to. This is the ID of the
+// authenticated user, or 0 if the user has the
+// "events:admin" permission, which allows access to
+// the events of every user.
+// A METHOD on the APPLICATION struct.
+func (app *application) eventOwner(r *http.Request) (int64, error) {
+	// Retrieve the user from the request context
+	user := app.contextGetUser(r)
+
+	// Get the slice of permissions for the user
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		return 0, err
+	}
+
+	// Admins are not restricted to their own events.
+	if permissions.Include("events:admin") {
+		return 0, nil
+	}
+	return user.ID, nil
+}
+
+// resourceRole returns the role the authenticated user
+// has on a calendar, or on an event in it, given the ID
+// of the resource's owner and of the calendar. Owners
+// and admins have the data.RoleOwner role. Other users
+// have the role the calendar is shared with them, or ""
+// if it is not shared with them.
+// A METHOD on the APPLICATION struct.
+func (app *application) resourceRole(r *http.Request, ownerID, calendarID int64) (string, error) {
+	user := app.contextGetUser(r)
+	if user.ID == ownerID {
+		return data.RoleOwner, nil
+	}
+
+	owner, err := app.eventOwner(r)
+	if err != nil {
+		return "", err
+	}
+	if owner == 0 {
+		return data.RoleOwner, nil
+	}
+
+	if calendarID == 0 {
+		return "", nil
+	}
+	return app.models.Shares.Role(calendarID, user.ID)
+}
+
+// eventStartText returns the start of an event as it
+// is written in emails, in the event's time zone. All
+// day events are written without a time.
+func eventStartText(event *data.Event) string {
+	if event.AllDay {
+		return event.Start.Format("Monday, 2 January 2006")
+	}
+	return event.Start.In(event.Location()).Format("Monday, 2 January 2006 at 15:04 MST")
+}
+
 // background is a helper function that wraps
 // panic recovery logic. The function accepts
 // an arbitrary function as a parameter.
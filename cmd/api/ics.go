@@ -0,0 +1,650 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/ical"
+	"github.com/robwestbrook/greenlight/internal/rrule"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for iCalendar import and export
+*/
+
+// icsProductID identifies the app in the PRODID
+// property of exported calendars.
+const icsProductID = "-//Greenlight//Events API//EN"
+
+// maxImportBytes limits the size of an imported
+// calendar to 10MB.
+const maxImportBytes = 10 * 1_048_576
+
+// importItem reports the outcome of importing a
+// single VEVENT. Status is one of "created",
+// "updated", "skipped" or "failed".
+type importItem struct {
+	UID    string            `json:"uid,omitempty"`
+	ID     int64             `json:"id,omitempty"`
+	Status string            `json:"status"`
+	Reason string            `json:"reason,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// exportEventsHandler returns the events matching the
+// same filters as listEventsHandler as an iCalendar
+// (text/calendar) stream. If no page is requested,
+// every matching event is returned, since calendar
+// clients expect the whole feed in one response.
+// A METHOD on the APPLICATION struct.
+func (app *application) exportEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Read and validate the query string values.
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input := app.readEventListInput(qs, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Scope the feed to the user's own events, unless
+	// the user is an admin.
+	owner, err := app.eventOwner(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// The feed carries whole events, so a sparse
+	// fieldset is ignored.
+	input.Filters.Fields = nil
+
+	// Fetch the requested page, or walk through every
+	// page with cursors if no page was requested.
+	paged := qs.Get("page") != "" || input.Filters.After != "" || input.Filters.Before != ""
+	if !paged {
+		input.Filters.Count = false
+	}
+
+	var events []*data.Event
+	for {
+		page, metadata, err := app.models.Events.GetAll(
+			owner,
+			input.Title,
+			input.Description,
+			input.Tags,
+			input.Filters,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrInvalidSearch):
+				v.AddError("q", "must be a valid search query")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		events = append(events, page...)
+
+		if paged || metadata.NextCursor == "" {
+			break
+		}
+		input.Filters.After = metadata.NextCursor
+	}
+
+	// A windowed list contains expanded occurrences.
+	// The feed carries each recurring event once,
+	// with its RRULE, so replace occurrences with the
+	// event they belong to.
+	events, err = app.collapseOccurrences(events)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Build the VCALENDAR component.
+	calendar := ical.NewComponent("VCALENDAR")
+	calendar.Add("VERSION", "2.0")
+	calendar.Add("PRODID", icsProductID)
+	calendar.Add("CALSCALE", "GREGORIAN")
+	calendar.Add("METHOD", "PUBLISH")
+	calendar.Add("X-WR-CALNAME", "Greenlight")
+
+	// Timed events outside UTC are written in their
+	// own time zone, so that clients repeat them at
+	// the same wall clock time across daylight saving
+	// changes. Each time zone used needs a VTIMEZONE,
+	// starting in the year of its earliest event.
+	firstYears := make(map[string]int)
+	var locations []*time.Location
+	for _, event := range events {
+		loc := event.Location()
+		if event.AllDay || loc == time.UTC {
+			continue
+		}
+		year := event.Start.In(loc).Year()
+		first, ok := firstYears[loc.String()]
+		if !ok {
+			locations = append(locations, loc)
+		}
+		if !ok || year < first {
+			firstYears[loc.String()] = year
+		}
+	}
+	for _, loc := range locations {
+		calendar.AddComponent(ical.Timezone(loc, firstYears[loc.String()]))
+	}
+
+	for _, event := range events {
+		calendar.AddComponent(eventToVEvent(event))
+	}
+
+	// Write the calendar with a text/calendar
+	// content type.
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="events.ics"`)
+	w.WriteHeader(http.StatusOK)
+
+	err = calendar.Encode(w)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// importEventsHandler creates events from the VEVENTs
+// of an iCalendar (text/calendar) request body. Events
+// are written in a single transaction. A VEVENT whose
+// UID matches an existing event in the calendar
+// updates that event, so re-importing a calendar does
+// not duplicate it. A VEVENT whose UID matches an
+// event of the calendar's owner in the trash, or in
+// another calendar, fails. Events are imported into the calendar in the
+// "calendar_id" query string parameter, or the user's
+// default calendar.
+// The response reports the outcome of every VEVENT.
+// A METHOD on the APPLICATION struct.
+func (app *application) importEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Only accept iCalendar request bodies.
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "text/calendar" {
+		app.unsupportedMediaTypeResponse(w, r, "text/calendar")
+		return
+	}
+
+	// Find the calendar to import into. The
+	// authenticated user must be able to edit it.
+	v := validator.New()
+	calendarID := app.readInt(r.URL.Query(), "calendar_id", 0, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+	target, err := app.eventCalendar(r, int64(calendarID), v)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Use http.MaxBytesReader() to limit the size of
+	// the request body, then decode the calendar.
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	calendar, err := ical.Decode(r.Body)
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			err = fmt.Errorf("body must not be larger than %d bytes", maxImportBytes)
+		}
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if calendar.Name != "VCALENDAR" {
+		app.badRequestResponse(w, r, errors.New("body must contain a VCALENDAR"))
+		return
+	}
+
+	// Convert and validate each VEVENT, reading its
+	// times in the time zones the calendar defines. Only
+	// the valid events are passed on to be written,
+	// remembering their position in the items slice.
+	zones := ical.CalendarZones(calendar)
+	vevents := calendar.Children("VEVENT")
+	items := make([]importItem, len(vevents))
+	events := []*data.Event{}
+	positions := []int{}
+	seen := make(map[string]bool)
+
+	for i, vevent := range vevents {
+		if uid, ok := vevent.Get("UID"); ok {
+			items[i].UID = uid.Value
+		}
+
+		if reason := importSkipReason(vevent, seen); reason != "" {
+			items[i].Status = "skipped"
+			items[i].Reason = reason
+			continue
+		}
+
+		event, err := veventToEvent(vevent, zones)
+		if err != nil {
+			items[i].Status = "failed"
+			items[i].Reason = err.Error()
+			continue
+		}
+
+		v := validator.New()
+		if data.ValidateEvent(v, event); !v.Valid() {
+			items[i].Status = "failed"
+			items[i].Errors = v.Errors
+			continue
+		}
+
+		// Imported events are owned by the owner of the
+		// calendar, and only replace that user's events.
+		event.UserID = target.UserID
+		event.CalendarID = target.ID
+		event.UpdatedBy = app.contextGetUser(r).ID
+
+		seen[event.UID] = true
+		events = append(events, event)
+		positions = append(positions, i)
+	}
+
+	// Write the valid events in a single transaction.
+	imports := make([]*data.ImportedEvent, len(events))
+	for i, event := range events {
+		imports[i] = &data.ImportedEvent{Event: event}
+	}
+	err = app.models.Events.Import(imports)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Report each event, and send the events written to
+	// webhooks and event streams.
+	for i, imported := range imports {
+		item := &items[positions[i]]
+		switch {
+		case imported.Err != nil:
+			item.Status = "failed"
+			item.Reason = imported.Err.Error()
+			continue
+		case imported.Created:
+			item.Status = "created"
+			app.publishEventChange(data.EventCreated, imported.Event)
+		default:
+			item.Status = "updated"
+			app.publishEventChange(data.EventUpdated, imported.Event)
+		}
+		item.ID = imported.Event.ID
+	}
+
+	// Count the outcomes.
+	counts := map[string]int{"created": 0, "updated": 0, "skipped": 0, "failed": 0}
+	for _, item := range items {
+		counts[item.Status]++
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"import": envelope{
+			"created": counts["created"],
+			"updated": counts["updated"],
+			"skipped": counts["skipped"],
+			"failed":  counts["failed"],
+			"items":   items,
+		}},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// importSkipReason returns the reason a VEVENT is
+// skipped by the import, or the empty string if it
+// should be imported.
+func importSkipReason(vevent *ical.Component, seen map[string]bool) string {
+	if _, ok := vevent.Get("RECURRENCE-ID"); ok {
+		return "changes to single occurrences of a recurring event are not supported"
+	}
+	if status, ok := vevent.Get("STATUS"); ok && strings.EqualFold(status.Value, "CANCELLED") {
+		return "event is cancelled"
+	}
+	if uid, ok := vevent.Get("UID"); ok && seen[uid.Value] {
+		return "duplicate UID in calendar"
+	}
+	return ""
+}
+
+// veventToEvent converts a VEVENT component into an
+// event. It is the reverse of eventToVEvent(): DATE
+// values make an all day event, and the exclusive
+// DTEND of an all day event is moved back a day.
+// Times with a TZID are converted to UTC, and the TZID
+// of DTSTART, resolved to an IANA time zone by zones,
+// becomes the event's time zone.
+func veventToEvent(vevent *ical.Component, zones ical.Zones) (*data.Event, error) {
+	event := &data.Event{}
+
+	uid, ok := vevent.Get("UID")
+	if !ok || uid.Value == "" {
+		return nil, errors.New("UID must be provided")
+	}
+	event.UID = uid.Value
+
+	if p, ok := vevent.Get("SUMMARY"); ok {
+		event.Title = ical.UnescapeText(p.Value)
+	}
+	if p, ok := vevent.Get("DESCRIPTION"); ok {
+		event.Description = ical.UnescapeText(p.Value)
+	}
+	// The LOCATION text becomes the name of the place,
+	// and GEO its coordinates.
+	if p, ok := vevent.Get("LOCATION"); ok && p.Value != "" {
+		event.Place = &data.Place{Name: ical.UnescapeText(p.Value)}
+	}
+	if p, ok := vevent.Get("GEO"); ok {
+		lat, lng, found := strings.Cut(p.Value, ";")
+		latitude, errLat := strconv.ParseFloat(lat, 64)
+		longitude, errLng := strconv.ParseFloat(lng, 64)
+		if !found || errLat != nil || errLng != nil {
+			return nil, errors.New("GEO must be a latitude and longitude separated by a semicolon")
+		}
+		if event.Place == nil {
+			event.Place = &data.Place{}
+		}
+		event.Place.Latitude, event.Place.Longitude = &latitude, &longitude
+	}
+
+	// Tags must be unique, so categories repeated across
+	// CATEGORIES properties are only added once.
+	seen := make(map[string]bool)
+	for _, p := range vevent.GetAll("CATEGORIES") {
+		for _, tag := range ical.SplitText(p.Value) {
+			if !seen[tag] {
+				seen[tag] = true
+				event.Tags = append(event.Tags, tag)
+			}
+		}
+	}
+
+	// Read the start, and the end from either DTEND or
+	// DURATION.
+	dtstart, ok := vevent.Get("DTSTART")
+	if !ok {
+		return nil, errors.New("DTSTART must be provided")
+	}
+	start, isDate, err := ical.ParseTime(dtstart, zones)
+	if err != nil {
+		return nil, err
+	}
+	event.Start = start.UTC()
+	event.AllDay = isDate
+
+	// Keep the time zone of the start, so the event
+	// repeats in it. Floating and UTC times are in UTC.
+	event.TimeZone = "UTC"
+	if tzid := dtstart.Param("TZID"); tzid != "" && !isDate {
+		loc, err := zones.Location(tzid)
+		if err != nil {
+			return nil, err
+		}
+		event.TimeZone = loc.String()
+	}
+
+	var end time.Time
+	if p, ok := vevent.Get("DTEND"); ok {
+		end, _, err = ical.ParseTime(p, zones)
+		if err != nil {
+			return nil, err
+		}
+	} else if p, ok := vevent.Get("DURATION"); ok {
+		d, err := ical.ParseDuration(p.Value)
+		if err != nil {
+			return nil, err
+		}
+		end = start.Add(d)
+	}
+	if !end.IsZero() {
+		if isDate {
+			end = end.AddDate(0, 0, -1)
+		}
+		event.End = end.UTC()
+	}
+
+	// Read the recurrence rule and excluded dates.
+	if p, ok := vevent.Get("RRULE"); ok {
+		event.RRule = p.Value
+	}
+	for _, p := range vevent.GetAll("EXDATE") {
+		exdates, _, err := ical.ParseTimes(p, zones)
+		if err != nil {
+			return nil, err
+		}
+		for _, exdate := range exdates {
+			event.ExDates = append(event.ExDates, exdate.UTC())
+		}
+	}
+
+	return event, nil
+}
+
+// collapseOccurrences replaces the expanded
+// occurrences of recurring events with the events
+// they belong to, keeping the first position of each.
+// The occurrences have already been scoped to an owner,
+// so their events are fetched without one.
+// A METHOD on the APPLICATION struct.
+func (app *application) collapseOccurrences(events []*data.Event) ([]*data.Event, error) {
+	seen := make(map[int64]bool)
+	collapsed := []*data.Event{}
+
+	for _, event := range events {
+		if seen[event.ID] {
+			continue
+		}
+		seen[event.ID] = true
+
+		if event.ParentID != 0 {
+			parent, err := app.models.Events.Get(event.ParentID, 0)
+			if err != nil {
+				return nil, err
+			}
+			event = parent
+		}
+		collapsed = append(collapsed, event)
+	}
+
+	return collapsed, nil
+}
+
+// eventToVEvent converts an event into a VEVENT
+// component. Properties:
+//  1. UID: unique and stable identifier
+//  2. DTSTAMP/LAST-MODIFIED: event updated_at
+//  3. CREATED: event created_at
+//  4. SEQUENCE: event version
+//  5. SUMMARY: event title
+//  6. DESCRIPTION: event description
+//  7. CATEGORIES: event tags
+//  8. LOCATION/GEO: name and address of the event's
+//     place, and its coordinates
+//  9. DTSTART/DTEND: DATE values for all day events,
+//     and the event's TZID for other events outside UTC
+//  10. RRULE/EXDATE: recurrence rule and exceptions
+func eventToVEvent(event *data.Event) *ical.Component {
+	vevent := ical.NewComponent("VEVENT")
+
+	vevent.Add("UID", event.UID)
+	vevent.Add("DTSTAMP", ical.FormatDateTime(event.UpdatedAt))
+	vevent.Add("CREATED", ical.FormatDateTime(event.CreatedAt))
+	vevent.Add("LAST-MODIFIED", ical.FormatDateTime(event.UpdatedAt))
+	vevent.Add("SEQUENCE", strconv.Itoa(int(event.Version)))
+	vevent.Add("SUMMARY", ical.EscapeText(event.Title))
+
+	if event.Description != "" {
+		vevent.Add("DESCRIPTION", ical.EscapeText(event.Description))
+	}
+
+	if len(event.Tags) > 0 {
+		categories := make([]string, len(event.Tags))
+		for i, tag := range event.Tags {
+			categories[i] = ical.EscapeText(tag)
+		}
+		vevent.Add("CATEGORIES", strings.Join(categories, ","))
+	}
+
+	if place := event.Place; place != nil {
+		var location []string
+		for _, s := range []string{place.Name, place.Address} {
+			if s != "" {
+				location = append(location, s)
+			}
+		}
+		if len(location) > 0 {
+			vevent.Add("LOCATION", ical.EscapeText(strings.Join(location, ", ")))
+		}
+		if place.Latitude != nil && place.Longitude != nil {
+			geo := strconv.FormatFloat(*place.Latitude, 'f', -1, 64) + ";" + strconv.FormatFloat(*place.Longitude, 'f', -1, 64)
+			vevent.Add("GEO", geo)
+		}
+	}
+
+	// All day events use DATE values. The DTEND of an
+	// all day event is exclusive, so it is the day
+	// after the last day of the event.
+	if event.AllDay {
+		dateValue := ical.Param{Name: "VALUE", Value: "DATE"}
+
+		end := event.Start
+		if event.End.After(event.Start) {
+			end = event.End
+		}
+
+		vevent.Add("DTSTART", ical.FormatDate(event.Start), dateValue)
+		vevent.Add("DTEND", ical.FormatDate(end.AddDate(0, 0, 1)), dateValue)
+	} else {
+		tzid := eventTZID(event)
+		vevent.Add("DTSTART", formatEventTime(event, event.Start), tzid...)
+		if event.End.After(event.Start) {
+			vevent.Add("DTEND", formatEventTime(event, event.End), tzid...)
+		}
+	}
+
+	// Write the recurrence rule in its canonical form,
+	// followed by any excluded occurrences.
+	if event.RRule != "" {
+		rule, err := rrule.Parse(event.RRule)
+		if err == nil {
+			vevent.Add("RRULE", rule.String())
+		}
+
+		for _, exdate := range event.ExDates {
+			if event.AllDay {
+				vevent.Add("EXDATE", ical.FormatDate(exdate), ical.Param{Name: "VALUE", Value: "DATE"})
+			} else {
+				vevent.Add("EXDATE", formatEventTime(event, exdate), eventTZID(event)...)
+			}
+		}
+	}
+
+	return vevent
+}
+
+// eventTZID returns the TZID parameter for the times
+// of a timed event outside UTC, or no parameters for an
+// event in UTC.
+func eventTZID(event *data.Event) []ical.Param {
+	loc := event.Location()
+	if loc == time.UTC {
+		return nil
+	}
+	return []ical.Param{{Name: "TZID", Value: loc.String()}}
+}
+
+// formatEventTime formats a time of a timed event as
+// a DATE-TIME value, in the event's time zone if it is
+// not UTC, to match eventTZID().
+func formatEventTime(event *data.Event, t time.Time) string {
+	loc := event.Location()
+	if loc == time.UTC {
+		return ical.FormatDateTime(t)
+	}
+	return ical.FormatLocalDateTime(t.In(loc))
+}
+
+// createFeedTokenHandler creates a read-only feed
+// token for the authenticated user. Calendar clients
+// which cannot send an Authorization header use it in
+// the "token" query string parameter of the feed URL.
+// A feed token is only accepted by the feed endpoint.
+// A METHOD on the APPLICATION struct.
+func (app *application) createFeedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	// Generate a new token with a 1 year expiry time
+	// and scope "feed".
+	token, err := app.models.Tokens.New(
+		user.ID,
+		365*24*time.Hour,
+		data.ScopeFeed,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Send the token and the feed URL in the response
+	// along with a 201 Created status code.
+	err = app.writeJSON(
+		w,
+		http.StatusCreated,
+		envelope{
+			"feed_token": token,
+			"feed_url":   "/v1/events.ics?token=" + token.Plaintext,
+		},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteFeedTokensHandler revokes all feed tokens for
+// the authenticated user.
+// A METHOD on the APPLICATION struct.
+func (app *application) deleteFeedTokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeFeed, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "feed tokens successfully revoked"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -4,11 +4,13 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"expvar"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"os"
 	"runtime"
 	"strconv"
@@ -16,11 +18,16 @@ import (
 	"sync"
 	"time"
 
+	// Embed the tz database, so event time zones can
+	// be loaded on hosts without one installed.
+	_ "time/tzdata"
+
 	"github.com/joho/godotenv"
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/robwestbrook/greenlight/internal/data"
 	"github.com/robwestbrook/greenlight/internal/jsonlog"
 	"github.com/robwestbrook/greenlight/internal/mailer"
+	"github.com/robwestbrook/greenlight/internal/pubsub"
+	"github.com/robwestbrook/greenlight/internal/storage"
 )
 
 // Declare a string containing the app version.
@@ -55,6 +62,19 @@ var buildTime string
 //     e.	sender - sender info used on host
 //  6. CORS - CORS config settings
 //     a.	trustedOrigins - slice containing trusted origins
+//  7. events - events config settings
+//     a.	owner - email of the user given events without an owner
+//  8. baseURL - URL the API is served at, used for links in emails
+//  9. reminders - event reminder config settings
+//     a.	interval - time between checks for due reminders
+//  10. trash - events trash config settings
+//     a.	retention - time deleted events are kept in the trash
+//  11. attachments - event attachments config settings
+//     a.	dir - directory the attached files are stored in
+//     b.	maxSize - largest file that can be attached, in bytes
+//  12. webhooks - webhook delivery config settings
+//     a.	interval - time between checks for due deliveries
+//     b.	allowedNetworks - private networks webhooks may be sent to
 type config struct {
 	port int
 	env  string
@@ -79,6 +99,24 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	events struct {
+		owner string
+	}
+	baseURL   string
+	reminders struct {
+		interval time.Duration
+	}
+	trash struct {
+		retention time.Duration
+	}
+	attachments struct {
+		dir     string
+		maxSize int64
+	}
+	webhooks struct {
+		interval        time.Duration
+		allowedNetworks []netip.Prefix
+	}
 }
 
 // Define an app struct to hold dependencies.
@@ -87,13 +125,22 @@ type config struct {
 //  2. logger - System logger
 //  3. models - the models struct
 //  4. mailer - the mailer struct
-//  5. wg - wait group for goroutine monitoring
+//  5. storage - where attached files are stored
+//  6. broker - publishes event changes to event streams
+//  7. webhookClient - sends webhook deliveries
+//  8. blobs - stops orphaned blobs being removed while
+//     files are being stored
+//  9. wg - wait group for goroutine monitoring
 type application struct {
-	config config
-	logger *jsonlog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config        config
+	logger        *jsonlog.Logger
+	models        data.Models
+	mailer        mailer.Mailer
+	storage       storage.Storage
+	broker        *pubsub.Broker
+	webhookClient *http.Client
+	blobs         sync.RWMutex
+	wg            sync.WaitGroup
 }
 
 // main function - The entry point for the app.
@@ -132,7 +179,15 @@ func main() {
 	// 13.	SMTP password (default: .env password)
 	// 14.	SMTP sender (default: .env sender)
 	// 15.	CORS trusted origins (default: empty []string slice)
-	// 16.	Display application version (default: false)
+	// 16.	Owner of events without an owner (default: none)
+	// 17.	Base URL for links in emails (default: http://localhost:4000)
+	// 18.	Reminder check interval, 0 to disable (default: 1 minute)
+	// 19.	Trash retention period, 0 to keep forever (default: 30 days)
+	// 20.	Attachments directory (default: attachments)
+	// 21.	Attachment max size in bytes (default: 10MB)
+	// 22.	Webhook delivery interval, 0 to disable (default: 5 seconds)
+	// 23.	Private networks webhooks may be sent to (default: none)
+	// 24.	Display application version (default: false)
 	flag.IntVar(&cfg.port, "port", 4000, "API server port")
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", "greenlight.db", "SQLite database name")
@@ -151,6 +206,23 @@ func main() {
 		cfg.cors.trustedOrigins = strings.Fields(val)
 		return nil
 	})
+	flag.StringVar(&cfg.events.owner, "events-owner", "", "Email of the user to assign events without an owner to")
+	flag.StringVar(&cfg.baseURL, "base-url", "http://localhost:4000", "Base URL of the API, used for links in emails")
+	flag.DurationVar(&cfg.reminders.interval, "reminders-interval", time.Minute, "Interval between checks for due event reminders (0 to disable)")
+	flag.DurationVar(&cfg.trash.retention, "trash-retention", 30*24*time.Hour, "Time deleted events are kept in the trash before being purged (0 to keep forever)")
+	flag.StringVar(&cfg.attachments.dir, "attachments-dir", "attachments", "Directory event attachments are stored in")
+	flag.Int64Var(&cfg.attachments.maxSize, "attachments-max-size", 10_485_760, "Largest file that can be attached to an event, in bytes")
+	flag.DurationVar(&cfg.webhooks.interval, "webhooks-interval", 5*time.Second, "Interval between checks for due webhook deliveries (0 to disable)")
+	flag.Func("webhooks-allowed-networks", "Private networks webhooks may be sent to, as CIDR blocks (space separated)", func(val string) error {
+		for _, field := range strings.Fields(val) {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return err
+			}
+			cfg.webhooks.allowedNetworks = append(cfg.webhooks.allowedNetworks, prefix.Masked())
+		}
+		return nil
+	})
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -184,6 +256,13 @@ func main() {
 	// Log message db is open
 	logger.PrintInfo("database connection pool established", nil)
 
+	// Open the local storage for attached files,
+	// creating its directory if needed.
+	store, err := storage.NewLocal(cfg.attachments.dir)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	// Set a new "version" variable in the expvar handler
 	// containing the application version number. This
 	// will be reflected in the "/v1/metrics" endpoint.
@@ -213,6 +292,9 @@ func main() {
 	//	2.	logger
 	//	3.	models - initialize a Models struct
 	//	4.	mailer - initialize a new Mailer instance
+	//	5.	storage - the local storage for attachments
+	//	6.	broker - initialize a new pub/sub Broker
+	//	7.	webhookClient - the client for webhook deliveries
 	app := &application{
 		config: cfg,
 		logger: logger,
@@ -224,6 +306,20 @@ func main() {
 			cfg.smtp.password,
 			cfg.smtp.sender,
 		),
+		storage:       store,
+		broker:        pubsub.New(streamReplaySize),
+		webhookClient: newWebhookClient(cfg.webhooks.allowedNetworks),
+	}
+
+	// Events created before events had owners are only
+	// visible to admins. If an owner is configured,
+	// assign those events, with their tags, to them.
+	// Once they have been assigned, this does nothing.
+	if cfg.events.owner != "" {
+		err = app.assignEventOwner(cfg.events.owner)
+		if err != nil {
+			logger.PrintFatal(err, nil)
+		}
 	}
 
 	// Declare a new servermux.
@@ -239,9 +335,38 @@ func main() {
 	}
 }
 
-// openDB() function returns an sql.DB connection pool
+// assignEventOwner assigns every event without an
+// owner to the user with the given email, in their
+// default calendar.
+// A METHOD on the APPLICATION struct.
+func (app *application) assignEventOwner(email string) error {
+	user, err := app.models.Users.GetByEmail(email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return fmt.Errorf("events owner %q does not exist", email)
+		}
+		return err
+	}
+
+	assigned, err := app.models.Events.AssignOwner(user.ID)
+	if err != nil {
+		return err
+	}
+
+	if assigned > 0 {
+		app.logger.PrintInfo("assigned events without an owner", map[string]string{
+			"owner":  email,
+			"events": strconv.FormatInt(assigned, 10),
+		})
+	}
+	return nil
+}
+
+// openDB() function returns an sql.DB connection pool.
+// It uses the SQLite driver registered by the data
+// package, which adds the SQL functions it needs.
 func openDB(cfg config) (*sql.DB, error) {
-	db, err := sql.Open("sqlite3", cfg.db.dsn)
+	db, err := sql.Open(data.DriverName, cfg.db.dsn)
 	if err != nil {
 		return nil, err
 	}
@@ -216,6 +216,51 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 	})
 }
 
+// authenticateFeed authenticates requests to the
+// iCalendar feed. Calendar clients often can't send an
+// Authorization header, so a feed token may be passed
+// in the "token" query string parameter instead. Feed
+// tokens are only accepted by this middleware, which
+// limits them to read-only feed access. Requests
+// without a token are passed on unchanged.
+func (app *application) authenticateFeed(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Retrieve the token from the query string. If
+		// there is none, call the next handler, leaving
+		// the user set by authenticate() in place.
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Validate the token format.
+		v := validator.New()
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationTokenResponse(w, r)
+			return
+		}
+
+		// Retrieve the User details associated with the
+		// feed token.
+		user, err := app.models.Users.GetForToken(data.ScopeFeed, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationTokenResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		// Add the user to the request context and call
+		// the next handler in the chain.
+		r = app.contextSetUser(r, user)
+		next.ServeHTTP(w, r)
+	})
+}
+
 // requireActivatedUser checks if a user is
 // authenticated and activated. It calls the
 // requireAuthenticatedUser before being executed
@@ -305,6 +350,156 @@ func (app *application) requirePermission(
 	return app.requireActivatedUser(fn)
 }
 
+// requireCalendarRole middleware checks that an
+// authenticated, activated user has at least the given
+// role on the calendar with the ID in the URL. Unlike
+// requirePermission(), which checks a global permission
+// code, the role comes from owning the calendar or from
+// a share of it. Users without any access get a 404 Not
+// Found response, so the calendar's existence is not
+// revealed, and users with too little access get a 403
+// Forbidden response. The calendar, with its Role set,
+// is added to the request context.
+func (app *application) requireCalendarRole(
+	role string,
+	next http.HandlerFunc,
+) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		calendar, err := app.models.Calendars.Get(id, 0)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		calendar.Role, err = app.resourceRole(r, calendar.UserID, calendar.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		switch {
+		case calendar.Role == "":
+			app.notFoundResponse(w, r)
+		case !data.RoleIncludes(calendar.Role, role):
+			app.notPermittedResponse(w, r)
+		default:
+			next.ServeHTTP(w, app.contextSetCalendar(r, calendar))
+		}
+	}
+
+	// Wrap this with the requireActivatedUser()
+	// middleware before returning.
+	return app.requireActivatedUser(fn)
+}
+
+// requireEventRole middleware checks that an
+// authenticated, activated user has at least the given
+// role on the event with the ID in the URL, which is
+// the role they have on the event's calendar. The
+// owner of the event always has the data.RoleOwner
+// role. Responses are sent as in requireCalendarRole(),
+// and the event is added to the request context.
+func (app *application) requireEventRole(
+	role string,
+	next http.HandlerFunc,
+) http.HandlerFunc {
+	get := func(id int64) (*data.Event, error) {
+		return app.models.Events.Get(id, 0)
+	}
+	return app.requireLoadedEventRole(role, get, next)
+}
+
+// requireEventFieldsRole middleware checks the user's
+// role on the event with the ID in the URL in the same
+// way as requireEventRole(), but only reads the fields
+// of the event in the sparse fieldset of the request's
+// "fields" query string value, with those needed to
+// check the role. Fields which are not valid are
+// ignored, so the handler must still validate them.
+func (app *application) requireEventFieldsRole(
+	role string,
+	next http.HandlerFunc,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fields := app.readCSV(r.URL.Query(), "fields", []string{})
+		get := func(id int64) (*data.Event, error) {
+			return app.models.Events.GetFields(id, fields)
+		}
+		app.requireLoadedEventRole(role, get, next).ServeHTTP(w, r)
+	}
+}
+
+// requireTrashedEventRole middleware works as
+// requireEventRole(), for an event in the trash.
+func (app *application) requireTrashedEventRole(
+	role string,
+	next http.HandlerFunc,
+) http.HandlerFunc {
+	return app.requireLoadedEventRole(role, app.models.Events.GetDeleted, next)
+}
+
+// requireLoadedEventRole middleware checks the user's
+// role on the event with the ID in the URL, as loaded
+// by get, for requireEventRole() and
+// requireTrashedEventRole().
+func (app *application) requireLoadedEventRole(
+	role string,
+	get func(id int64) (*data.Event, error),
+	next http.HandlerFunc,
+) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		id, err := app.readIDParam(r)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		event, err := get(id)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		eventRole, err := app.resourceRole(r, event.UserID, event.CalendarID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		// Users who may only see free/busy time can't
+		// read single events, so they are not told the
+		// event exists.
+		switch {
+		case !data.RoleIncludes(eventRole, data.RoleViewer):
+			app.notFoundResponse(w, r)
+		case !data.RoleIncludes(eventRole, role):
+			app.notPermittedResponse(w, r)
+		default:
+			next.ServeHTTP(w, app.contextSetEvent(r, event))
+		}
+	}
+
+	// Wrap this with the requireActivatedUser()
+	// middleware before returning.
+	return app.requireActivatedUser(fn)
+}
+
 // enableCORS method
 func (app *application) enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -330,6 +525,9 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 					// "Access-Control-Allow-Origin" response
 					// header with the request origin as the value.
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					// Let the client read the ETag header,
+					// to make conditional requests.
+					w.Header().Set("Access-Control-Expose-Headers", "ETag")
 					// Check if the request has the HTTP method OPTIONS
 					// and contains "Access-Control-Request-Method"
 					// header. If it is, treat as a preflight request.
@@ -342,7 +540,7 @@ func (app *application) enableCORS(next http.Handler) http.Handler {
 						)
 						w.Header().Set(
 							"Access-Control-Allow-Headers",
-							"Authorization, Content-Type",
+							"Authorization, Content-Type, If-Match, If-None-Match",
 						)
 						// Write the headers along with a 200 OK
 						// status and return from middleware with
@@ -377,11 +575,17 @@ func (app *application) metrics(next http.Handler) http.Handler {
 		// requests recieved by 1.
 		totalRequestsRecieved.Add(1)
 
-		// Call the httpsnoop.CaptureMetrics function,
-		// passing in the next handler in the chain along
-		// with the expisting http.ResponseWriter and
-		// http.Request. This returns a metric struct.
-		metrics := httpsnoop.CaptureMetrics(next, w, r)
+		// Call the httpsnoop.CaptureMetricsFn function,
+		// passing in the existing http.ResponseWriter and
+		// a function calling the next handler in the chain.
+		// This returns a metric struct. The wrapped
+		// http.ResponseWriter is passed on in a
+		// metricsResponseWriter, so handlers can still
+		// flush and set deadlines with an
+		// http.ResponseController.
+		metrics := httpsnoop.CaptureMetricsFn(w, func(ww http.ResponseWriter) {
+			next.ServeHTTP(&metricsResponseWriter{ResponseWriter: ww, original: w}, r)
+		})
 
 		// On the way back up the middleware chain, increment
 		// the number of responses sent by one.
@@ -400,3 +604,17 @@ func (app *application) metrics(next http.Handler) http.Handler {
 		totalResponsesSentByStatus.Add(strconv.Itoa(metrics.Code), 1)
 	})
 }
+
+// metricsResponseWriter wraps the http.ResponseWriter
+// httpsnoop passes to handlers, which doesn't implement
+// Unwrap(). Unwrap() returns the http.ResponseWriter it
+// wraps, so an http.ResponseController can reach it.
+type metricsResponseWriter struct {
+	http.ResponseWriter
+	original http.ResponseWriter
+}
+
+// Unwrap returns the wrapped http.ResponseWriter.
+func (mw *metricsResponseWriter) Unwrap() http.ResponseWriter {
+	return mw.original
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+/*
+	Scheduler for Event Reminders
+*/
+
+// reminderLookback is how long after a reminder falls
+// due it is still sent, such as when the server was
+// stopped at the time. Older reminders are skipped.
+const reminderLookback = time.Hour
+
+// runReminders sends due event reminders every
+// reminders interval, until the context is cancelled.
+// It is run in a background goroutine by serve(), so
+// the shutdown waits for it to finish sending.
+// A METHOD on the APPLICATION struct.
+func (app *application) runReminders(ctx context.Context) {
+	ticker := time.NewTicker(app.config.reminders.interval)
+	defer ticker.Stop()
+
+	for {
+		app.sendDueReminders(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sendDueReminders emails the owners of events with
+// reminders which are due. Each reminder is claimed
+// before it is sent, so it is only sent once, and
+// released if it could not be sent, so it is tried
+// again on the next run.
+// A METHOD on the APPLICATION struct.
+func (app *application) sendDueReminders(ctx context.Context) {
+	reminders, err := app.models.Reminders.Due(time.Now(), reminderLookback)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	for _, reminder := range reminders {
+		// Stop sending if the server is shutting down.
+		if ctx.Err() != nil {
+			return
+		}
+
+		claimed, err := app.models.Reminders.Claim(reminder)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+
+		data := map[string]interface{}{
+			"eventID":    reminder.Event.ID,
+			"eventTitle": reminder.Event.Title,
+			"eventStart": eventStartText(reminder.Event),
+			"lead":       reminderLead(reminder.Minutes),
+			"name":       reminder.Name,
+		}
+
+		err = app.mailer.Send(reminder.Email, "event_reminder.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{
+				"event_id": strconv.FormatInt(reminder.Event.ID, 10),
+			})
+
+			err = app.models.Reminders.Release(reminder)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		}
+	}
+}
+
+// reminderLead returns how long before an event a
+// reminder is sent, as it is written in emails, such
+// as "in 15 minutes" or "in 1 day".
+func reminderLead(minutes int) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("in 1 %s", unit)
+		}
+		return fmt.Sprintf("in %d %ss", n, unit)
+	}
+
+	switch {
+	case minutes == 0:
+		return "now"
+	case minutes%(7*24*60) == 0:
+		return plural(minutes/(7*24*60), "week")
+	case minutes%(24*60) == 0:
+		return plural(minutes/(24*60), "day")
+	case minutes%60 == 0:
+		return plural(minutes/60, "hour")
+	default:
+		return plural(minutes, "minute")
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for Event Revisions
+*/
+
+// listEventRevisionsHandler returns the prior versions
+// of an event, most recent first by default. The
+// current version is the event itself.
+// A METHOD on the APPLICATION struct.
+func (app *application) listEventRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	// Read the page, page_size and sort query string
+	// values, and the time zone requested for the
+	// response. Defaults:
+	//	1.	page: 1
+	//	2.	page_size: 20
+	//	3.	sort: -version
+	v := validator.New()
+	qs := r.URL.Query()
+	loc := app.readTimeZone(r, v)
+
+	var filters data.Filters
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "-version")
+	filters.SortSafelist = []string{"version", "-version"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := app.models.Revisions.GetAll(event.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for i, revision := range revisions {
+		revisions[i] = revision.In(loc)
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"revisions": revisions, "metadata": metadata},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showEventRevisionHandler returns one version of an
+// event, which may be the current version.
+// A METHOD on the APPLICATION struct.
+func (app *application) showEventRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	v := validator.New()
+	loc := app.readTimeZone(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	version, err := app.readNamedIDParam(r, "version")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	revision, err := app.eventVersion(event, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"revision": revision.In(loc)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// diffEventRevisionsHandler returns the fields which
+// changed between two versions of an event, given by
+// the from and to query string values. By default, the
+// current version is compared with the one before it.
+// A METHOD on the APPLICATION struct.
+func (app *application) diffEventRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	v := validator.New()
+	qs := r.URL.Query()
+	loc := app.readTimeZone(r, v)
+
+	to := app.readInt(qs, "to", int(event.Version), v)
+	from := app.readInt(qs, "from", to-1, v)
+
+	v.Check(from >= 1 && from <= int(event.Version), "from", "must be a version of the event")
+	v.Check(to >= 1 && to <= int(event.Version), "to", "must be a version of the event")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var versions [2]*data.Event
+	for i, version := range []int{from, to} {
+		revision, err := app.eventVersion(event, int64(version))
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		versions[i] = revision.In(loc)
+	}
+
+	changes, err := data.DiffEvents(versions[0], versions[1])
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"from": from, "to": to, "changes": changes},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revertEventHandler restores the details of an older
+// version of an event, saving them as a new version.
+// The update is checked against the version the event
+// was read at, like any other update. The event is
+// moved back to its old calendar if the user can still
+// edit it.
+// A METHOD on the APPLICATION struct.
+func (app *application) revertEventHandler(w http.ResponseWriter, r *http.Request) {
+	event := app.contextGetEvent(r)
+
+	v := validator.New()
+	loc := app.readTimeZone(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	version, err := app.readNamedIDParam(r, "version")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+	if version >= int64(event.Version) {
+		v.AddError("version", "must be an earlier version of the event")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	revision, err := app.models.Revisions.Get(event.ID, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Move the event back to its old calendar. Events
+	// created before calendars were added had none, so
+	// they stay in their current calendar.
+	if revision.CalendarID != 0 && revision.CalendarID != event.CalendarID {
+		calendar, err := app.eventCalendar(r, revision.CalendarID, v)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if calendar != nil {
+			event.UserID = calendar.UserID
+			event.CalendarID = calendar.ID
+		}
+	}
+
+	event.Revert(revision)
+
+	if data.ValidateEvent(v, event); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	event.UpdatedBy = app.contextGetUser(r).ID
+	err = app.models.Events.Update(event, 0)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Add the replies of the event's attendees, and
+	// send the reverted event to webhooks and event
+	// streams.
+	err = app.addRSVPSummaries(event)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	app.publishEventChange(data.EventUpdated, event)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"event": event.In(loc)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// eventVersion returns a version of an event: the
+// event itself for its current version, or else the
+// prior version from its revisions.
+// A METHOD on the APPLICATION struct.
+func (app *application) eventVersion(event *data.Event, version int64) (*data.Event, error) {
+	if version == int64(event.Version) {
+		return event, nil
+	}
+	if version > math.MaxInt32 {
+		return nil, data.ErrRecordNotFound
+	}
+	return app.models.Revisions.Get(event.ID, int32(version))
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	"github.com/robwestbrook/greenlight/internal/data"
 )
 
 // routes Function sets up the router for the app.
@@ -57,6 +58,22 @@ func (app *application) routes() http.Handler {
 		"/v1/events",
 		app.requirePermission("events:read", app.listEventsHandler),
 	)
+	// GET iCalendar feed of events route
+	// Pattern					|		Handler						|		Action
+	//----------------------------------------------------
+	// /v1/events.ics		|	exportEventsHandler	| export events
+	//									|											| as iCalendar
+	// Use the authenticateFeed() middleware so calendar
+	// clients can authenticate with a feed token, then
+	// the requirePermission() middleware.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/events.ics",
+		app.authenticateFeed(
+			app.requirePermission("events:read", app.exportEventsHandler),
+		),
+	)
+
 	// POST create Event route
 	// Pattern					|		Handler						|		Action
 	//----------------------------------------------------
@@ -69,16 +86,58 @@ func (app *application) routes() http.Handler {
 		app.requirePermission("events:write", app.createEventHandler),
 	)
 
-	// GET get Event by ID route
-	// Pattern					|		Handler						|		Action
+	// POST import and bulk Events routes
+	// Pattern							|		Handler							|		Action
 	//----------------------------------------------------
-	// /v1/events	/:id	|	showEventHandler		| show event
-	//									|											| details
-	// Use the requirePermission() middleware
+	// /v1/events/import	|	importEventsHandler	| import events
+	//										|											| from iCalendar
+	// /v1/events/bulk		|	bulkEventsHandler		| create, update
+	//										|											| and delete events
+	// Use the requirePermission() middleware. The routes
+	// are registered on the :id wildcard, since httprouter
+	// does not allow the static paths next to the
+	// /v1/events/:id/attendees routes, and matchParam()
+	// sends other IDs to a 404 Not Found response.
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/events/:id",
+		app.matchParam(
+			"id",
+			"import",
+			app.requirePermission("events:write", app.importEventsHandler),
+			app.matchParam(
+				"id",
+				"bulk",
+				app.requirePermission("events:write", app.bulkEventsHandler),
+				app.notFoundResponse,
+			),
+		),
+	)
+
+	// GET get Event by ID and stream Events routes
+	// Pattern							|		Handler							|		Action
+	//----------------------------------------------------
+	// /v1/events	/:id		|	showEventHandler		| show event
+	//										|											| details
+	// /v1/events/stream	|	streamEventsHandler	| stream event
+	//										|											| changes
+	// Use the requirePermission() middleware, then the
+	// requireEventFieldsRole() middleware to check the
+	// user can view the event, reading only the fields
+	// requested. The stream is registered on
+	// the :id wildcard, like the import and bulk routes.
 	router.HandlerFunc(
 		http.MethodGet,
 		"/v1/events/:id",
-		app.requirePermission("events:read", app.showEventHandler),
+		app.matchParam(
+			"id",
+			"stream",
+			app.requirePermission("events:read", app.streamEventsHandler),
+			app.requirePermission(
+				"events:read",
+				app.requireEventFieldsRole(data.RoleViewer, app.showEventHandler),
+			),
+		),
 	)
 
 	// PATCH update Event by ID route
@@ -86,11 +145,16 @@ func (app *application) routes() http.Handler {
 	//----------------------------------------------------
 	// /v1/events	/:id	|	updateEventHandler	| update event
 	//									|											| details
-	// Use the requirePermission() middleware
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can edit the event.
 	router.HandlerFunc(
 		http.MethodPatch,
 		"/v1/events/:id",
-		app.requirePermission("events:write", app.updateEventHandler),
+		app.requirePermission(
+			"events:write",
+			app.requireEventRole(data.RoleEditor, app.updateEventHandler),
+		),
 	)
 
 	// DELETE delete Event by ID
@@ -98,11 +162,552 @@ func (app *application) routes() http.Handler {
 	//----------------------------------------------------
 	// /v1/events/:id	|	deleteEventHandler	| delete event
 	//									|											| by ID
-	// Use the requirePermission() middleware
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can edit the event.
 	router.HandlerFunc(
 		http.MethodDelete,
 		"/v1/events/:id",
-		app.requirePermission("events:write", app.deleteEventHandler),
+		app.requirePermission(
+			"events:write",
+			app.requireEventRole(data.RoleEditor, app.deleteEventHandler),
+		),
+	)
+
+	// POST restore Event route
+	// Pattern									|		Handler							|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/restore	|	restoreEventHandler	| restore event
+	//													|											| from the trash
+	// Use the requirePermission() middleware, then the
+	// requireTrashedEventRole() middleware to check the
+	// user can edit the deleted event.
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/events/:id/restore",
+		app.requirePermission(
+			"events:write",
+			app.requireTrashedEventRole(data.RoleEditor, app.restoreEventHandler),
+		),
+	)
+
+	// GET list Event revisions route
+	// Pattern										|		Handler										|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/revisions	|	listEventRevisionsHandler	| retrieve list
+	//														|														| of prior versions
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can view the event.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/events/:id/revisions",
+		app.requirePermission(
+			"events:read",
+			app.requireEventRole(data.RoleViewer, app.listEventRevisionsHandler),
+		),
+	)
+
+	// GET get Event revision route
+	// Pattern															|		Handler										|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/revisions/:version	|	showEventRevisionHandler	| show version
+	//																		|														| of event
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can view the event.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/events/:id/revisions/:version",
+		app.requirePermission(
+			"events:read",
+			app.requireEventRole(data.RoleViewer, app.showEventRevisionHandler),
+		),
+	)
+
+	// GET diff Event revisions route
+	// Pattern								|		Handler										|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/diff	|	diffEventRevisionsHandler	| compare two
+	//												|														| versions of event
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can view the event.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/events/:id/diff",
+		app.requirePermission(
+			"events:read",
+			app.requireEventRole(data.RoleViewer, app.diffEventRevisionsHandler),
+		),
+	)
+
+	// POST revert Event route
+	// Pattern												|		Handler							|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/revert/:version	|	revertEventHandler	| restore an earlier
+	//																|											| version of event
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can edit the event.
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/events/:id/revert/:version",
+		app.requirePermission(
+			"events:write",
+			app.requireEventRole(data.RoleEditor, app.revertEventHandler),
+		),
+	)
+
+	// GET list trashed Events route
+	// Pattern							|		Handler										|		Action
+	//----------------------------------------------------
+	// /v1/trash/events			|	listTrashedEventsHandler	| retrieve list
+	//											|														| of deleted events
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/trash/events",
+		app.requirePermission("events:read", app.listTrashedEventsHandler),
+	)
+
+	// DELETE purge trashed Event route
+	// Pattern								|		Handler						|		Action
+	//----------------------------------------------------
+	// /v1/trash/events/:id	|	purgeEventHandler	| permanently delete
+	//												|										| event
+	// Use the requirePermission() middleware, then the
+	// requireTrashedEventRole() middleware to check the
+	// user can edit the deleted event.
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/trash/events/:id",
+		app.requirePermission(
+			"events:write",
+			app.requireTrashedEventRole(data.RoleEditor, app.purgeEventHandler),
+		),
+	)
+
+	// GET list Event attendees route
+	// Pattern										|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/attendees	|	listAttendeesHandler	| retrieve list
+	//														|												| of attendees
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can view the event.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/events/:id/attendees",
+		app.requirePermission(
+			"events:read",
+			app.requireEventRole(data.RoleViewer, app.listAttendeesHandler),
+		),
+	)
+
+	// POST invite Event attendee route
+	// Pattern										|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/attendees	|	createAttendeeHandler	| invite attendee
+	//														|												| by email
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can edit the event.
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/events/:id/attendees",
+		app.requirePermission(
+			"events:write",
+			app.requireEventRole(data.RoleEditor, app.createAttendeeHandler),
+		),
+	)
+
+	// PATCH update Event attendee route
+	// Pattern																|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/attendees/:attendee_id	|	updateAttendeeHandler	| update attendee
+	//																			|												| status
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can edit the event.
+	router.HandlerFunc(
+		http.MethodPatch,
+		"/v1/events/:id/attendees/:attendee_id",
+		app.requirePermission(
+			"events:write",
+			app.requireEventRole(data.RoleEditor, app.updateAttendeeHandler),
+		),
+	)
+
+	// DELETE remove Event attendee route
+	// Pattern																|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/attendees/:attendee_id	|	deleteAttendeeHandler	| remove attendee
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can edit the event.
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/events/:id/attendees/:attendee_id",
+		app.requirePermission(
+			"events:write",
+			app.requireEventRole(data.RoleEditor, app.deleteAttendeeHandler),
+		),
+	)
+
+	// GET list Event attachments route
+	// Pattern											|		Handler									|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/attachments	|	listAttachmentsHandler	| retrieve list
+	//															|													| of attachments
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can view the event.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/events/:id/attachments",
+		app.requirePermission(
+			"events:read",
+			app.requireEventRole(data.RoleViewer, app.listAttachmentsHandler),
+		),
+	)
+
+	// POST upload Event attachment route
+	// Pattern											|		Handler										|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/attachments	|	createAttachmentHandler	| attach a file
+	//															|														| to event
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can edit the event.
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/events/:id/attachments",
+		app.requirePermission(
+			"events:write",
+			app.requireEventRole(data.RoleEditor, app.createAttachmentHandler),
+		),
+	)
+
+	// GET download Event attachment route
+	// Pattern																		|		Handler									|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/attachments/:attachment_id	|	showAttachmentHandler		| download
+	//																						|													| attached file
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can view the event.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/events/:id/attachments/:attachment_id",
+		app.requirePermission(
+			"events:read",
+			app.requireEventRole(data.RoleViewer, app.showAttachmentHandler),
+		),
+	)
+
+	// DELETE remove Event attachment route
+	// Pattern																		|		Handler										|		Action
+	//----------------------------------------------------
+	// /v1/events/:id/attachments/:attachment_id	|	deleteAttachmentHandler	| remove file
+	// Use the requirePermission() middleware, then the
+	// requireEventRole() middleware to check the user
+	// can edit the event.
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/events/:id/attachments/:attachment_id",
+		app.requirePermission(
+			"events:write",
+			app.requireEventRole(data.RoleEditor, app.deleteAttachmentHandler),
+		),
+	)
+
+	// GET confirm a reply to an invitation route
+	// Pattern				|		Handler						|		Action
+	//----------------------------------------------------
+	// /v1/rsvp				|	showRSVPHandler		| show reply
+	//								|										| confirmation page
+	// Authenticated by the RSVP token in the query string.
+	// Following the link does not change the reply.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/rsvp",
+		app.showRSVPHandler,
+	)
+
+	// POST reply to an invitation route
+	// Pattern				|		Handler				|		Action
+	//----------------------------------------------------
+	// /v1/rsvp				|	rsvpHandler		| record attendee
+	//								|								| reply
+	// Authenticated by the RSVP token in the request body.
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/rsvp",
+		app.rsvpHandler,
+	)
+
+	// POST query free/busy times route
+	// Pattern				|		Handler						|		Action
+	//----------------------------------------------------
+	// /v1/freebusy		|	freeBusyHandler		| show when users
+	//								|										| are busy
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/freebusy",
+		app.requirePermission("events:read", app.freeBusyHandler),
+	)
+
+	// POST suggest meeting slots route
+	// Pattern										|		Handler							|		Action
+	//----------------------------------------------------
+	// /v1/scheduling/suggest		|	suggestSlotsHandler	| suggest times
+	//														|											| when everyone
+	//														|											| is free
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/scheduling/suggest",
+		app.requirePermission("events:read", app.suggestSlotsHandler),
+	)
+
+	// GET list tags route
+	// Pattern				|		Handler						|		Action
+	//----------------------------------------------------
+	// /v1/tags				|	listTagsHandler		| retrieve list
+	//								|										| of tags
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/tags",
+		app.requirePermission("events:read", app.listTagsHandler),
+	)
+
+	// PATCH rename or merge Tag route
+	// Pattern				|		Handler						|		Action
+	//----------------------------------------------------
+	// /v1/tags/:id		|	updateTagHandler	| rename tag, or
+	//								|										| merge it into
+	//								|										| another tag
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodPatch,
+		"/v1/tags/:id",
+		app.requirePermission("events:write", app.updateTagHandler),
+	)
+
+	// GET list calendars route
+	// Pattern							|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/calendars				|	listCalendarsHandler	| retrieve list
+	//											|												| of calendars
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/calendars",
+		app.requirePermission("events:read", app.listCalendarsHandler),
+	)
+
+	// POST create Calendar route
+	// Pattern							|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/calendars				|	createCalendarHandler	| create new
+	//											|												| calendar
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/calendars",
+		app.requirePermission("events:write", app.createCalendarHandler),
+	)
+
+	// GET get Calendar by ID route
+	// Pattern							|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/calendars/:id		|	showCalendarHandler		| show calendar
+	//											|												| details
+	// Use the requirePermission() middleware, then the
+	// requireCalendarRole() middleware to check the
+	// calendar is shared with the user.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/calendars/:id",
+		app.requirePermission(
+			"events:read",
+			app.requireCalendarRole(data.RoleFreeBusy, app.showCalendarHandler),
+		),
+	)
+
+	// PATCH update Calendar by ID route
+	// Pattern							|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/calendars/:id		|	updateCalendarHandler	| update calendar
+	//											|												| details
+	// Use the requirePermission() middleware, then the
+	// requireCalendarRole() middleware to check the user
+	// owns the calendar.
+	router.HandlerFunc(
+		http.MethodPatch,
+		"/v1/calendars/:id",
+		app.requirePermission(
+			"events:write",
+			app.requireCalendarRole(data.RoleOwner, app.updateCalendarHandler),
+		),
+	)
+
+	// DELETE delete Calendar by ID route
+	// Pattern							|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/calendars/:id		|	deleteCalendarHandler	| delete calendar
+	//											|												| and its events
+	// Use the requirePermission() middleware, then the
+	// requireCalendarRole() middleware to check the user
+	// owns the calendar.
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/calendars/:id",
+		app.requirePermission(
+			"events:write",
+			app.requireCalendarRole(data.RoleOwner, app.deleteCalendarHandler),
+		),
+	)
+
+	// GET list Calendar events route
+	// Pattern									|		Handler										|		Action
+	//----------------------------------------------------
+	// /v1/calendars/:id/events	|	listCalendarEventsHandler	| retrieve list
+	//													|														| of events
+	// Use the requirePermission() middleware, then the
+	// requireCalendarRole() middleware to check the
+	// calendar is shared with the user.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/calendars/:id/events",
+		app.requirePermission(
+			"events:read",
+			app.requireCalendarRole(data.RoleFreeBusy, app.listCalendarEventsHandler),
+		),
+	)
+
+	// GET list Calendar shares route
+	// Pattern									|		Handler										|		Action
+	//----------------------------------------------------
+	// /v1/calendars/:id/shares	|	listCalendarSharesHandler	| retrieve list
+	//													|														| of shares
+	// Use the requirePermission() middleware, then the
+	// requireCalendarRole() middleware to check the user
+	// owns the calendar.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/calendars/:id/shares",
+		app.requirePermission(
+			"events:read",
+			app.requireCalendarRole(data.RoleOwner, app.listCalendarSharesHandler),
+		),
+	)
+
+	// POST share Calendar route
+	// Pattern									|		Handler										|		Action
+	//----------------------------------------------------
+	// /v1/calendars/:id/shares	|	createCalendarShareHandler| invite user
+	//													|														| by email
+	// Use the requirePermission() middleware, then the
+	// requireCalendarRole() middleware to check the user
+	// owns the calendar.
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/calendars/:id/shares",
+		app.requirePermission(
+			"events:write",
+			app.requireCalendarRole(data.RoleOwner, app.createCalendarShareHandler),
+		),
+	)
+
+	// DELETE revoke Calendar share route
+	// Pattern														|		Handler										|		Action
+	//----------------------------------------------------
+	// /v1/calendars/:id/shares/:share_id	|	deleteCalendarShareHandler| revoke share
+	// Use the requirePermission() middleware, then the
+	// requireCalendarRole() middleware to check the user
+	// owns the calendar.
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/calendars/:id/shares/:share_id",
+		app.requirePermission(
+			"events:write",
+			app.requireCalendarRole(data.RoleOwner, app.deleteCalendarShareHandler),
+		),
+	)
+
+	// GET list Webhooks route
+	// Pattern				|		Handler							|		Action
+	//----------------------------------------------------
+	// /v1/webhooks		|	listWebhooksHandler	| retrieve list
+	//								|											| of webhooks
+	// Use the requirePermission() middleware. Webhooks
+	// only send the events a user can see, so reading
+	// events is enough to see them, while creating,
+	// changing and deleting them takes events:write.
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/webhooks",
+		app.requirePermission("events:read", app.listWebhooksHandler),
+	)
+
+	// POST create Webhook route
+	// Pattern				|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/webhooks		|	createWebhookHandler	| create webhook
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/webhooks",
+		app.requirePermission("events:write", app.createWebhookHandler),
+	)
+
+	// GET show Webhook route
+	// Pattern						|		Handler							|		Action
+	//----------------------------------------------------
+	// /v1/webhooks/:id		|	showWebhookHandler	| show webhook
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/webhooks/:id",
+		app.requirePermission("events:read", app.showWebhookHandler),
+	)
+
+	// PATCH update Webhook route
+	// Pattern						|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/webhooks/:id		|	updateWebhookHandler	| update webhook
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodPatch,
+		"/v1/webhooks/:id",
+		app.requirePermission("events:write", app.updateWebhookHandler),
+	)
+
+	// DELETE Webhook route
+	// Pattern						|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/webhooks/:id		|	deleteWebhookHandler	| delete webhook
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/webhooks/:id",
+		app.requirePermission("events:write", app.deleteWebhookHandler),
+	)
+
+	// GET list Webhook deliveries route
+	// Pattern											|		Handler												|		Action
+	//----------------------------------------------------
+	// /v1/webhooks/:id/deliveries	|	listWebhookDeliveriesHandler	| retrieve delivery
+	//															|																| history
+	// Use the requirePermission() middleware
+	router.HandlerFunc(
+		http.MethodGet,
+		"/v1/webhooks/:id/deliveries",
+		app.requirePermission("events:read", app.listWebhookDeliveriesHandler),
 	)
 
 	// POST Register new user
@@ -135,6 +740,26 @@ func (app *application) routes() http.Handler {
 		app.createAuthenticationTokenHandler,
 	)
 
+	// POST Create a feed token
+	// Pattern						|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/tokens/feed		|	createFeedTokenHandler	| create feed token
+	router.HandlerFunc(
+		http.MethodPost,
+		"/v1/tokens/feed",
+		app.requirePermission("events:read", app.createFeedTokenHandler),
+	)
+
+	// DELETE Revoke all feed tokens
+	// Pattern						|		Handler								|		Action
+	//----------------------------------------------------
+	// /v1/tokens/feed		|	deleteFeedTokensHandler	| revoke feed tokens
+	router.HandlerFunc(
+		http.MethodDelete,
+		"/v1/tokens/feed",
+		app.requirePermission("events:read", app.deleteFeedTokensHandler),
+	)
+
 	// GET Debug information for the app
 	// Pattern			|		Handler				|		Action
 	//----------------------------------------------------
@@ -157,3 +782,26 @@ func (app *application) routes() http.Handler {
 		),
 	)
 }
+
+// matchParam returns a handler which calls match when
+// the named URL parameter has the given value, and
+// next otherwise. It lets a static path, such as
+// /v1/events/import, share a position with a wildcard
+// that has child routes, which httprouter can't route
+// on its own.
+// A METHOD on the APPLICATION struct.
+func (app *application) matchParam(
+	name string,
+	value string,
+	match http.HandlerFunc,
+	next http.HandlerFunc,
+) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := httprouter.ParamsFromContext(r.Context())
+		if params.ByName(name) == value {
+			match.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
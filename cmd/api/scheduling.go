@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for Scheduling Meetings
+*/
+
+// suggestSlotsHandler suggests times for a meeting
+// when every participant is free, ranked earliest
+// first. Participants are given by ID or email address
+// as for freeBusyHandler, and must share their busy
+// times with the user. The constraints are:
+//  1. duration: length of the meeting in minutes
+//  2. from/to: the window to search
+//  3. working_hours: start and end time of day, days
+//     of the week and time zone slots must fall in,
+//     defaulting to 09:00 to 17:00, Monday to Friday,
+//     in the requested time zone. Without working
+//     hours, slots may be at any time.
+//  4. min_notice: minutes from now before the
+//     earliest slot, defaulting to 0
+//  5. buffer: minutes of free time needed between the
+//     meeting and other events, defaulting to 0
+//  6. limit: number of slots, defaulting to 10
+//
+// A METHOD on the APPLICATION struct.
+func (app *application) suggestSlotsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		UserIDs      []int64  `json:"user_ids"`
+		Emails       []string `json:"emails"`
+		Duration     int      `json:"duration"`
+		From         string   `json:"from"`
+		To           string   `json:"to"`
+		MinNotice    int      `json:"min_notice"`
+		Buffer       int      `json:"buffer"`
+		Limit        *int     `json:"limit"`
+		WorkingHours *struct {
+			Start    string   `json:"start"`
+			End      string   `json:"end"`
+			Days     []string `json:"days"`
+			TimeZone string   `json:"time_zone"`
+		} `json:"working_hours"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// Read the time zone requested for the response,
+	// which slots are written in. Times without a UTC
+	// offset are read as UTC.
+	v := validator.New()
+	loc := app.readTimeZone(r, v)
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	validateFreeBusyUsers(v, input.UserIDs, input.Emails)
+
+	query := &data.SlotQuery{
+		Duration:  time.Duration(input.Duration) * time.Minute,
+		Buffer:    time.Duration(input.Buffer) * time.Minute,
+		MinNotice: time.Duration(input.MinNotice) * time.Minute,
+		Limit:     10,
+	}
+	if input.Limit != nil {
+		query.Limit = *input.Limit
+	}
+
+	query.From, err = internal.ParseTimeString(input.From)
+	v.Check(err == nil, "from", "must be a valid date or date and time")
+	query.To, err = internal.ParseTimeString(input.To)
+	v.Check(err == nil, "to", "must be a valid date or date and time")
+
+	// Copy the working hours, filling in the defaults.
+	if input.WorkingHours != nil {
+		hours := &data.WorkingHours{
+			Start:    9 * time.Hour,
+			End:      17 * time.Hour,
+			Days:     []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+			Location: loc,
+		}
+		if input.WorkingHours.Start != "" {
+			hours.Start = readClock(input.WorkingHours.Start, v)
+		}
+		if input.WorkingHours.End != "" {
+			hours.End = readClock(input.WorkingHours.End, v)
+		}
+		if input.WorkingHours.Days != nil {
+			hours.Days = nil
+			for _, name := range input.WorkingHours.Days {
+				day, ok := data.Weekdays[strings.ToLower(name)]
+				if !ok {
+					v.AddError("working_hours", "days must be one of sun, mon, tue, wed, thu, fri or sat")
+					break
+				}
+				hours.Days = append(hours.Days, day)
+			}
+		}
+		if input.WorkingHours.TimeZone != "" {
+			hours.Location, err = internal.LoadTimeZone(input.WorkingHours.TimeZone)
+			v.Check(err == nil, "working_hours", "time zone must be a valid IANA time zone")
+		}
+		query.WorkingHours = hours
+	}
+
+	if v.Valid() {
+		data.ValidateSlotQuery(v, query)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Find when the participants are busy, including the
+	// buffer either side of the window. Every
+	// participant must share their busy times.
+	users, err := app.freeBusyUsers(
+		r,
+		input.UserIDs,
+		input.Emails,
+		query.From.Add(-query.Buffer),
+		query.To.Add(query.Buffer),
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var busy []*data.BusyInterval
+	var unavailable []string
+	for _, user := range users {
+		switch {
+		case user.Error == "":
+			busy = append(busy, user.Busy...)
+		case user.Email != "":
+			unavailable = append(unavailable, user.Email)
+		default:
+			unavailable = append(unavailable, fmt.Sprint(user.UserID))
+		}
+	}
+	if len(unavailable) > 0 {
+		v.AddError("user_ids", "must be users whose busy times are shared with you: "+strings.Join(unavailable, ", "))
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	slots := data.SuggestSlots(query, busy, time.Now())
+	for _, slot := range slots {
+		slot.Start = slot.Start.In(loc)
+		slot.End = slot.End.In(loc)
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"slots": slots}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readClock reads a time of day in the "15:04" format
+// as the time after midnight. "24:00" is the end of
+// the day. If the time can't be read, an error message
+// is recorded in the validator.
+func readClock(s string, v *validator.Validator) time.Duration {
+	if s == "24:00" {
+		return 24 * time.Hour
+	}
+
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		v.AddError("working_hours", "start and end must be times of day such as 09:00")
+		return 0
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+}
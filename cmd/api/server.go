@@ -30,11 +30,40 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Close the event streams when the server shuts
+	// down, since Shutdown() waits for their requests to
+	// finish.
+	srv.RegisterOnShutdown(app.broker.Close)
+
 	// Create a shutdownError channel. This is used to
 	// recieve any errors returned by the graceful
 	// Shutdown() function.
 	shutdownError := make(chan error)
 
+	// Create a context which is cancelled on shutdown,
+	// to stop the event reminder scheduler, the trash
+	// purge and the webhook delivery queue. They run as
+	// background tasks, so the shutdown waits for them to
+	// stop. An interval or retention of 0 disables them.
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+
+	if app.config.reminders.interval > 0 {
+		app.background(func() {
+			app.runReminders(schedulerCtx)
+		})
+	}
+	if app.config.trash.retention > 0 {
+		app.background(func() {
+			app.runTrashPurge(schedulerCtx)
+		})
+	}
+	if app.config.webhooks.interval > 0 {
+		app.background(func() {
+			app.runWebhooks(schedulerCtx)
+		})
+	}
+
 	// Start a background goroutine.
 	go func() {
 		// Create a quit channel which carries
@@ -86,6 +115,10 @@ func (app *application) serve() error {
 			},
 		)
 
+		// Stop the reminder scheduler, the trash purge and
+		// the webhook delivery queue.
+		stopScheduler()
+
 		// Call Wait() to block until the WaitGroup counter
 		// is zero. Then return nil on the shutdowmError
 		// channel, to indicate the shutdown completed
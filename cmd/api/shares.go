@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for Calendar Shares
+*/
+
+// listCalendarSharesHandler returns the users a
+// calendar is shared with, and their roles.
+// A METHOD on the APPLICATION struct.
+func (app *application) listCalendarSharesHandler(w http.ResponseWriter, r *http.Request) {
+	calendar := app.contextGetCalendar(r)
+
+	shares, err := app.models.Shares.GetAllForCalendar(calendar.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"shares": shares}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createCalendarShareHandler invites a registered user,
+// by email, to a calendar with a role. Inviting a user
+// the calendar is already shared with changes their
+// role. The user is sent an email telling them about
+// the invite.
+// A METHOD on the APPLICATION struct.
+func (app *application) createCalendarShareHandler(w http.ResponseWriter, r *http.Request) {
+	calendar := app.contextGetCalendar(r)
+
+	// Declare an anonymous struct to hold the info
+	// expected in the HTTP body.
+	var input struct {
+		Email string `json:"email"`
+		Role  string `json:"role"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	share := &data.Share{
+		CalendarID: calendar.ID,
+		Email:      input.Email,
+		Role:       input.Role,
+	}
+
+	// Validate the email and role, and send a response
+	// containing errors if any checks fail.
+	v := validator.New()
+	data.ValidateEmail(v, share.Email)
+	if data.ValidateShare(v, share); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Calendars can only be shared with registered users
+	// other than the calendar's owner.
+	user, err := app.models.Users.GetByEmail(share.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "must be the email of a registered user")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	if user.ID == calendar.UserID {
+		v.AddError("email", "must not be the email of the calendar's owner")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	share.UserID = user.ID
+	share.Name = user.Name
+
+	err = app.models.Shares.Upsert(share)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Email the invite in a background goroutine, so the
+	// response is not held up by the SMTP server.
+	inviter := app.contextGetUser(r)
+	app.background(func() {
+		data := map[string]interface{}{
+			"calendarID":   calendar.ID,
+			"calendarName": calendar.Name,
+			"inviterName":  inviter.Name,
+			"name":         user.Name,
+			"role":         share.Role,
+		}
+
+		err := app.mailer.Send(user.Email, "calendar_share.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"share": share}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCalendarShareHandler revokes a share of a
+// calendar.
+// A METHOD on the APPLICATION struct.
+func (app *application) deleteCalendarShareHandler(w http.ResponseWriter, r *http.Request) {
+	calendar := app.contextGetCalendar(r)
+
+	id, err := app.readNamedIDParam(r, "share_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Shares.Delete(id, calendar.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "share successfully revoked"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
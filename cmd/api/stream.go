@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/pubsub"
+)
+
+/*
+	Server-Sent Events Stream of Event Changes
+*/
+
+// Define the settings of event streams:
+//  1. streamReplaySize: changes kept for streams which
+//     reconnect with a Last-Event-ID header
+//  2. streamHeartbeatInterval: time between heartbeat
+//     comments, which keep idle connections open
+//  3. streamWriteTimeout: time allowed for each write to
+//     a stream, which replaces the server's
+//     WriteTimeout for the life of the stream
+//  4. streamRetry: time clients wait before
+//     reconnecting
+const (
+	streamReplaySize        = 1000
+	streamHeartbeatInterval = 15 * time.Second
+	streamWriteTimeout      = 10 * time.Second
+	streamRetry             = 5 * time.Second
+)
+
+// publishEventChange sends a change to an event to the
+// webhooks subscribed to it, and to event streams. The
+// payload holds the type of change and the event, as
+// it was after the change, or before it was deleted.
+// The change has already been made, so errors are
+// logged rather than sent to the client.
+// A METHOD on the APPLICATION struct.
+func (app *application) publishEventChange(changeType string, event *data.Event) {
+	payload, err := json.Marshal(envelope{
+		"type":       changeType,
+		"created_at": time.Now().UTC(),
+		"event":      event,
+	})
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	app.enqueueWebhooks(changeType, event, payload)
+
+	// Publish a copy of the event, which streams check
+	// the user can see, since the handler may go on to
+	// change it.
+	published := *event
+	app.broker.Publish(changeType, payload, &published)
+}
+
+// streamEventsHandler sends the changes to the events
+// the authenticated user can see as Server-Sent
+// Events, until the client disconnects or the server
+// shuts down. A client which reconnects with a
+// Last-Event-ID header is sent the changes it missed.
+// If they are no longer buffered, it is sent a "reset"
+// event, and should fetch the events again.
+// A METHOD on the APPLICATION struct.
+func (app *application) streamEventsHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	owner, err := app.eventOwner(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Subscribe before anything is sent, so no change is
+	// missed.
+	var sub *pubsub.Subscription
+	var replay []pubsub.Message
+	reset := false
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		id, parseErr := strconv.ParseUint(lastEventID, 10, 64)
+		if parseErr != nil {
+			sub, err = app.broker.Subscribe()
+			reset = true
+		} else {
+			sub, replay, err = app.broker.SubscribeAfter(id)
+			if errors.Is(err, pubsub.ErrReplayGap) {
+				err = nil
+				reset = true
+			}
+		}
+	} else {
+		sub, err = app.broker.Subscribe()
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, pubsub.ErrClosed):
+			app.errorResponse(w, r, http.StatusServiceUnavailable, "the server is shutting down")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer sub.Close()
+
+	// Each write extends the write deadline, so the
+	// stream outlives the server's WriteTimeout, while a
+	// client which stops reading is still disconnected.
+	rc := http.NewResponseController(w)
+	send := func(s string) error {
+		err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprint(w, s)
+		if err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	opening := fmt.Sprintf("retry: %d\n\n", streamRetry.Milliseconds())
+	if reset {
+		opening += "event: reset\ndata: {}\n\n"
+	}
+	for _, msg := range replay {
+		if app.streamCanSee(user, owner, msg) {
+			opening += streamMessage(msg)
+		}
+	}
+	if send(opening) != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case msg, ok := <-sub.C():
+			// The subscription is closed when the server
+			// shuts down, or if the client fell behind, in
+			// which case it resumes when it reconnects.
+			if !ok {
+				return
+			}
+			if !app.streamCanSee(user, owner, msg) {
+				continue
+			}
+			if send(streamMessage(msg)) != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if send(": heartbeat\n\n") != nil {
+				return
+			}
+		}
+	}
+}
+
+// streamCanSee reports whether a user can see the
+// event a change was published for: if they own it,
+// are an admin, as shown by an owner of 0, or its
+// calendar is shared with them to view it.
+// A METHOD on the APPLICATION struct.
+func (app *application) streamCanSee(user *data.User, owner int64, msg pubsub.Message) bool {
+	event, ok := msg.Value.(*data.Event)
+	if !ok {
+		return false
+	}
+	if owner == 0 || event.UserID == user.ID {
+		return true
+	}
+	if event.CalendarID == 0 {
+		return false
+	}
+
+	role, err := app.models.Shares.Role(event.CalendarID, user.ID)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return false
+	}
+	return data.RoleIncludes(role, data.RoleViewer)
+}
+
+// streamMessage formats a published change as a
+// Server-Sent Event. The JSON payload is on one line,
+// so it is a single data field.
+func streamMessage(msg pubsub.Message) string {
+	return fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", msg.ID, msg.Type, msg.Data)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for the Events Trash
+*/
+
+// trashPurgeInterval is the time between purges of
+// events which have been in the trash for longer than
+// the trash retention period.
+const trashPurgeInterval = time.Hour
+
+// listTrashedEventsHandler returns the deleted events
+// the user could restore, most recently deleted first
+// by default.
+// A METHOD on the APPLICATION struct.
+func (app *application) listTrashedEventsHandler(w http.ResponseWriter, r *http.Request) {
+	// Scope the trash to the user's own events, unless
+	// the user is an admin.
+	owner, err := app.eventOwner(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Read the time zone requested for the response,
+	// and the page, page_size and sort query string
+	// values. Defaults:
+	//	1.	page: 1
+	//	2.	page_size: 20
+	//	3.	sort: -deleted_at
+	v := validator.New()
+	qs := r.URL.Query()
+	loc := app.readTimeZone(r, v)
+
+	var filters data.Filters
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "-deleted_at")
+	filters.SortSafelist = []string{
+		"id",
+		"title",
+		"start",
+		"deleted_at",
+		"-id",
+		"-title",
+		"-start",
+		"-deleted_at",
+	}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := app.models.Events.GetAllDeleted(owner, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for i, event := range events {
+		events[i] = event.In(loc)
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"events": events, "metadata": metadata},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreEventHandler takes a deleted event out of the
+// trash.
+// A METHOD on the APPLICATION struct.
+func (app *application) restoreEventHandler(w http.ResponseWriter, r *http.Request) {
+	// The event has been loaded by the
+	// requireTrashedEventRole() middleware, which
+	// checked that the user may edit it.
+	event := app.contextGetEvent(r)
+	event.UpdatedBy = app.contextGetUser(r).ID
+
+	v := validator.New()
+	loc := app.readTimeZone(r, v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := app.models.Events.Restore(event)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Send the restored event to webhooks and event
+	// streams.
+	app.publishEventChange(data.EventRestored, event)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"event": event.In(loc)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeEventHandler permanently deletes an event in
+// the trash, and its attached files. It can't be
+// restored afterwards.
+// A METHOD on the APPLICATION struct.
+func (app *application) purgeEventHandler(w http.ResponseWriter, r *http.Request) {
+	// The event has been loaded by the
+	// requireTrashedEventRole() middleware, which
+	// checked that the user may edit it.
+	event := app.contextGetEvent(r)
+
+	err := app.models.Events.Purge(event.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Send the purged event to webhooks and event
+	// streams.
+	app.publishEventChange(data.EventPurged, event)
+
+	// Remove the content of the event's attachments
+	// from storage.
+	app.background(app.removeOrphanedBlobs)
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "event successfully purged"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// runTrashPurge permanently deletes the events which
+// have been in the trash for longer than the trash
+// retention period, every trashPurgeInterval, until
+// the context is cancelled. It is run in a background
+// goroutine by serve().
+// A METHOD on the APPLICATION struct.
+func (app *application) runTrashPurge(ctx context.Context) {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		app.purgeTrash()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeTrash permanently deletes the events which have
+// been in the trash for longer than the trash
+// retention period, and their attached files.
+// A METHOD on the APPLICATION struct.
+func (app *application) purgeTrash() {
+	before := time.Now().Add(-app.config.trash.retention)
+
+	events, err := app.models.Events.PurgeDeleted(before)
+	if err != nil {
+		app.logger.PrintError(err, nil)
+		return
+	}
+
+	if len(events) > 0 {
+		app.logger.PrintInfo("purged events from the trash", map[string]string{
+			"events": strconv.Itoa(len(events)),
+		})
+	}
+
+	// Send the purged events to webhooks and event
+	// streams.
+	for _, event := range events {
+		app.publishEventChange(data.EventPurged, event)
+	}
+
+	// Remove the content of the purged events'
+	// attachments from storage, and of any attachments
+	// left orphaned by an earlier failure.
+	app.removeOrphanedBlobs()
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/data"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+/*
+	Handler Functions for Webhooks
+*/
+
+// createWebhookHandler creates a webhook owned by the
+// authenticated user. If no secret is given, one is
+// generated. The secret is only included in the
+// response when it is set, so it must be kept by the
+// client.
+// A METHOD on the APPLICATION struct.
+func (app *application) createWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	// Declare an anonymous struct to hold the info
+	// expected in the HTTP body. Webhooks are active
+	// unless they are created inactive.
+	var input struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+		Secret     string   `json:"secret,omitempty"`
+		Active     *bool    `json:"active,omitempty"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	webhook := &data.Webhook{
+		UserID:     app.contextGetUser(r).ID,
+		URL:        input.URL,
+		EventTypes: input.EventTypes,
+		Secret:     input.Secret,
+		Active:     input.Active == nil || *input.Active,
+	}
+
+	// Validate the webhook, and send a response
+	// containing errors if any checks fail.
+	v := validator.New()
+	data.ValidateWebhook(v, webhook)
+	app.validateWebhookAddress(v, webhook.URL)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if webhook.Secret == "" {
+		webhook.Secret, err = internal.GenerateRandomString(32)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = app.models.Webhooks.Insert(webhook)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Include a Location header for the new webhook.
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/webhooks/%d", webhook.ID))
+
+	err = app.writeJSON(
+		w,
+		http.StatusCreated,
+		envelope{"webhook": webhook},
+		headers,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhooksHandler returns the webhooks owned by
+// the authenticated user, or of every user for admins.
+// A METHOD on the APPLICATION struct.
+func (app *application) listWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	owner, err := app.eventOwner(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	webhooks, err := app.models.Webhooks.GetAll(owner)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhooks": webhooks}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// showWebhookHandler returns a webhook.
+// A METHOD on the APPLICATION struct.
+func (app *application) showWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateWebhookHandler updates the URL, event types,
+// secret or active state of a webhook.
+// A METHOD on the APPLICATION struct.
+func (app *application) updateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	// Pointer fields are nil if they were not provided,
+	// in which case they are left unchanged.
+	var input struct {
+		URL        *string  `json:"url"`
+		EventTypes []string `json:"event_types"`
+		Secret     *string  `json:"secret"`
+		Active     *bool    `json:"active"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.URL != nil {
+		webhook.URL = *input.URL
+	}
+	if input.EventTypes != nil {
+		webhook.EventTypes = input.EventTypes
+	}
+	if input.Active != nil {
+		webhook.Active = *input.Active
+	}
+
+	// An empty secret is not left unset, since that
+	// would keep the old one.
+	v := validator.New()
+	if input.Secret != nil {
+		webhook.Secret = *input.Secret
+		v.Check(webhook.Secret != "", "secret", "must not be empty")
+	}
+
+	data.ValidateWebhook(v, webhook)
+	app.validateWebhookAddress(v, webhook.URL)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The webhook has been checked by readWebhook(), so
+	// it is not scoped to an owner.
+	err = app.models.Webhooks.Update(webhook, 0)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"webhook": webhook}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteWebhookHandler deletes a webhook, and its
+// queued and past deliveries.
+// A METHOD on the APPLICATION struct.
+func (app *application) deleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	// The webhook has been checked by readWebhook(), so
+	// it is not scoped to an owner.
+	err := app.models.Webhooks.Delete(webhook.ID, 0)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(
+		w,
+		http.StatusOK,
+		envelope{"message": "webhook successfully deleted"},
+		nil,
+	)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listWebhookDeliveriesHandler returns the most recent
+// deliveries of a webhook, with the history of the
+// attempts to send each one.
+// A METHOD on the APPLICATION struct.
+func (app *application) listWebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	webhook, ok := app.readWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := app.models.Webhooks.GetDeliveries(webhook.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"deliveries": deliveries}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readWebhook fetches the webhook with the ID in the
+// URL, if it is owned by the authenticated user, or
+// the user is an admin. If it is not found, a 404 Not
+// Found response is sent, and false is returned.
+// A METHOD on the APPLICATION struct.
+func (app *application) readWebhook(w http.ResponseWriter, r *http.Request) (*data.Webhook, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	owner, err := app.eventOwner(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	webhook, err := app.models.Webhooks.Get(id, owner)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return webhook, true
+}
+
+// validateWebhookAddress checks that a webhook's URL
+// doesn't name a host webhooks are not sent to:
+// localhost, or an IP address webhookAddrAllowed()
+// refuses. Other host names are checked against each
+// address they resolve to when a delivery is sent.
+// A METHOD on the APPLICATION struct.
+func (app *application) validateWebhookAddress(v *validator.Validator, rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		host = "127.0.0.1"
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return
+	}
+	v.Check(
+		webhookAddrAllowed(addr, app.config.webhooks.allowedNetworks),
+		"url",
+		"must not be a loopback, private or link-local address",
+	)
+}
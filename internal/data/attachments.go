@@ -0,0 +1,264 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+// Attachment struct holds a file attached to an event.
+// Its content is stored outside the database, as the
+// blob with its checksum.
+// Fields:
+// 1.		ID: Unique ID for attachment
+// 2.		EventID: ID of the event the file is attached to
+// 3.		UserID: ID of the user who uploaded the file
+// 4.		Filename: Name of the file when it was uploaded
+// 5.		ContentType: MIME type sniffed from the content
+// 6.		Size: Size of the file in bytes
+// 7.		Checksum: Lowercase hex SHA-256 checksum of the content
+// 8.		CreatedAt: Timestamp when file was uploaded
+type Attachment struct {
+	ID          int64     `json:"id"`
+	EventID     int64     `json:"event_id"`
+	UserID      int64     `json:"user_id,omitempty"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Checksum    string    `json:"checksum"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AttachmentModel struct wraps an sql.DB connection
+// pool.
+type AttachmentModel struct {
+	DB *sql.DB
+}
+
+// ValidateAttachment runs the validator to validate
+// attachments.
+func ValidateAttachment(v *validator.Validator, attachment *Attachment) {
+	v.Check(attachment.Filename != "", "file", "must have a file name")
+	v.Check(len(attachment.Filename) <= 255, "file", "must not have a file name more than 255 bytes long")
+	v.Check(attachment.Size > 0, "file", "must not be empty")
+}
+
+// attachmentColumns lists the event_attachments table
+// columns in the order scanAttachment() expects them.
+const attachmentColumns = `
+	id, event_id, user_id, filename, content_type, size, checksum, created_at
+`
+
+// scanAttachment scans a row selected with
+// attachmentColumns into an attachment.
+func scanAttachment(row rowScanner, attachment *Attachment) error {
+	var userID sql.NullInt64
+
+	err := row.Scan(
+		&attachment.ID,
+		&attachment.EventID,
+		&userID,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&attachment.Checksum,
+		&attachment.CreatedAt,
+	)
+	attachment.UserID = userID.Int64
+	return err
+}
+
+// Insert a new record into the event_attachments
+// table. The blob with its checksum must already be
+// stored.
+func (m AttachmentModel) Insert(attachment *Attachment) error {
+	query := `
+		INSERT INTO event_attachments (event_id, user_id, filename, content_type, size, checksum, created_at)
+		VALUES (?, NULLIF(?, 0), ?, ?, ?, ?, ?)
+		RETURNING id, created_at
+	`
+
+	args := []interface{}{
+		attachment.EventID,
+		attachment.UserID,
+		attachment.Filename,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.Checksum,
+		internal.CurrentDate(),
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&attachment.ID, &attachment.CreatedAt)
+}
+
+// Get fetches an attachment of an event by ID.
+func (m AttachmentModel) Get(id, eventID int64) (*Attachment, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM event_attachments
+		WHERE id = ? AND event_id = ?
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var attachment Attachment
+
+	err := scanAttachment(m.DB.QueryRowContext(ctx, query, id, eventID), &attachment)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &attachment, nil
+}
+
+// GetAllForEvent returns the attachments of an event,
+// in the order they were uploaded.
+func (m AttachmentModel) GetAllForEvent(eventID int64) ([]*Attachment, error) {
+	query := `
+		SELECT ` + attachmentColumns + `
+		FROM event_attachments
+		WHERE event_id = ?
+		ORDER BY id ASC
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+	for rows.Next() {
+		var attachment Attachment
+
+		err := scanAttachment(rows, &attachment)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, &attachment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// Delete removes an attachment from an event. If no
+// other attachment has the same content, its blob is
+// recorded as orphaned by a trigger, to be removed by
+// the caller with Orphans() and ClaimOrphan().
+func (m AttachmentModel) Delete(id, eventID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(
+		ctx,
+		`DELETE FROM event_attachments WHERE id = ? AND event_id = ?`,
+		id,
+		eventID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Orphans returns the checksums of the blobs no
+// longer used by any attachment, because the
+// attachments were deleted, or purged with their
+// events.
+func (m AttachmentModel) Orphans() ([]string, error) {
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, `SELECT checksum FROM orphaned_blobs ORDER BY checksum`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	checksums := []string{}
+	for rows.Next() {
+		var checksum string
+
+		err := rows.Scan(&checksum)
+		if err != nil {
+			return nil, err
+		}
+
+		checksums = append(checksums, checksum)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return checksums, nil
+}
+
+// ClaimOrphan stops recording a blob as orphaned, so
+// it can be removed from storage. It reports false if
+// the blob is no longer orphaned, because the same
+// content has been attached again since Orphans()
+// returned it, and then the blob must be kept.
+func (m AttachmentModel) ClaimOrphan(checksum string) (bool, error) {
+	query := `
+		DELETE FROM orphaned_blobs
+		WHERE checksum = ?
+		AND NOT EXISTS (SELECT 1 FROM event_attachments WHERE checksum = ?)
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, checksum, checksum)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
@@ -0,0 +1,394 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+// Define the participation statuses of an attendee,
+// as in the iCalendar PARTSTAT parameter.
+const (
+	StatusNeedsAction = "needs-action"
+	StatusAccepted    = "accepted"
+	StatusDeclined    = "declined"
+	StatusTentative   = "tentative"
+)
+
+// Statuses lists the participation statuses.
+var Statuses = []string{StatusNeedsAction, StatusAccepted, StatusDeclined, StatusTentative}
+
+// ErrDuplicateAttendee is returned when an email
+// address is added to an event twice.
+var ErrDuplicateAttendee = errors.New("duplicate attendee")
+
+// Attendee struct
+// Fields:
+// 1.		ID: Unique ID for attendee
+// 2.		EventID: ID of the event the attendee is invited to
+// 3.		UserID: ID of the user, or 0 for an external email address
+// 4.		Name: Attendee name (optional)
+// 5.		Email: Attendee email address
+// 6.		Status: Participation status, one of Statuses
+// 7.		CreatedAt: Timestamp when attendee was added
+// 8.		UpdatedAt: Timestamp when attendee was updated
+// 9.		Version: Version starts at 1 and incremented on each update
+type Attendee struct {
+	ID        int64     `json:"id"`
+	EventID   int64     `json:"event_id"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Email     string    `json:"email"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int32     `json:"version"`
+}
+
+// RSVPSummary struct counts the attendees of an event
+// by participation status.
+type RSVPSummary struct {
+	NeedsAction int `json:"needs_action"`
+	Accepted    int `json:"accepted"`
+	Declined    int `json:"declined"`
+	Tentative   int `json:"tentative"`
+}
+
+// AttendeeModel struct wraps an sql.DB connection pool.
+type AttendeeModel struct {
+	DB *sql.DB
+}
+
+// ValidateAttendee runs the validator to validate
+// attendees.
+func ValidateAttendee(v *validator.Validator, attendee *Attendee) {
+	ValidateEmail(v, attendee.Email)
+	v.Check(len(attendee.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(
+		validator.In(attendee.Status, Statuses),
+		"status",
+		"must be one of needs-action, accepted, declined or tentative",
+	)
+}
+
+// attendeeColumns lists the event_attendees table
+// columns in the order scanAttendee() expects them.
+const attendeeColumns = `
+	a.id, a.event_id, a.user_id, a.name, a.email, a.status, a.created_at, a.updated_at, a.version
+`
+
+// scanAttendee scans a row selected with
+// attendeeColumns into an attendee.
+func scanAttendee(row rowScanner, attendee *Attendee) error {
+	var userID sql.NullInt64
+
+	err := row.Scan(
+		&attendee.ID,
+		&attendee.EventID,
+		&userID,
+		&attendee.Name,
+		&attendee.Email,
+		&attendee.Status,
+		&attendee.CreatedAt,
+		&attendee.UpdatedAt,
+		&attendee.Version,
+	)
+	attendee.UserID = userID.Int64
+	return err
+}
+
+// Insert a new record into the event_attendees table.
+// An ErrDuplicateAttendee error is returned if the
+// email address is already an attendee of the event.
+func (m AttendeeModel) Insert(attendee *Attendee) error {
+	query := `
+		INSERT INTO event_attendees (event_id, user_id, name, email, status, created_at, updated_at, version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_at, updated_at, version
+	`
+
+	// External attendees are stored without a user.
+	var userID interface{}
+	if attendee.UserID != 0 {
+		userID = attendee.UserID
+	}
+
+	args := []interface{}{
+		attendee.EventID,
+		userID,
+		attendee.Name,
+		attendee.Email,
+		attendee.Status,
+		internal.CurrentDate(),
+		internal.CurrentDate(),
+		1,
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&attendee.ID,
+		&attendee.CreatedAt,
+		&attendee.UpdatedAt,
+		&attendee.Version,
+	)
+	if err != nil {
+		switch {
+		case err.Error() == `UNIQUE constraint failed: event_attendees.event_id, event_attendees.email`:
+			return ErrDuplicateAttendee
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Get fetches an attendee of an event by ID.
+func (m AttendeeModel) Get(id, eventID int64) (*Attendee, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + attendeeColumns + `
+		FROM event_attendees a
+		WHERE a.id = ? AND a.event_id = ?
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var attendee Attendee
+
+	err := scanAttendee(m.DB.QueryRowContext(ctx, query, id, eventID), &attendee)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &attendee, nil
+}
+
+// GetForToken fetches the attendee an RSVP token was
+// sent to, if the token has not expired.
+func (m AttendeeModel) GetForToken(tokenPlaintext string) (*Attendee, error) {
+	// Calculate the SHA-256 hash of the plaintext
+	// token provided by the client.
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	query := `
+		SELECT ` + attendeeColumns + `
+		FROM event_attendees a
+		INNER JOIN tokens t
+		ON a.id = t.attendee_id
+		WHERE t.hash = ?
+		AND t.scope = ?
+		AND t.expiry > ?
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var attendee Attendee
+
+	err := scanAttendee(
+		m.DB.QueryRowContext(ctx, query, tokenHash[:], ScopeRSVP, time.Now()),
+		&attendee,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &attendee, nil
+}
+
+// GetAllForEvent returns the attendees of an event,
+// sorted by email.
+func (m AttendeeModel) GetAllForEvent(eventID int64) ([]*Attendee, error) {
+	query := `
+		SELECT ` + attendeeColumns + `
+		FROM event_attendees a
+		WHERE a.event_id = ?
+		ORDER BY a.email ASC
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, eventID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attendees := []*Attendee{}
+	for rows.Next() {
+		var attendee Attendee
+
+		err := scanAttendee(rows, &attendee)
+		if err != nil {
+			return nil, err
+		}
+
+		attendees = append(attendees, &attendee)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attendees, nil
+}
+
+// Summaries returns the RSVP summary of each event ID.
+// Events without attendees are not in the map.
+func (m AttendeeModel) Summaries(eventIDs ...int64) (map[int64]*RSVPSummary, error) {
+	summaries := make(map[int64]*RSVPSummary)
+	if len(eventIDs) == 0 {
+		return summaries, nil
+	}
+
+	query := `
+		SELECT event_id, status, COUNT(*)
+		FROM event_attendees
+		WHERE event_id IN (` + placeholders(len(eventIDs)) + `)
+		GROUP BY event_id, status
+	`
+
+	args := make([]interface{}, len(eventIDs))
+	for i, id := range eventIDs {
+		args[i] = id
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			eventID int64
+			status  string
+			count   int
+		)
+
+		err := rows.Scan(&eventID, &status, &count)
+		if err != nil {
+			return nil, err
+		}
+
+		summary, ok := summaries[eventID]
+		if !ok {
+			summary = &RSVPSummary{}
+			summaries[eventID] = summary
+		}
+
+		switch status {
+		case StatusNeedsAction:
+			summary.NeedsAction = count
+		case StatusAccepted:
+			summary.Accepted = count
+		case StatusDeclined:
+			summary.Declined = count
+		case StatusTentative:
+			summary.Tentative = count
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return summaries, nil
+}
+
+// UpdateStatus sets the participation status of an
+// attendee, checking the version to prevent edit
+// conflicts.
+func (m AttendeeModel) UpdateStatus(attendee *Attendee) error {
+	query := `
+		UPDATE event_attendees
+		SET
+		status = ?,
+		updated_at = ?,
+		version = version + 1
+		WHERE id = ? AND version = ?
+		RETURNING updated_at, version
+	`
+
+	args := []interface{}{
+		attendee.Status,
+		internal.CurrentDate(),
+		attendee.ID,
+		attendee.Version,
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&attendee.UpdatedAt, &attendee.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete removes an attendee from an event. Their RSVP
+// tokens are deleted by a trigger.
+func (m AttendeeModel) Delete(id, eventID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(
+		ctx,
+		`DELETE FROM event_attendees WHERE id = ? AND event_id = ?`,
+		id,
+		eventID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
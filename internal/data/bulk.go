@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// Define the actions of a bulk operation:
+//  1. BulkCreate: insert a new event
+//  2. BulkUpdate: update an event at its version
+//  3. BulkDelete: move an event to the trash
+const (
+	BulkCreate = "create"
+	BulkUpdate = "update"
+	BulkDelete = "delete"
+)
+
+// BulkOperation struct holds one write in a batch of
+// event writes.
+// Fields:
+// 1.		Action: One of BulkCreate, BulkUpdate or BulkDelete
+// 2.		Event: Event to create or update, or to delete,
+// its ID, version (0 for any version) and UpdatedBy user
+// 3.		Err: Error applying the operation, if it failed
+type BulkOperation struct {
+	Action string
+	Event  *Event
+	Err    error
+}
+
+// Bulk applies a batch of operations in a single
+// transaction. Each operation runs in its own
+// savepoint, so a failed operation is undone without
+// undoing the operations before it. If atomic is
+// true, the batch stops at the first failed operation
+// and nothing is committed. Otherwise the failed
+// operations are left out and the rest are committed.
+// The error of each failed operation, such as
+// ErrEditConflict for an update at an old version, is
+// set in its Err. An error is only returned if the
+// transaction itself fails.
+func (e EventModel) Bulk(operations []*BulkOperation, atomic bool) error {
+	// Create a context with a 30 second timeout, since
+	// a batch may contain many operations.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Begin the transaction. Rollback() is a no-op once
+	// the transaction has been committed.
+	tx, err := e.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, operation := range operations {
+		_, err = tx.ExecContext(ctx, `SAVEPOINT bulk_operation`)
+		if err != nil {
+			return err
+		}
+
+		event := operation.Event
+		switch operation.Action {
+		case BulkCreate:
+			operation.Err = insertEvent(ctx, tx, event)
+		case BulkUpdate:
+			operation.Err = updateEvent(ctx, tx, event, 0)
+		case BulkDelete:
+			operation.Err = deleteEvent(ctx, tx, event.ID, 0, event.UpdatedBy, event.Version)
+		}
+
+		// Undo a failed operation, then release the
+		// savepoint either way.
+		if operation.Err != nil {
+			_, err = tx.ExecContext(ctx, `ROLLBACK TO bulk_operation`)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = tx.ExecContext(ctx, `RELEASE bulk_operation`)
+		if err != nil {
+			return err
+		}
+
+		if operation.Err != nil && atomic {
+			return nil
+		}
+	}
+
+	return tx.Commit()
+}
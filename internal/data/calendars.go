@@ -0,0 +1,391 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+// defaultCalendarName is the name of the calendar
+// created for a user who adds an event without
+// choosing a calendar.
+const defaultCalendarName = "Calendar"
+
+// Calendar struct
+// Fields:
+// 1.		ID: Unique ID for calendar
+// 2.		UserID: ID of the user who owns the calendar
+// 3.		Name: Calendar name, such as "Work"
+// 4.		Color: Display color, as "#rrggbb" (optional)
+// 5.		TimeZone: IANA time zone for new events
+// 6.		CreatedAt: Timestamp when calendar was created
+// 7.		UpdatedAt: Timestamp when calendar was updated
+// 8.		Version: Version starts at 1 and incremented on each update
+// 9.		Role: Access the requesting user has, one of Roles
+type Calendar struct {
+	ID        int64     `json:"id"`
+	UserID    int64     `json:"user_id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color,omitempty"`
+	TimeZone  string    `json:"time_zone"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Version   int32     `json:"version"`
+	Role      string    `json:"role,omitempty"`
+}
+
+// CalendarModel struct wraps an sql.DB connection pool.
+type CalendarModel struct {
+	DB *sql.DB
+}
+
+// ValidateCalendar runs the validator to validate
+// calendars.
+func ValidateCalendar(v *validator.Validator, calendar *Calendar) {
+	v.Check(calendar.Name != "", "name", "must be provided")
+	v.Check(len(calendar.Name) <= 100, "name", "must not be more than 100 bytes long")
+	v.Check(
+		calendar.Color == "" || validator.Matches(calendar.Color, validator.ColorRX),
+		"color",
+		"must be a hex color such as #1a73e8",
+	)
+
+	_, err := internal.LoadTimeZone(calendar.TimeZone)
+	v.Check(err == nil, "time_zone", "must be a valid IANA time zone")
+}
+
+// calendarColumns lists the calendars table columns in
+// the order scanCalendar() expects them.
+const calendarColumns = `
+	id, user_id, name, color, time_zone, created_at, updated_at, version
+`
+
+// scanCalendar scans a row selected with
+// calendarColumns into a calendar, followed by any
+// extra columns into dest.
+func scanCalendar(row rowScanner, calendar *Calendar, dest ...interface{}) error {
+	return row.Scan(append([]interface{}{
+		&calendar.ID,
+		&calendar.UserID,
+		&calendar.Name,
+		&calendar.Color,
+		&calendar.TimeZone,
+		&calendar.CreatedAt,
+		&calendar.UpdatedAt,
+		&calendar.Version,
+	}, dest...)...)
+}
+
+// Insert a new record into the calendars table.
+func (m CalendarModel) Insert(calendar *Calendar) error {
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertCalendar(ctx, m.DB, calendar)
+}
+
+// insertCalendar inserts a new record into the
+// calendars table using q, which may be the connection
+// pool or a transaction.
+func insertCalendar(ctx context.Context, q querier, calendar *Calendar) error {
+	// Define the SQL query for inserting a new record,
+	// returning the system generated data.
+	query := `
+		INSERT INTO calendars (user_id, name, color, time_zone, created_at, updated_at, version)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_at, updated_at, version
+	`
+
+	args := []interface{}{
+		calendar.UserID,
+		calendar.Name,
+		calendar.Color,
+		calendar.TimeZone,
+		internal.CurrentDate(),
+		internal.CurrentDate(),
+		1,
+	}
+
+	return q.QueryRowContext(ctx, query, args...).Scan(
+		&calendar.ID,
+		&calendar.CreatedAt,
+		&calendar.UpdatedAt,
+		&calendar.Version,
+	)
+}
+
+// Get fetches a specific record by ID from the
+// calendars table. If ownerID is not 0, only a
+// calendar owned by that user is returned.
+func (m CalendarModel) Get(id int64, ownerID int64) (*Calendar, error) {
+	// Check that ID is not less than 1
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + calendarColumns + `
+		FROM calendars
+		WHERE id = ?
+		AND (? = 0 OR user_id = ?)
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var calendar Calendar
+
+	err := scanCalendar(m.DB.QueryRowContext(ctx, query, id, ownerID, ownerID), &calendar)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &calendar, nil
+}
+
+// GetDefault returns the user's default calendar,
+// which is the calendar they created first. If the
+// user has no calendars, one is created in UTC.
+func (m CalendarModel) GetDefault(userID int64) (*Calendar, error) {
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getDefaultCalendar(ctx, m.DB, userID)
+}
+
+// getDefaultCalendar returns a user's default calendar,
+// creating it if needed, using q, so it can run inside
+// a transaction.
+func getDefaultCalendar(ctx context.Context, q querier, userID int64) (*Calendar, error) {
+	query := `
+		SELECT ` + calendarColumns + `
+		FROM calendars
+		WHERE user_id = ?
+		ORDER BY id ASC
+		LIMIT 1
+	`
+
+	var calendar Calendar
+
+	err := scanCalendar(q.QueryRowContext(ctx, query, userID), &calendar)
+	if errors.Is(err, sql.ErrNoRows) {
+		calendar = Calendar{
+			UserID:   userID,
+			Name:     defaultCalendarName,
+			TimeZone: "UTC",
+		}
+		err = insertCalendar(ctx, q, &calendar)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &calendar, nil
+}
+
+// GetAll returns the calendars owned by a user, or
+// shared with them, sorted by name. Each calendar's
+// Role is set to the access the user has. If ownerID
+// is 0, the calendars of every user are returned with
+// the RoleOwner role.
+func (m CalendarModel) GetAll(ownerID int64) ([]*Calendar, error) {
+	query := `
+		SELECT ` + calendarColumns + `,
+		CASE WHEN ? = 0 OR user_id = ? THEN ?
+		ELSE (
+			SELECT role FROM calendar_shares
+			WHERE calendar_id = calendars.id AND user_id = ?
+		) END
+		FROM calendars
+		WHERE (? = 0 OR user_id = ? OR id IN (
+			SELECT calendar_id FROM calendar_shares WHERE user_id = ?
+		))
+		ORDER BY name ASC, id ASC
+	`
+
+	args := []interface{}{
+		ownerID,
+		ownerID,
+		RoleOwner,
+		ownerID,
+		ownerID,
+		ownerID,
+		ownerID,
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	calendars := []*Calendar{}
+	for rows.Next() {
+		var calendar Calendar
+
+		err := scanCalendar(rows, &calendar, &calendar.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		calendars = append(calendars, &calendar)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return calendars, nil
+}
+
+// Update updates a specific record by ID in the
+// calendars table, checking the version to prevent
+// edit conflicts. If ownerID is not 0, only a calendar
+// owned by that user is updated.
+func (m CalendarModel) Update(calendar *Calendar, ownerID int64) error {
+	query := `
+		UPDATE calendars
+		SET
+		name = ?,
+		color = ?,
+		time_zone = ?,
+		updated_at = ?,
+		version = version + 1
+		WHERE id = ? AND version = ?
+		AND (? = 0 OR user_id = ?)
+		RETURNING updated_at, version
+	`
+
+	args := []interface{}{
+		calendar.Name,
+		calendar.Color,
+		calendar.TimeZone,
+		internal.CurrentDate(),
+		calendar.ID,
+		calendar.Version,
+		ownerID,
+		ownerID,
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// If no row is found, the calendar has been deleted
+	// or the version has changed.
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&calendar.UpdatedAt, &calendar.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes a specific record by ID from the
+// calendars table, along with its shares, and moves its
+// events to the trash without a calendar, in a single
+// transaction. The events can be restored, to their
+// owner's default calendar, or purged like any other
+// deleted event. The events moved to the trash are
+// returned, with the calendar they were in.
+// userID is the user deleting it. If ownerID is not 0,
+// only a calendar owned by that user is deleted.
+func (m CalendarModel) Delete(id int64, ownerID int64, userID int64) ([]*Event, error) {
+	// Return an ErrRecordNotFound error if calendar ID
+	// is less than 1
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM calendars WHERE id = ? AND (? = 0 OR user_id = ?)`,
+		id,
+		ownerID,
+		ownerID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if rowsAffected == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	// The version is incremented, since the events
+	// changed, as when they are deleted one at a time.
+	now := internal.CurrentDate()
+	ids, err := queryEventIDs(
+		ctx,
+		tx,
+		`UPDATE events
+		SET
+		deleted_at = ?,
+		updated_at = ?,
+		updated_by = NULLIF(?, 0),
+		version = version + 1
+		WHERE calendar_id = ?
+		AND deleted_at IS NULL
+		RETURNING id`,
+		now,
+		now,
+		userID,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	events, err := getEvents(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ID of a deleted calendar can be given to a new
+	// one, so the events in the trash are taken out of
+	// it, rather than left in whichever calendar gets
+	// the ID next.
+	_, err = tx.ExecContext(ctx, `UPDATE events SET calendar_id = NULL WHERE calendar_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM calendar_shares WHERE calendar_id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, tx.Commit()
+}
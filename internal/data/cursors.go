@@ -0,0 +1,161 @@
+package data
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// eventCursor struct holds the position of an event
+// in a sorted list, which a page of results can start
+// after or end before. It is sent to clients as an
+// opaque string, the base64 encoding of its JSON.
+// Fields:
+// 1.		Sort: Sort of the list, which the cursor only works with
+// 2.		Value: Value of the sort column, null when sorted by id
+// 3.		ID: ID of the event
+// 4.		Start: Start of the event, which orders the occurrences of a recurring event
+type eventCursor struct {
+	Sort  string          `json:"sort"`
+	Value json.RawMessage `json:"value"`
+	ID    int64           `json:"id"`
+	Start time.Time       `json:"start"`
+}
+
+// encodeCursor returns the cursor of an event in a
+// list sorted by the filters.
+func encodeCursor(event *Event, filters Filters) string {
+	var value interface{}
+	switch filters.sortColumn() {
+	case "title":
+		value = event.Title
+	case "all_day":
+		value = event.AllDay
+	case "start":
+		value = event.Start.UTC()
+	case "end":
+		value = event.End.UTC()
+	case "relevance":
+		value = event.relevance
+	case "distance":
+		value = event.distance()
+	}
+
+	// Marshalling the plain values can't fail, so the
+	// errors are ignored.
+	raw, _ := json.Marshal(value)
+	js, _ := json.Marshal(eventCursor{
+		Sort:  filters.Sort,
+		Value: raw,
+		ID:    event.ID,
+		Start: event.Start.UTC(),
+	})
+
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+// decodeCursor reads a cursor made by encodeCursor()
+// into an event holding only the values the list is
+// sorted on. ErrInvalidCursor is returned if the
+// cursor can't be read, or is for another sort.
+func decodeCursor(s string, filters Filters) (*Event, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var cursor eventCursor
+	err = json.Unmarshal(js, &cursor)
+	if err != nil || cursor.Sort != filters.Sort || cursor.ID < 1 {
+		return nil, ErrInvalidCursor
+	}
+
+	// The sort is checked against the cursor before the
+	// safelist, so strip its prefix here rather than
+	// calling sortColumn().
+	key := &Event{ID: cursor.ID, Start: cursor.Start}
+	switch strings.TrimPrefix(cursor.Sort, "-") {
+	case "title":
+		err = json.Unmarshal(cursor.Value, &key.Title)
+	case "all_day":
+		err = json.Unmarshal(cursor.Value, &key.AllDay)
+	case "start":
+		err = json.Unmarshal(cursor.Value, &key.Start)
+	case "end":
+		err = json.Unmarshal(cursor.Value, &key.End)
+	case "relevance":
+		err = json.Unmarshal(cursor.Value, &key.relevance)
+	case "distance":
+		key.Distance = new(float64)
+		err = json.Unmarshal(cursor.Value, key.Distance)
+	}
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return key, nil
+}
+
+// cursorKey returns the event decoded from the after
+// or before cursor in the filters, or nil if neither
+// was provided.
+func (f Filters) cursorKey() (*Event, error) {
+	switch {
+	case f.After != "":
+		return decodeCursor(f.After, f)
+	case f.Before != "":
+		return decodeCursor(f.Before, f)
+	default:
+		return nil, nil
+	}
+}
+
+// keysetCondition builds the WHERE condition selecting
+// the events after the key in the sort order of the
+// filters, or before it if backward is true, and its
+// placeholder parameters. Ties on the sort column are
+// broken by id, as in the "ORDER BY <column>
+// <direction>, id ASC" clause.
+func keysetCondition(key *Event, filters Filters, backward bool) (string, []interface{}) {
+	column := filters.sortColumn()
+
+	var value interface{}
+	switch column {
+	case "title":
+		value = key.Title
+	case "all_day":
+		value = key.AllDay
+	case "start":
+		value = key.Start.UTC()
+	case "end":
+		value = key.End.UTC()
+	case "relevance":
+		value = key.relevance
+	case "distance":
+		value = key.distance()
+	default:
+		value = key.ID
+	}
+
+	// Moving forward through an ascending list, or
+	// backward through a descending one, the column
+	// grows.
+	operator := ">"
+	if (filters.sortDirection() == "DESC") != backward {
+		operator = "<"
+	}
+	idOperator := ">"
+	if backward {
+		idOperator = "<"
+	}
+
+	condition := fmt.Sprintf(
+		"(%[1]s %[2]s ? OR (%[1]s = ? AND id %[3]s ?))",
+		column,
+		operator,
+		idOperator,
+	)
+	return condition, []interface{}{value, value, key.ID}
+}
@@ -2,40 +2,125 @@ package data
 
 import (
 	"context"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/rrule"
 	"github.com/robwestbrook/greenlight/internal/validator"
 )
 
+// Define the types of change to an event which are
+// sent to webhooks and event streams:
+//  1. EventCreated: an event was created
+//  2. EventUpdated: an event was updated
+//  3. EventDeleted: an event was moved to the trash
+//  4. EventRestored: an event was taken out of the
+//     trash
+//  5. EventPurged: an event in the trash was
+//     permanently deleted
+const (
+	EventCreated  = "event.created"
+	EventUpdated  = "event.updated"
+	EventDeleted  = "event.deleted"
+	EventRestored = "event.restored"
+	EventPurged   = "event.purged"
+)
+
+// EventChangeTypes lists the types of change to an
+// event.
+var EventChangeTypes = []string{EventCreated, EventUpdated, EventDeleted, EventRestored, EventPurged}
+
+// eventTagsColumn selects the tags of an event from
+// the event_tags table as a comma-delimited string, so
+// the events table must be named events.
+const eventTagsColumn = `COALESCE((
+		SELECT group_concat(t.name, ',' ORDER BY et.position)
+		FROM event_tags et
+		INNER JOIN tags t
+		ON t.id = et.tag_id
+		WHERE et.event_id = events.id
+	), '')`
+
+// eventLocationColumns selects the place of an event,
+// which is scanned into a single location field.
+const eventLocationColumns = `location_name, location_address, latitude, longitude`
+
+// eventColumns lists the events table columns in the
+// order scanEvent() expects them, which is the order
+// of eventColumnFields.
+const eventColumns = `
+	id, user_id, calendar_id, uid, title, description,
+	` + eventTagsColumn + `,
+	all_day, start, end, time_zone, rrule, exdates, reminders,
+	` + eventLocationColumns + `,
+	created_at, updated_at, updated_by, deleted_at, version
+`
+
 // Event struct
 // Fields:
 // 1.		ID: Unique ID for event
-// 2.		Title: Event title
-// 3.		Description: Event description
-// 4.		Tags: Event tags
-// 5.		AllDay: All day (true or false)
-// 6.		Start: Start date and time
-// 7.		End: End date and time
-// 8.		CreatedAt: Timestamp when event was created
-// 9.		UpdatedAt: Timestamp when event was updated
-// 10.	Version: Version starts at 1 and incremented on each update
+// 2.		UserID: ID of the user who owns the event
+// 3.		CalendarID: ID of the calendar the event belongs to
+// 4.		UID: Globally unique iCalendar identifier
+// 5.		Title: Event title
+// 6.		Description: Event description
+// 7.		Tags: Event tags
+// 8.		AllDay: All day (true or false)
+// 9.		Start: Start date and time
+// 10.	End: End date and time
+// 11.	TimeZone: IANA time zone the event is scheduled in
+// 12.	RRule: RFC 5545 recurrence rule (empty if the event does not repeat)
+// 13.	ExDates: Occurrence start times excluded from the recurrence
+// 14.	Reminders: Minutes before the start to send each reminder
+// 15.	Place: Where the event takes place, sent as its location
+// 16.	Distance: Kilometres from the center of a radius search
+// 17.	ParentID: ID of the recurring event an expanded occurrence belongs to
+// 18.	OccurrenceStart: Start of an expanded occurrence
+// 19.	RSVP: Number of attendees with each participation status
+// 20.	Snippet: Highlighted text matching a full-text search
+// 21.	CreatedAt: Timestamp when event was created
+// 22.	UpdatedAt: Timestamp when event was updated
+// 23.	UpdatedBy: ID of the user who made the current version
+// 24.	DeletedAt: Timestamp when event was moved to the trash
+// 25.	Version: Version starts at 1 and incremented on each update
 type Event struct {
-	ID          int64     `json:"id"`
-	Title       string    `json:"title"`
-	Description string    `json:"description,omitempty"`
-	Tags        []string  `json:"tags,omitempty"`
-	AllDay      bool      `json:"all_day"`
-	Start       time.Time `json:"start"`
-	End         time.Time `json:"end"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Version     int32     `json:"version"`
+	ID              int64        `json:"id"`
+	UserID          int64        `json:"user_id"`
+	CalendarID      int64        `json:"calendar_id"`
+	UID             string       `json:"uid"`
+	Title           string       `json:"title"`
+	Description     string       `json:"description,omitempty"`
+	Tags            []string     `json:"tags,omitempty"`
+	AllDay          bool         `json:"all_day"`
+	Start           time.Time    `json:"start"`
+	End             time.Time    `json:"end"`
+	TimeZone        string       `json:"time_zone"`
+	RRule           string       `json:"rrule,omitempty"`
+	ExDates         []time.Time  `json:"exdates,omitempty"`
+	Reminders       []int        `json:"reminders,omitempty"`
+	Place           *Place       `json:"location,omitempty"`
+	Distance        *float64     `json:"distance_km,omitempty"`
+	ParentID        int64        `json:"parent_id,omitempty"`
+	OccurrenceStart *time.Time   `json:"occurrence_start,omitempty"`
+	RSVP            *RSVPSummary `json:"rsvp,omitempty"`
+	Snippet         string       `json:"snippet,omitempty"`
+	CreatedAt       time.Time    `json:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at"`
+	UpdatedBy       int64        `json:"updated_by,omitempty"`
+	DeletedAt       *time.Time   `json:"deleted_at,omitempty"`
+	Version         int32        `json:"version"`
+
+	// relevance is the bm25() score of the event for a
+	// full-text search. Lower scores are more relevant.
+	relevance float64
 }
 
 // EventModel struct wraps an sql.DB connection pool.
@@ -44,12 +129,17 @@ type EventModel struct {
 }
 
 // Metadata struct for holding pagination data.
+// NextCursor and PrevCursor are set on lists which
+// can be paged through with cursors, when there are
+// records after or before the page.
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+	PrevCursor   string `json:"prev_cursor,omitempty"`
 }
 
 // ValidateEvent runs the validator to validate
@@ -57,47 +147,550 @@ type Metadata struct {
 func ValidateEvent(v *validator.Validator, event *Event) {
 	v.Check(event.Title != "", "title", "must be provided")
 	v.Check(len(event.Title) < 100, "title", "must not be more than 100 bytes long")
+	v.Check(len(event.Tags) <= MaxTags, "tags", fmt.Sprintf("must not contain more than %d tags", MaxTags))
+	for _, tag := range event.Tags {
+		if tag == "" || !validTagName(tag) {
+			v.AddError("tags", "must not be empty, more than 50 bytes long or contain commas")
+			break
+		}
+	}
+	v.Check(validator.Unique(event.Tags), "tags", "must not contain duplicate values")
 	v.Check(len(event.Description) <= 500, "description", "must not be more than 500 bytes long")
 	v.Check(!event.Start.IsZero() || event.AllDay, "start", "if all day is false start must have a date")
+
+	// A recurrence rule must parse, needs a start date
+	// to anchor the first occurrence, and must produce
+	// at least one occurrence.
+	if event.RRule != "" {
+		rule, err := rrule.Parse(event.RRule)
+		if err != nil {
+			v.AddError("rrule", err.Error())
+		}
+		v.Check(!event.Start.IsZero(), "rrule", "requires the event to have a start date")
+		if err == nil && !event.Start.IsZero() {
+			_, ok := rule.First(event.recurrenceStart())
+			v.Check(ok, "rrule", "must produce at least one occurrence")
+		}
+	}
+	v.Check(len(event.ExDates) == 0 || event.RRule != "", "exdates", "must only be provided for recurring events")
+
+	// The time zone must be in the tz database.
+	_, err := internal.LoadTimeZone(event.TimeZone)
+	v.Check(err == nil, "time_zone", "must be a valid IANA time zone")
+
+	// Reminders are sent a number of minutes before the
+	// event starts, so the event needs a start.
+	v.Check(len(event.Reminders) <= MaxReminders, "reminders", fmt.Sprintf("must not contain more than %d reminders", MaxReminders))
+	for _, minutes := range event.Reminders {
+		if minutes < 0 || minutes > MaxReminderMinutes {
+			v.AddError("reminders", fmt.Sprintf("must be between 0 and %d minutes before the start", MaxReminderMinutes))
+			break
+		}
+	}
+	reminders := strings.Split(internal.IntsToString(event.Reminders), ",")
+	v.Check(validator.Unique(reminders), "reminders", "must not contain duplicate values")
+	v.Check(len(event.Reminders) == 0 || !event.Start.IsZero(), "reminders", "requires the event to have a start date")
+
+	ValidatePlace(v, event.Place)
+}
+
+// Location returns the event's time zone, or UTC if
+// the time zone is not valid.
+func (event *Event) Location() *time.Location {
+	loc, err := internal.LoadTimeZone(event.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// In returns a copy of the event with its times
+// converted to loc for output. If loc is nil, the
+// event's own time zone is used. The start, end and
+// exdates of all day events are floating dates, so
+// they keep their date and are only moved to midnight
+// in loc, rather than being shifted.
+func (event *Event) In(loc *time.Location) *Event {
+	if loc == nil {
+		loc = event.Location()
+	}
+
+	convert := func(t time.Time) time.Time {
+		if t.IsZero() {
+			return t
+		}
+		if event.AllDay {
+			y, m, d := t.Date()
+			return time.Date(y, m, d, 0, 0, 0, 0, loc)
+		}
+		return t.In(loc)
+	}
+
+	converted := *event
+	converted.Start = convert(event.Start)
+	converted.End = convert(event.End)
+	if event.ExDates != nil {
+		converted.ExDates = make([]time.Time, len(event.ExDates))
+		for i, exdate := range event.ExDates {
+			converted.ExDates[i] = convert(exdate)
+		}
+	}
+	if event.OccurrenceStart != nil {
+		occurrenceStart := convert(*event.OccurrenceStart)
+		converted.OccurrenceStart = &occurrenceStart
+	}
+	converted.CreatedAt = event.CreatedAt.In(loc)
+	converted.UpdatedAt = event.UpdatedAt.In(loc)
+	if event.DeletedAt != nil {
+		deletedAt := event.DeletedAt.In(loc)
+		converted.DeletedAt = &deletedAt
+	}
+	return &converted
+}
+
+// FreeBusy returns a copy of the event for users who
+// may only see when a calendar is busy. The title is
+// replaced with "Busy", and the description, tags,
+// location and RSVP summary are removed.
+func (event *Event) FreeBusy() *Event {
+	busy := *event
+	busy.Title = "Busy"
+	busy.Description = ""
+	busy.Tags = nil
+	busy.Place = nil
+	busy.RSVP = nil
+	busy.Snippet = ""
+	return &busy
+}
+
+// recurrenceStart returns the start the recurrence rule
+// of the event is expanded from. Timed events repeat
+// at the same wall clock time in their own time zone,
+// across daylight saving changes. All day events float,
+// so they are expanded in UTC, where they are stored.
+func (event *Event) recurrenceStart() time.Time {
+	if event.AllDay {
+		return event.Start
+	}
+	return event.Start.In(event.Location())
+}
+
+// duration returns the length of an event. Events
+// without an end time, or with an end before the
+// start, have a zero duration.
+func (event *Event) duration() time.Duration {
+	if event.End.After(event.Start) {
+		return event.End.Sub(event.Start)
+	}
+	return 0
+}
+
+// interval returns the half-open interval [start, end)
+// that the event occupies. All day events occupy whole
+// days, from midnight on their start date to midnight
+// after their end date. Events without an end time, or
+// with an end before the start, occupy only the
+// instant they start.
+func (event *Event) interval() (time.Time, time.Time) {
+	start, end := event.Start, event.Start.Add(event.duration())
+	if event.AllDay {
+		start = truncateDay(start)
+		end = truncateDay(end).AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// truncateDay returns midnight at the start of the
+// day t falls on.
+func truncateDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// overlaps reports whether the event's interval
+// overlaps the half-open window [from, to). Events
+// occupying a single instant overlap when they start
+// inside the window.
+func (event *Event) overlaps(from, to time.Time) bool {
+	start, end := event.interval()
+	if !start.Before(to) {
+		return false
+	}
+	if start.Equal(end) {
+		return !start.Before(from)
+	}
+	return end.After(from)
+}
+
+// spanEnd returns the end of the interval occupied by
+// the event, or for a recurring event by its final
+// occurrence. It is stored so that GetAll() can find
+// events overlapping a window in SQL. nil is returned
+// for events that repeat forever.
+func (event *Event) spanEnd() interface{} {
+	if event.RRule == "" {
+		_, end := event.interval()
+		return end.UTC()
+	}
+	rule, err := rrule.Parse(event.RRule)
+	if err != nil {
+		return nil
+	}
+	last, ok := rule.Last(event.recurrenceStart())
+	if !ok {
+		return nil
+	}
+	occurrence := *event
+	occurrence.Start = last.UTC()
+	_, end := occurrence.interval()
+	return end.UTC()
+}
+
+// Occurrences expands an event into the occurrences
+// overlapping the window [from, to). A non-recurring
+// event is returned as is if it overlaps the window.
+// Each occurrence of a recurring event is a copy of
+// the event with its Start and End moved, and with
+// ParentID and OccurrenceStart set.
+func (event *Event) Occurrences(from, to time.Time) []*Event {
+	if event.RRule == "" {
+		if event.overlaps(from, to) {
+			return []*Event{event}
+		}
+		return nil
+	}
+
+	rule, err := rrule.Parse(event.RRule)
+	if err != nil {
+		return nil
+	}
+
+	// Occurrences starting up to one interval length
+	// before the window may still overlap it.
+	d := event.duration()
+	intervalStart, intervalEnd := event.interval()
+	starts := rule.Between(event.recurrenceStart(), from.Add(-intervalEnd.Sub(intervalStart)), to, event.ExDates)
+
+	occurrences := make([]*Event, 0, len(starts))
+	for i := range starts {
+		start := starts[i].UTC()
+		occurrence := *event
+		occurrence.ParentID = event.ID
+		occurrence.Start = start
+		occurrence.End = start.Add(d)
+		occurrence.OccurrenceStart = &start
+		if occurrence.overlaps(from, to) {
+			occurrences = append(occurrences, &occurrence)
+		}
+	}
+	return occurrences
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx,
+// so the same query code can run inside or outside a
+// transaction.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// rowScanner is satisfied by both *sql.Row and
+// *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanEvent scans a row selected with eventColumns
+// into an event. Any extra destinations are scanned
+// from the columns following eventColumns.
+func scanEvent(row rowScanner, event *Event, extra ...interface{}) error {
+	return scanEventFields(row, event, eventColumnFields, extra...)
+}
+
+// scanEventFields scans a row selecting only some of
+// the fields of an event, in the order of
+// eventColumnFields, into the event. Any extra
+// destinations are scanned from the columns after
+// them.
+func scanEventFields(row rowScanner, event *Event, fields []string, extra ...interface{}) error {
+	// The tags are selected, and the exdates and
+	// reminders are stored in the SQLite database, as
+	// comma-delimited strings. Events created before
+	// owners were added may have no owner or calendar,
+	// and events last changed before revisions were
+	// kept have no updated_by user. Only events in the
+	// trash have a deleted_at time, and only events
+	// with coordinates have a latitude and longitude.
+	var tags, exdates, reminders string
+	var userID, calendarID, updatedBy sql.NullInt64
+	var deletedAt sql.NullTime
+	var place Place
+	var latitude, longitude sql.NullFloat64
+
+	dest := make([]interface{}, 0, len(fields)+len(extra))
+	for _, field := range fields {
+		switch field {
+		case "id":
+			dest = append(dest, &event.ID)
+		case "user_id":
+			dest = append(dest, &userID)
+		case "calendar_id":
+			dest = append(dest, &calendarID)
+		case "uid":
+			dest = append(dest, &event.UID)
+		case "title":
+			dest = append(dest, &event.Title)
+		case "description":
+			dest = append(dest, &event.Description)
+		case "tags":
+			dest = append(dest, &tags)
+		case "all_day":
+			dest = append(dest, &event.AllDay)
+		case "start":
+			dest = append(dest, &event.Start)
+		case "end":
+			dest = append(dest, &event.End)
+		case "time_zone":
+			dest = append(dest, &event.TimeZone)
+		case "rrule":
+			dest = append(dest, &event.RRule)
+		case "exdates":
+			dest = append(dest, &exdates)
+		case "reminders":
+			dest = append(dest, &reminders)
+		case "location":
+			dest = append(dest, &place.Name, &place.Address, &latitude, &longitude)
+		case "created_at":
+			dest = append(dest, &event.CreatedAt)
+		case "updated_at":
+			dest = append(dest, &event.UpdatedAt)
+		case "updated_by":
+			dest = append(dest, &updatedBy)
+		case "deleted_at":
+			dest = append(dest, &deletedAt)
+		case "version":
+			dest = append(dest, &event.Version)
+		}
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return err
+	}
+
+	event.UserID = userID.Int64
+	event.CalendarID = calendarID.Int64
+	event.UpdatedBy = updatedBy.Int64
+	if deletedAt.Valid {
+		event.DeletedAt = &deletedAt.Time
+	}
+
+	// Convert tags, exdates and reminders to slices.
+	if tags != "" {
+		event.Tags = strings.Split(tags, ",")
+	}
+	event.ExDates = internal.StringToTimes(exdates)
+	event.Reminders = internal.StringToInts(reminders)
+
+	// Events without a place have no location.
+	if latitude.Valid && longitude.Valid {
+		place.Latitude, place.Longitude = &latitude.Float64, &longitude.Float64
+	}
+	if !place.isZero() {
+		event.Place = &place
+	}
+
+	return nil
+}
+
+// AssignOwner makes the user the owner of every event
+// which has no owner, returning the number of events
+// assigned. Events created before events had owners
+// have none until they are assigned. In a single
+// transaction, the events are moved to the user's
+// default calendar, and their tags, which belonged to
+// user 0, become the user's tags, merged with any the
+// user already has of the same name. Once every event
+// has an owner, it does nothing.
+func (e EventModel) AssignOwner(userID int64) (int64, error) {
+	// Create a context with a 30 second timeout, since
+	// there may be many events.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := e.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	calendar, err := getDefaultCalendar(ctx, tx, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.ExecContext(
+		ctx,
+		`UPDATE events SET user_id = ?, calendar_id = ? WHERE user_id IS NULL`,
+		userID,
+		calendar.ID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	assigned, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	// Move the events from tags of user 0 to the user's
+	// tags of the same name, and remove the tags left
+	// unused. The names are unchanged, so the full-text
+	// index is not affected.
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE event_tags SET tag_id = (
+			SELECT t.id FROM tags t
+			INNER JOIN tags z
+			ON z.name = t.name
+			WHERE z.id = event_tags.tag_id AND t.user_id = ?
+		)
+		WHERE tag_id IN (
+			SELECT z.id FROM tags z
+			INNER JOIN tags t
+			ON t.name = z.name
+			WHERE z.user_id = 0 AND t.user_id = ?
+		)`,
+		userID,
+		userID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(
+		ctx,
+		`DELETE FROM tags
+		WHERE user_id = 0
+		AND NOT EXISTS (SELECT 1 FROM event_tags WHERE tag_id = tags.id)`,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	// The remaining tags of user 0 have names the user
+	// doesn't have, so they become the user's.
+	_, err = tx.ExecContext(ctx, `UPDATE tags SET user_id = ? WHERE user_id = 0`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return assigned, tx.Commit()
 }
 
-// Insert a new record into the events table.
+// Insert a new record into the events table, and
+// its tags, in a single transaction.
 func (e EventModel) Insert(event *Event) error {
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Begin the transaction. Rollback() is a no-op once
+	// the transaction has been committed.
+	tx, err := e.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertEvent(ctx, tx, event)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// insertEvent inserts a new record into the events
+// table, and its tags, using q, which may be the
+// connection pool or a transaction. Events without a
+// UID are given a new random UID.
+func insertEvent(ctx context.Context, q querier, event *Event) error {
+	if event.UID == "" {
+		uid, err := generateEventUID()
+		if err != nil {
+			return err
+		}
+		event.UID = uid
+	}
+
+	// An event with an empty place has no location.
+	if event.Place.isZero() {
+		event.Place = nil
+	}
+
 	// Define the SQL query for inserting a new record
 	// in the events table, returning the system
 	// generated data.
 	query := `
-		INSERT INTO events (title, description, tags, all_day, start, end, created_at, updated_at, version)
-		VALUES (?, ? ,?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO events (user_id, calendar_id, uid, title, description, all_day, start, end, time_zone, rrule, exdates, reminders, location_name, location_address, latitude, longitude, span_end, created_at, updated_at, updated_by, version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?)
 		RETURNING id, created_at, updated_at, version;
 	`
 
 	// Create an arguments slice containing the values
 	// for the placeholder parameters.
+	name, address, latitude, longitude := event.Place.columns()
 	args := []interface{}{
-		event.Title,                        // title - string
-		event.Description,                  // description - string
-		internal.SliceToString(event.Tags), // tags - string
-		event.AllDay,                       // all_day - boolean
-		event.Start,                        // start - convert from Go time to string
-		event.End,                          // end - convert from Go time to string
-		time.Now(),                         // created_at - convert from Go time to string
-		time.Now(),                         // updated_at - convert from Go time to string
-		1,                                  // version - starts with 1
+		event.UserID,                           // user_id - int64
+		event.CalendarID,                       // calendar_id - int64
+		event.UID,                              // uid - string
+		event.Title,                            // title - string
+		event.Description,                      // description - string
+		event.AllDay,                           // all_day - boolean
+		event.Start,                            // start - convert from Go time to string
+		event.End,                              // end - convert from Go time to string
+		event.TimeZone,                         // time_zone - string
+		event.RRule,                            // rrule - string
+		internal.TimesToString(event.ExDates),  // exdates - string
+		internal.IntsToString(event.Reminders), // reminders - string
+		name,                                   // location_name - string
+		address,                                // location_address - string
+		latitude,                               // latitude - float64 or nil
+		longitude,                              // longitude - float64 or nil
+		event.spanEnd(),                        // span_end - Go time or nil
+		internal.CurrentDate(),                 // created_at - convert from Go time to string
+		internal.CurrentDate(),                 // updated_at - convert from Go time to string
+		event.UpdatedBy,                        // updated_by - int64, NULL if 0
+		1,                                      // version - starts with 1
 	}
 
-	// Create a context with a 3 second timeout and defer.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	// Use QueryRowContext() method to execute the SQL query
 	// passing in the context, query, and args slice.
 	// Scan in the returning values to the event struct.
-	return e.DB.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt, &event.UpdatedAt, &event.Version)
+	err := q.QueryRowContext(ctx, query, args...).Scan(&event.ID, &event.CreatedAt, &event.UpdatedAt, &event.Version)
+	if err != nil {
+		return err
+	}
+
+	return setEventTags(ctx, q, event)
+}
+
+// generateEventUID returns a new random UID for an
+// event, in the "<random>@greenlight" form used by the
+// iCalendar UID property.
+func generateEventUID() (string, error) {
+	randomBytes := make([]byte, 16)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(randomBytes) + "@greenlight", nil
 }
 
 // Get fetches a specific record by ID from events table.
-func (e EventModel) Get(id int64) (*Event, error) {
+// If ownerID is not 0, only an event owned by that user
+// is returned. Events in the trash are not returned.
+func (e EventModel) Get(id int64, ownerID int64) (*Event, error) {
 	// Check that ID is not less than 1
 	if id < 1 {
 		return nil, ErrRecordNotFound
@@ -105,19 +698,16 @@ func (e EventModel) Get(id int64) (*Event, error) {
 
 	// Define the SQL query for retrieving event data
 	query := `
-		SELECT *
+		SELECT ` + eventColumns + `
 		FROM events
 		WHERE id = ?
+		AND deleted_at IS NULL
+		AND (? = 0 OR user_id = ?)
 	`
 
 	// Declare an Event struct to hold returned data
 	var event Event
 
-	// Declare a tag string variable to hold returned
-	// tags value. The tags are stored in the SQLite
-	// database as a comma-delimited string.
-	var tags string
-
 	// Use the context.WithTimeout() function to create
 	// a context.Context which carries a 3 second
 	// timeout deadline. Use the empty context.Background
@@ -129,24 +719,10 @@ func (e EventModel) Get(id int64) (*Event, error) {
 	defer cancel()
 
 	// Execute the query with the QueryRowContext() method,
-	// passing the  context with deadline and ID.
+	// passing the  context with deadline, ID and owner.
 	// Scan the response data into the fields of the
-	// Event struct and tag variable.
-	err := e.DB.QueryRowContext(ctx, query, id).Scan(
-		&event.ID,
-		&event.Title,
-		&event.Description,
-		&tags,
-		&event.AllDay,
-		&event.Start,
-		&event.End,
-		&event.CreatedAt,
-		&event.UpdatedAt,
-		&event.Version,
-	)
-
-	// Convert tags to slice and add to event.Tags struct
-	event.Tags = strings.Split(tags, ",")
+	// Event struct.
+	err := scanEvent(e.DB.QueryRowContext(ctx, query, id, ownerID, ownerID), &event)
 
 	// If no matching event found, Scan() returns an
 	// sql.ErrNoRows error. Check and return custom
@@ -164,49 +740,215 @@ func (e EventModel) Get(id int64) (*Event, error) {
 	return &event, nil
 }
 
+// GetFields fetches a specific record by ID from the
+// events table, selecting only the columns of a sparse
+// fieldset, and those needed to check access to it, as
+// listed by showColumnFields(). The other fields are
+// left empty. Events in the trash are not returned.
+func (e EventModel) GetFields(id int64, fields []string) (*Event, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	columnFields := showColumnFields(fields)
+	query := `
+		SELECT ` + selectColumns(columnFields) + `
+		FROM events
+		WHERE id = ?
+		AND deleted_at IS NULL
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var event Event
+
+	err := scanEventFields(e.DB.QueryRowContext(ctx, query, id), &event, columnFields)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &event, nil
+}
+
+// getEvents fetches the records with the IDs from the
+// events table using q, which may be the connection
+// pool or a transaction, in the order of their IDs.
+// Events in the trash are returned too.
+func getEvents(ctx context.Context, q querier, ids []int64) ([]*Event, error) {
+	events := []*Event{}
+	if len(ids) == 0 {
+		return events, nil
+	}
+
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events
+		WHERE id IN (` + placeholders(len(ids)) + `)
+		ORDER BY id
+	`
+
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event Event
+
+		err := scanEvent(rows, &event)
+		if err != nil {
+			return nil, err
+		}
+
+		events = append(events, &event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// queryEventIDs runs a query selecting the IDs of
+// events, or an UPDATE with a RETURNING id clause,
+// using q, which may be the connection pool or a
+// transaction, and returns the IDs.
+func queryEventIDs(ctx context.Context, q querier, query string, args ...interface{}) ([]int64, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+
+		err := rows.Scan(&id)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
 // Update updates a specific record by ID in
-// the events table.
-func (e EventModel) Update(event *Event) error {
+// the events table, and its tags, in a single
+// transaction. If ownerID is not 0, only an event
+// owned by that user is updated.
+func (e EventModel) Update(event *Event, ownerID int64) error {
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Begin the transaction. Rollback() is a no-op once
+	// the transaction has been committed.
+	tx, err := e.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = updateEvent(ctx, tx, event, ownerID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateEvent updates a specific record by ID in the
+// events table, and its tags, using q, which may be
+// the connection pool or a transaction. If ownerID is
+// not 0, only an event owned by that user is updated.
+func updateEvent(ctx context.Context, q querier, event *Event, ownerID int64) error {
+	// An event with an empty place has no location.
+	if event.Place.isZero() {
+		event.Place = nil
+	}
+
 	// Define the SQL query to update event
 	query := `
 		UPDATE events
 		SET 
+		user_id = ?,
+		calendar_id = ?,
 		title = ?, 
 		description = ?, 
-		tags = ?, 
 		all_day = ?,
 		start = ?,
 		end = ?,
+		time_zone = ?,
+		rrule = ?,
+		exdates = ?,
+		reminders = ?,
+		location_name = ?,
+		location_address = ?,
+		latitude = ?,
+		longitude = ?,
+		span_end = ?,
 		updated_at = ?,
+		updated_by = NULLIF(?, 0),
+		deleted_at = NULL,
 		version = version + 1
 		WHERE id = ? AND version = ?
+		AND (? = 0 OR user_id = ?)
 		RETURNING version
 	`
 
 	// Create a args slice containing the values for the
 	// placeholder parameters.
+	name, address, latitude, longitude := event.Place.columns()
 	args := []interface{}{
+		event.UserID,
+		event.CalendarID,
 		event.Title,
 		event.Description,
-		internal.SliceToString(event.Tags),
 		event.AllDay,
 		event.Start,
 		event.End,
+		event.TimeZone,
+		event.RRule,
+		internal.TimesToString(event.ExDates),
+		internal.IntsToString(event.Reminders),
+		name,
+		address,
+		latitude,
+		longitude,
+		event.spanEnd(),
 		internal.CurrentDate(),
+		event.UpdatedBy,
 		event.ID,
 		event.Version,
+		ownerID,
+		ownerID,
 	}
 
-	// Create a context with a 3 second timeout and defer.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	// Use QueryRowContext() method to execute query.
 	// Pass the context, query, and args slice as paramters
 	// and scan the new version into the event struct.
 	// If no row is found, the  event has been deleted or
 	// the version has changed, indicating a race condition.
-	err := e.DB.QueryRowContext(ctx, query, args...).Scan(&event.Version)
+	// The event is never found for another owner, since
+	// it is fetched with the same owner before updating.
+	err := q.QueryRowContext(ctx, query, args...).Scan(&event.Version)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -215,31 +957,147 @@ func (e EventModel) Update(event *Event) error {
 			return err
 		}
 	}
-	return nil
+
+	return setEventTags(ctx, q, event)
+}
+
+// Define the errors of an imported event which can't
+// be imported, since its owner has an event with the
+// same UID which the import doesn't replace:
+//  1. ErrUIDInTrash: the event is in the trash
+//  2. ErrUIDInOtherCalendar: the event is in another
+//     calendar than the one imported into
+var (
+	ErrUIDInTrash         = errors.New("an event with the same uid is in the trash")
+	ErrUIDInOtherCalendar = errors.New("an event with the same uid is in another calendar")
+)
+
+// ImportedEvent struct holds one event of an import.
+// Fields:
+// 1.		Event: Event to insert, or to update the event with its UID
+// 2.		Created: Whether the event was inserted rather than updated
+// 3.		Err: ErrUIDInTrash or ErrUIDInOtherCalendar, if it was not imported
+type ImportedEvent struct {
+	Event   *Event
+	Created bool
+	Err     error
 }
 
-// Delete deletes a specific record by ID from
-// the events table.
-func (e EventModel) Delete(id int64) error {
+// Import inserts or updates a batch of events in a
+// single transaction. An event whose UID matches an
+// existing event of the same owner in the same
+// calendar replaces that event's details and
+// increments its version, so importing the same
+// calendar twice does not create duplicates. An event
+// whose UID matches one of the owner's events in the
+// trash, or in another calendar, is not imported, and
+// its Err is set, so an import can only change the
+// calendar it is made into. If any statement fails,
+// the whole import is rolled back.
+func (e EventModel) Import(imports []*ImportedEvent) error {
+	// Create a context with a 30 second timeout, since
+	// a calendar may contain many events.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Begin the transaction. Rollback() is a no-op once
+	// the transaction has been committed.
+	tx, err := e.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, imported := range imports {
+		event := imported.Event
+
+		// Look for an existing event with the same UID
+		// and owner. UIDs are unique for each owner.
+		var id int64
+		var calendarID sql.NullInt64
+		var createdAt time.Time
+		var version int32
+		var deleted bool
+		err := tx.QueryRowContext(
+			ctx,
+			`SELECT id, calendar_id, created_at, version, deleted_at IS NOT NULL
+			FROM events WHERE uid = ? AND user_id = ?`,
+			event.UID,
+			event.UserID,
+		).Scan(&id, &calendarID, &createdAt, &version, &deleted)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			err = insertEvent(ctx, tx, event)
+			imported.Created = true
+		case deleted:
+			imported.Err = ErrUIDInTrash
+		case calendarID.Int64 != event.CalendarID:
+			imported.Err = ErrUIDInOtherCalendar
+		default:
+			event.ID = id
+			event.CreatedAt = createdAt
+			event.Version = version
+			err = updateEvent(ctx, tx, event, event.UserID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Delete moves a specific record by ID in the events
+// table to the trash, from where it can be restored
+// until it is purged. If ownerID is not 0, only an
+// event owned by that user is deleted. The userID is
+// the user deleting the event. If version is not 0,
+// the event is only deleted at that version, and an
+// ErrEditConflict error is returned if it has changed.
+func (e EventModel) Delete(id int64, ownerID int64, userID int64, version int32) error {
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return deleteEvent(ctx, e.DB, id, ownerID, userID, version)
+}
+
+// deleteEvent moves a specific record by ID in the
+// events table to the trash, using q, which may be the
+// connection pool or a transaction. If version is not
+// 0, the event is only deleted at that version, and an
+// ErrEditConflict error is returned if it has changed.
+func deleteEvent(ctx context.Context, q querier, id, ownerID, userID int64, version int32) error {
 	// Return an ErrRecordNotFound error if event ID
 	// is less than 1
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
-	// Build SQL query
+	// Build SQL query. The version is incremented, since
+	// the event changed.
 	query := `
-		DELETE FROM events
+		UPDATE events
+		SET
+		deleted_at = ?,
+		updated_at = ?,
+		updated_by = NULLIF(?, 0),
+		version = version + 1
 		WHERE id = ?
+		AND deleted_at IS NULL
+		AND (? = 0 OR user_id = ?)
+		AND (? = 0 OR version = ?)
 	`
 
-	// Create a context with a 3 second timeout and defer.
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
 	// Execute the query using the Exec() method, passing
-	// in the context, query, and ID.
-	result, err := e.DB.ExecContext(ctx, query, id)
+	// in the context, deletion time, user, ID, owner and
+	// version.
+	now := internal.CurrentDate()
+	result, err := q.ExecContext(ctx, query, now, now, userID, id, ownerID, ownerID, version, version)
 	if err != nil {
 		return err
 	}
@@ -252,37 +1110,99 @@ func (e EventModel) Delete(id int64) error {
 	}
 
 	// If no rows affected, the events table did not
-	// contain a record with the ID. Return an
-	// ErrRecordNotFound error.
+	// contain a record with the ID for the owner, or at
+	// the version. Return an ErrRecordNotFound or
+	// ErrEditConflict error.
 	if rowsAffected == 0 {
+		if version != 0 {
+			return ErrEditConflict
+		}
 		return ErrRecordNotFound
 	}
 
 	return nil
 }
 
-// GetAll() method returns a slice of events.
+// GetAll() method returns a slice of events. If
+// ownerID is not 0, only events owned by that user, or
+// in calendars shared with them, are returned. If the
+// filters contain a from/to window, recurring events
+// are expanded into their occurrences inside it. If
+// the filters contain a search query, only matching
+// events are returned, with a highlighted snippet, and
+// an ErrInvalidSearch error is returned if the query
+// has invalid syntax.
 func (e EventModel) GetAll(
+	ownerID int64,
 	title string,
 	description string,
 	tags []string,
 	filters Filters,
 ) ([]*Event, Metadata, error) {
-	// Build the SQL query to get all event records
+	// Expanded occurrences don't exist as rows, so
+	// a windowed request is paginated in Go instead
+	// of in SQL.
+	if filters.hasWindow() {
+		return e.getAllInWindow(ownerID, title, description, tags, filters)
+	}
+
+	// Build the FROM and WHERE clauses from the search
+	// values and filters.
+	source, sourceArgs := eventSource(filters)
+	where, whereArgs := eventWhere(ownerID, title, description, tags, filters)
+
+	// Only select the fields of a sparse fieldset, and
+	// the ones needed to sort and page the events.
+	fields := filters.columnFields()
+
+	// A page after or before a cursor is selected with
+	// a condition on the sort column and id, rather
+	// than an offset. A page before a cursor is selected
+	// in reverse order, and put back in order below.
+	key, err := filters.cursorKey()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	backward := filters.Before != ""
+	pageWhere, pageArgs := where, whereArgs
+	offset := filters.offset()
+	if key != nil {
+		condition, args := keysetCondition(key, filters, backward)
+		pageWhere += "\n\t\tAND " + condition
+		pageArgs = append(append([]interface{}{}, whereArgs...), args...)
+		offset = 0
+	}
+	direction, idDirection := filters.sortDirection(), "ASC"
+	if backward {
+		direction, idDirection = reverseDirection(direction), "DESC"
+	}
+
+	// Count the total number of records with a window
+	// function, if it was requested. A cursor page only
+	// sees the records after its cursor, so its total is
+	// counted by a separate query below.
+	countColumn := "0"
+	if filters.Count && key == nil {
+		countColumn = "COUNT (*) OVER()"
+	}
+
+	// Build the SQL query to get all event records. One
+	// record more than the page size is selected, to
+	// tell whether there are records after the page.
 	query := fmt.Sprintf(`
-		SELECT COUNT (*) OVER(), *
-		FROM events
-		WHERE (
-			INSTR(LOWER(title), LOWER(?)) 
-			OR ? = ''
-		)
-		AND INSTR(LOWER(description), LOWER(?))
-		AND INSTR(tags, ?) 
-		ORDER BY %s %s, id ASC
+		SELECT %s, distance, relevance, snippet, %s
+		FROM %s
+		WHERE %s
+		ORDER BY %s %s, id %s
 		LIMIT ? OFFSET ?
 	`,
+		selectColumns(fields),
+		countColumn,
+		source,
+		pageWhere,
 		filters.sortColumn(),
-		filters.sortDirection(),
+		direction,
+		idDirection,
 	)
 
 	// Create a context with 3 second timeout
@@ -291,27 +1211,26 @@ func (e EventModel) GetAll(
 
 	// Put all placeholder parameters in a slice.
 	// Placeholder Paramters:
-	//	1.	title: title passed in to function (used twice)
-	//	2.	title: title passed in to function (used twice)
-	//	3.	description: description passed in to function
-	//	4.	tags: convert tag slice passed in to string
-	//	5.	limit: the limit of records from filter
-	//	6.	offset: the offset from filter
-	args := []interface{}{
-		title,
-		title,
-		description,
-		internal.SliceToString(tags),
-		filters.limit(),
-		filters.offset(),
-	}
+	//	1.	source: radius search center and full-text
+	//			search query
+	//	2.	where: search values, filters and cursor
+	//	3.	limit: the limit of records from filter,
+	//			plus one
+	//	4.	offset: the offset from filter, or 0 after
+	//			a cursor
+	args := append(append([]interface{}{}, sourceArgs...), pageArgs...)
+	args = append(
+		args,
+		filters.limit()+1,
+		offset,
+	)
 
 	// Use QueryContext() method to execute the query.
 	// An sql.Rows result set is returned containing
 	// the result.
 	rows, err := e.DB.QueryContext(ctx, query, args...)
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, searchError(err, filters)
 	}
 
 	// Defer a call to rows.Close()
@@ -330,32 +1249,15 @@ func (e EventModel) GetAll(
 		// each event
 		var event Event
 
-		// Initialize an empty Tag slice to hold
-		// event tags
-		var tags string
-
-		// Scan values into movie struct.
-		err := rows.Scan(
-			&totalRecords,
-			&event.ID,
-			&event.Title,
-			&event.Description,
-			&tags,
-			&event.AllDay,
-			&event.Start,
-			&event.End,
-			&event.CreatedAt,
-			&event.UpdatedAt,
-			&event.Version,
-		)
-
-		// Convert tags to slice and add to event.Tags
-		// struct
-		event.Tags = strings.Split(tags, ",")
-
+		// Scan values into event struct, followed by
+		// the distance, the search relevance and snippet,
+		// and the total record count.
+		var distance float64
+		err := scanEventFields(rows, &event, fields, &distance, &event.relevance, &event.Snippet, &totalRecords)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
+		event.setDistance(distance, filters)
 
 		// Add Event struct to the events slice
 		events = append(events, &event)
@@ -364,21 +1266,458 @@ func (e EventModel) GetAll(
 	// After rows.Next() loop is finished, call rows.Err()
 	// to get any error encountered during loop.
 	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
+		return nil, Metadata{}, searchError(err, filters)
+	}
+
+	// Count the records of a cursor page, if requested.
+	if filters.Count && key != nil {
+		query := fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s`, source, where)
+		args := append(append([]interface{}{}, sourceArgs...), whereArgs...)
+		err = e.DB.QueryRowContext(ctx, query, args...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, searchError(err, filters)
+		}
+	}
+
+	// Drop the extra record, and put a page before a
+	// cursor back in order.
+	more := len(events) > filters.limit()
+	if more {
+		events = events[:filters.limit()]
+	}
+	if backward {
+		for i, j := 0, len(events)-1; i < j; i, j = i+1, j-1 {
+			events[i], events[j] = events[j], events[i]
+		}
 	}
 
 	// Generate a Metadata struct, passing in total
 	// record count and pagination parameters
-	metadata := calculateMetadata(
-		totalRecords,
-		filters.Page,
-		filters.PageSize,
-	)
+	metadata := pageMetadata(events, totalRecords, more, filters)
 
 	// If everything goes OK, return slice of events.
 	return events, metadata, nil
 }
 
+// eventWhere builds the WHERE clause shared by the
+// GetAll() queries, and its placeholder parameters.
+// Events in the trash are never matched, and events
+// always match on title and description. The
+// remaining conditions are only added for the owner,
+// tags and filters that were requested:
+//  1. tags: has every tag, or with the "any" tags mode
+//     at least one of them
+//  2. ownerID: owned by the user, or in a calendar
+//     shared with them as a viewer or above, unless it
+//     is 0
+//  3. from/to: the event, or for a recurring event
+//     its series, overlaps the window
+//  4. all_day: whether the event lasts all day
+//  5. created_after: created after the time
+//  6. updated_since: updated at or after the time
+//  7. calendar_id: belongs to the calendar
+//  8. near/radius_km: has coordinates within the
+//     radius of the center, selected first by a
+//     bounding box which can use the coordinates index
+func eventWhere(
+	ownerID int64,
+	title string,
+	description string,
+	tags []string,
+	filters Filters,
+) (string, []interface{}) {
+	conditions := []string{
+		"deleted_at IS NULL",
+		"(INSTR(LOWER(title), LOWER(?)) OR ? = '')",
+		"INSTR(LOWER(description), LOWER(?))",
+	}
+	args := []interface{}{
+		title,
+		title,
+		description,
+	}
+
+	// Tags are matched by name, so duplicates in the
+	// list are ignored.
+	var names []interface{}
+	for _, tag := range tags {
+		if tag != "" && !containsTag(names, tag) {
+			names = append(names, tag)
+		}
+	}
+	if len(names) > 0 {
+		condition := `id IN (
+			SELECT et.event_id FROM event_tags et
+			INNER JOIN tags t
+			ON t.id = et.tag_id
+			WHERE t.name IN (` + placeholders(len(names)) + `)`
+		args = append(args, names...)
+
+		if filters.TagsMode != TagsModeAny {
+			condition += `
+			GROUP BY et.event_id
+			HAVING COUNT(*) = ?`
+			args = append(args, len(names))
+		}
+		conditions = append(conditions, condition+")")
+	}
+
+	if ownerID != 0 {
+		conditions = append(conditions, `(user_id = ? OR calendar_id IN (
+			SELECT calendar_id FROM calendar_shares
+			WHERE user_id = ? AND role <> ?
+		))`)
+		args = append(args, ownerID, ownerID, RoleFreeBusy)
+	}
+
+	// span_end is the end of the event's interval, or
+	// of the final occurrence of a recurring event. It
+	// is NULL for events that repeat forever. Events
+	// occupying a single instant have a span_end equal
+	// to their start, and overlap the window if they
+	// start inside it.
+	if filters.hasWindow() {
+		conditions = append(conditions, `start < ? AND (
+			span_end IS NULL
+			OR span_end > ?
+			OR (span_end = start AND start >= ?)
+		)`)
+		args = append(args, filters.To.UTC(), filters.From.UTC(), filters.From.UTC())
+	}
+
+	if filters.AllDay != nil {
+		conditions = append(conditions, "all_day = ?")
+		args = append(args, *filters.AllDay)
+	}
+
+	if !filters.CreatedAfter.IsZero() {
+		conditions = append(conditions, "created_at > ?")
+		args = append(args, filters.CreatedAfter.UTC())
+	}
+
+	if !filters.UpdatedSince.IsZero() {
+		conditions = append(conditions, "updated_at >= ?")
+		args = append(args, filters.UpdatedSince.UTC())
+	}
+
+	if filters.CalendarID != 0 {
+		conditions = append(conditions, "calendar_id = ?")
+		args = append(args, filters.CalendarID)
+	}
+
+	// The bounding box is inexact, so the distance is
+	// checked as well. A box crossing the 180th meridian
+	// wraps around, with minLng greater than maxLng.
+	if filters.Near != nil {
+		minLat, maxLat, minLng, maxLng := boundingBox(*filters.Near, filters.RadiusKm)
+		conditions = append(conditions, "latitude BETWEEN ? AND ?")
+		args = append(args, minLat, maxLat)
+		if minLng <= maxLng {
+			conditions = append(conditions, "longitude BETWEEN ? AND ?")
+		} else {
+			conditions = append(conditions, "(longitude >= ? OR longitude <= ?)")
+		}
+		args = append(args, minLng, maxLng)
+
+		conditions = append(conditions, "distance <= ?")
+		args = append(args, filters.RadiusKm)
+	}
+
+	return strings.Join(conditions, "\n\t\tAND "), args
+}
+
+// containsTag reports whether a tag name is in names.
+func containsTag(names []interface{}, tag string) bool {
+	for _, name := range names {
+		if name == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// eventSource builds the FROM clause shared by the
+// GetAll() queries, and its placeholder parameters.
+// It adds a distance, a relevance and a snippet
+// column. If the filters contain a radius search, the
+// distance of each event from its center is computed,
+// and if they contain a search query, the events are
+// joined to their matches in the events_fts full-text
+// index:
+//  1. distance: the great-circle distance in
+//     kilometres, NULL for events without coordinates
+//  2. relevance: the bm25() score, weighting matches
+//     in the title above the tags and description
+//  3. snippet: the best matching text, with the
+//     matching terms wrapped in <mark> tags
+func eventSource(filters Filters) (string, []interface{}) {
+	distance, args := "0", []interface{}{}
+	if filters.Near != nil {
+		distance = "distance_km(latitude, longitude, ?, ?)"
+		args = append(args, filters.Near.Latitude, filters.Near.Longitude)
+	}
+
+	if filters.Search == "" {
+		return `(SELECT *, ` + distance + ` AS distance, 0 AS relevance, '' AS snippet FROM events) AS events`, args
+	}
+
+	return `(SELECT *, ` + distance + ` AS distance FROM events) AS events
+		INNER JOIN (
+			SELECT
+			rowid AS match_id,
+			bm25(events_fts, 10.0, 1.0, 5.0) AS relevance,
+			snippet(events_fts, -1, '<mark>', '</mark>', '…', 12) AS snippet
+			FROM events_fts
+			WHERE events_fts MATCH ?
+		) ON match_id = id`, append(args, filters.Search)
+}
+
+// searchError returns an ErrInvalidSearch error in
+// place of the error SQLite returns for a full-text
+// search query with invalid syntax, such as an
+// unterminated phrase or an unknown column filter.
+func searchError(err error, filters Filters) error {
+	if filters.Search == "" {
+		return err
+	}
+
+	for _, prefix := range []string{"fts5:", "unterminated string", "no such column:", "unknown special query:"} {
+		if strings.HasPrefix(err.Error(), prefix) {
+			return ErrInvalidSearch
+		}
+	}
+	return err
+}
+
+// getAllInWindow returns the events and expanded
+// occurrences overlapping the from/to window in the
+// filters, sorted and paginated in Go.
+func (e EventModel) getAllInWindow(
+	ownerID int64,
+	title string,
+	description string,
+	tags []string,
+	filters Filters,
+) ([]*Event, Metadata, error) {
+	// Select the events, and the series of recurring
+	// events, overlapping the window.
+	source, args := eventSource(filters)
+	where, whereArgs := eventWhere(ownerID, title, description, tags, filters)
+	fields := filters.columnFields()
+	query := fmt.Sprintf(`
+		SELECT %s, distance, relevance, snippet
+		FROM %s
+		WHERE %s
+	`,
+		selectColumns(fields),
+		source,
+		where,
+	)
+	args = append(args, whereArgs...)
+
+	// Create a context with 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, searchError(err, filters)
+	}
+	defer rows.Close()
+
+	// Expand each row into its occurrences.
+	events := []*Event{}
+	for rows.Next() {
+		var event Event
+
+		var distance float64
+		err := scanEventFields(rows, &event, fields, &distance, &event.relevance, &event.Snippet)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		event.setDistance(distance, filters)
+
+		events = append(events, event.Occurrences(filters.From, filters.To)...)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, searchError(err, filters)
+	}
+
+	// Sort the occurrences and cut out the requested
+	// page, by its offset or its cursor.
+	sortEvents(events, filters)
+
+	key, err := filters.cursorKey()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	var first, last int
+	switch {
+	case key != nil && filters.Before != "":
+		last = sort.Search(len(events), func(i int) bool {
+			return !eventBefore(events[i], key, filters)
+		})
+		first = last - filters.limit()
+		if first < 0 {
+			first = 0
+		}
+	case key != nil:
+		first = sort.Search(len(events), func(i int) bool {
+			return eventBefore(key, events[i], filters)
+		})
+		last = first + filters.limit()
+	default:
+		first = filters.offset()
+		if first > len(events) {
+			first = len(events)
+		}
+		last = first + filters.limit()
+	}
+	if last > len(events) {
+		last = len(events)
+	}
+
+	// There are more records in the direction the page
+	// was read in if it doesn't reach the end of the
+	// list, or the start for a page before a cursor.
+	more := last < len(events)
+	if filters.Before != "" {
+		more = first > 0
+	}
+	metadata := pageMetadata(events[first:last], len(events), more, filters)
+
+	return events[first:last], metadata, nil
+}
+
+// pageMetadata returns the pagination metadata of a
+// page of events. more reports whether there are
+// records after the page, or before it for a page
+// before a cursor. The page number and last page are
+// only set for a page requested by number, and the
+// last page and total only if they were counted.
+func pageMetadata(events []*Event, totalRecords int, more bool, filters Filters) Metadata {
+	cursor := filters.After != "" || filters.Before != ""
+
+	var metadata Metadata
+	switch {
+	case filters.Count && !cursor:
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	case filters.Count:
+		metadata = Metadata{PageSize: filters.PageSize, TotalRecords: totalRecords}
+	case !cursor:
+		metadata = Metadata{CurrentPage: filters.Page, PageSize: filters.PageSize, FirstPage: 1}
+	default:
+		metadata = Metadata{PageSize: filters.PageSize}
+	}
+
+	// Take the cursors of the events at either end of
+	// the page. An empty page keeps the cursor it was
+	// requested with.
+	first, last := filters.After, filters.Before
+	if len(events) > 0 {
+		first = encodeCursor(events[0], filters)
+		last = encodeCursor(events[len(events)-1], filters)
+	}
+
+	hasNext, hasPrev := more, filters.Page > 1 || filters.After != ""
+	if filters.Before != "" {
+		hasNext, hasPrev = true, more
+	}
+	if hasNext {
+		metadata.NextCursor = last
+	}
+	if hasPrev {
+		metadata.PrevCursor = first
+	}
+
+	return metadata
+}
+
+// reverseDirection returns the opposite of a sort
+// direction, "ASC" or "DESC".
+func reverseDirection(direction string) string {
+	if direction == "DESC" {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+// sortEvents sorts events in place by the sort column
+// and direction in the filters, in the same way as the
+// "ORDER BY <column> <direction>, id ASC" clause used
+// in SQL. Occurrences of the same event are kept in
+// start order.
+func sortEvents(events []*Event, filters Filters) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return eventBefore(events[i], events[j], filters)
+	})
+}
+
+// eventBefore reports whether event a comes before
+// event b in the sort order of sortEvents().
+func eventBefore(a, b *Event, filters Filters) bool {
+	c := compareEventColumn(a, b, filters.sortColumn())
+	if filters.sortDirection() == "DESC" {
+		c = -c
+	}
+	if c != 0 {
+		return c < 0
+	}
+	if a.ID != b.ID {
+		return a.ID < b.ID
+	}
+	return a.Start.Before(b.Start)
+}
+
+// compareEventColumn compares two events on a sort
+// column, returning -1, 0 or +1.
+func compareEventColumn(a, b *Event, column string) int {
+	switch column {
+	case "title":
+		return strings.Compare(a.Title, b.Title)
+	case "all_day":
+		switch {
+		case a.AllDay == b.AllDay:
+			return 0
+		case b.AllDay:
+			return -1
+		default:
+			return 1
+		}
+	case "start":
+		return a.Start.Compare(b.Start)
+	case "end":
+		return a.End.Compare(b.End)
+	case "relevance":
+		return compareFloat(a.relevance, b.relevance)
+	case "distance":
+		return compareFloat(a.distance(), b.distance())
+	default:
+		switch {
+		case a.ID < b.ID:
+			return -1
+		case a.ID > b.ID:
+			return 1
+		default:
+			return 0
+		}
+	}
+}
+
+// compareFloat compares two numbers, returning -1, 0
+// or +1.
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
 // calculateMetadata() function calculates the
 // appropriate pagination metadata values given:
 //  1. Total number of records
@@ -0,0 +1,219 @@
+package data
+
+import (
+	"strings"
+
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+// EventFields lists the fields of an event a client
+// may request with a sparse fieldset, in the order
+// they are written in the full event.
+var EventFields = []string{
+	"id",
+	"user_id",
+	"calendar_id",
+	"uid",
+	"title",
+	"description",
+	"tags",
+	"all_day",
+	"start",
+	"end",
+	"time_zone",
+	"rrule",
+	"exdates",
+	"reminders",
+	"location",
+	"distance_km",
+	"parent_id",
+	"occurrence_start",
+	"rsvp",
+	"snippet",
+	"created_at",
+	"updated_at",
+	"updated_by",
+	"deleted_at",
+	"version",
+}
+
+// eventColumnFields lists the fields of an event read
+// from the columns of the events table, in the order
+// of eventColumns.
+var eventColumnFields = []string{
+	"id",
+	"user_id",
+	"calendar_id",
+	"uid",
+	"title",
+	"description",
+	"tags",
+	"all_day",
+	"start",
+	"end",
+	"time_zone",
+	"rrule",
+	"exdates",
+	"reminders",
+	"location",
+	"created_at",
+	"updated_at",
+	"updated_by",
+	"deleted_at",
+	"version",
+}
+
+// windowFields lists the fields needed to expand a
+// recurring event into its occurrences.
+var windowFields = []string{"all_day", "start", "end", "time_zone", "rrule", "exdates"}
+
+// ValidateFields runs the validator to check that
+// every field of a sparse fieldset is in the safelist.
+func ValidateFields(v *validator.Validator, fields []string, safelist []string) {
+	for _, field := range fields {
+		if !validator.In(field, safelist) {
+			v.AddError("fields", "invalid field value: "+field)
+			return
+		}
+	}
+}
+
+// IncludesField reports whether a sparse fieldset
+// includes the field. An empty fieldset includes
+// every field.
+func IncludesField(fields []string, field string) bool {
+	return len(fields) == 0 || validator.In(field, fields)
+}
+
+// columnFields returns the fields of an event to
+// select from the events table for a list with the
+// filters, in the order of eventColumnFields. With a
+// sparse fieldset these are the requested fields,
+// together with the fields needed to sort and page the
+// list, to convert its times to a time zone, and to
+// expand recurring events in a window.
+func (f Filters) columnFields() []string {
+	if len(f.Fields) == 0 {
+		return eventColumnFields
+	}
+
+	needed := []string{"id", "all_day", "start", "time_zone", strings.TrimPrefix(f.Sort, "-")}
+	needed = append(needed, f.Fields...)
+	if f.hasWindow() {
+		needed = append(needed, windowFields...)
+	}
+
+	var fields []string
+	for _, field := range eventColumnFields {
+		if validator.In(field, needed) {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// showColumnFields returns the fields of an event to
+// select from the events table to show it with a
+// sparse fieldset, in the order of eventColumnFields.
+// These are the requested fields, together with the
+// fields needed to check the user's role on it, to
+// send its ETag, and to convert its times to a time
+// zone. Fields which are not read from the events
+// table are ignored, and an empty fieldset selects
+// every column.
+func showColumnFields(fields []string) []string {
+	if len(fields) == 0 {
+		return eventColumnFields
+	}
+
+	needed := []string{"id", "user_id", "calendar_id", "all_day", "time_zone", "version"}
+	needed = append(needed, fields...)
+
+	var columnFields []string
+	for _, field := range eventColumnFields {
+		if validator.In(field, needed) {
+			columnFields = append(columnFields, field)
+		}
+	}
+	return columnFields
+}
+
+// selectColumns returns the SQL select list for the
+// fields of an event, which must be in the order of
+// eventColumnFields.
+func selectColumns(fields []string) string {
+	columns := make([]string, 0, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "tags":
+			columns = append(columns, eventTagsColumn)
+		case "location":
+			columns = append(columns, eventLocationColumns)
+		default:
+			columns = append(columns, field)
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+// Fields returns the fields of the event in a sparse
+// fieldset, as a map to be encoded to JSON. Every
+// requested field is included, even when empty.
+func (event *Event) Fields(fields []string) map[string]interface{} {
+	values := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "id":
+			values[field] = event.ID
+		case "user_id":
+			values[field] = event.UserID
+		case "calendar_id":
+			values[field] = event.CalendarID
+		case "uid":
+			values[field] = event.UID
+		case "title":
+			values[field] = event.Title
+		case "description":
+			values[field] = event.Description
+		case "tags":
+			values[field] = event.Tags
+		case "all_day":
+			values[field] = event.AllDay
+		case "start":
+			values[field] = event.Start
+		case "end":
+			values[field] = event.End
+		case "time_zone":
+			values[field] = event.TimeZone
+		case "rrule":
+			values[field] = event.RRule
+		case "exdates":
+			values[field] = event.ExDates
+		case "reminders":
+			values[field] = event.Reminders
+		case "location":
+			values[field] = event.Place
+		case "distance_km":
+			values[field] = event.Distance
+		case "parent_id":
+			values[field] = event.ParentID
+		case "occurrence_start":
+			values[field] = event.OccurrenceStart
+		case "rsvp":
+			values[field] = event.RSVP
+		case "snippet":
+			values[field] = event.Snippet
+		case "created_at":
+			values[field] = event.CreatedAt
+		case "updated_at":
+			values[field] = event.UpdatedAt
+		case "updated_by":
+			values[field] = event.UpdatedBy
+		case "deleted_at":
+			values[field] = event.DeletedAt
+		case "version":
+			values[field] = event.Version
+		}
+	}
+	return values
+}
@@ -2,16 +2,66 @@ package data
 
 import (
 	"strings"
+	"time"
 
 	"github.com/robwestbrook/greenlight/internal/validator"
 )
 
+// maxWindow is the longest from/to window a client
+// may request. Recurring events are expanded into one
+// row per occurrence inside the window, so it must
+// be bounded.
+const maxWindow = 366 * 24 * time.Hour
+
 // Filters type
+// Fields:
+//  1. Page: current page
+//  2. PageSize: records per page
+//  3. Sort: sort column, "-" prefix for descending
+//  4. SortSafelist: allowed sort values
+//  5. From: start of the requested time window
+//  6. To: end of the requested time window
+//  7. AllDay: all day events only (true), timed
+//     events only (false), or both (nil)
+//  8. CreatedAfter: only records created after it
+//  9. UpdatedSince: only records updated at or after it
+//  10. CalendarID: only records in the calendar, if not 0
+//  11. Search: full-text search query, if not empty
+//  12. TagsMode: how a list of tags filters records,
+//     TagsModeAll or TagsModeAny
+//  13. After: cursor of the record a page starts after,
+//     in place of Page
+//  14. Before: cursor of the record a page ends before,
+//     in place of Page
+//  15. Count: whether to count the total number of
+//     records
+//  16. Fields: fields of a sparse fieldset, or empty
+//     for every field
+//  17. FieldsSafelist: allowed fields
+//  18. Near: center of a radius search, or nil for no
+//     radius search
+//  19. RadiusKm: radius of the search around Near, in
+//     kilometres
 type Filters struct {
-	Page         int
-	PageSize     int
-	Sort         string
-	SortSafelist []string
+	Page           int
+	PageSize       int
+	Sort           string
+	SortSafelist   []string
+	From           time.Time
+	To             time.Time
+	AllDay         *bool
+	CreatedAfter   time.Time
+	UpdatedSince   time.Time
+	CalendarID     int64
+	Search         string
+	TagsMode       string
+	After          string
+	Before         string
+	Count          bool
+	Fields         []string
+	FieldsSafelist []string
+	Near           *Point
+	RadiusKm       float64
 }
 
 // sortColumn function verifies the client-supplied
@@ -51,6 +101,12 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// hasWindow reports whether a from/to time window
+// was requested.
+func (f Filters) hasWindow() bool {
+	return !f.From.IsZero() && !f.To.IsZero()
+}
+
 // ValidateFilters function performs sanity checks on
 // the query string values.
 func ValidateFilters(v *validator.Validator, f Filters) {
@@ -83,4 +139,83 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 		"sort",
 		"invalid sort value",
 	)
+	ValidateFields(v, f.Fields, f.FieldsSafelist)
+
+	// A page is given by a page number, or by one of the
+	// cursors returned with another page of the list.
+	v.Check(f.After == "" || f.Before == "", "before", "must not be provided with after")
+	if f.After != "" || f.Before != "" {
+		v.Check(f.Page == 1, "page", "must not be provided with after or before")
+		if validator.In(f.Sort, f.SortSafelist) {
+			_, err := f.cursorKey()
+			key := "after"
+			if f.After == "" {
+				key = "before"
+			}
+			v.Check(err == nil, key, "must be a cursor from a list with the same sort")
+		}
+	}
+
+	// Check the time window, if one was requested.
+	// Both ends must be provided.
+	if !f.From.IsZero() || !f.To.IsZero() {
+		v.Check(!f.From.IsZero(), "from", "must be provided when to is provided")
+		v.Check(!f.To.IsZero(), "to", "must be provided when from is provided")
+	}
+	if f.hasWindow() {
+		ValidateWindow(v, f.From, f.To)
+	}
+
+	v.Check(f.CalendarID >= 0, "calendar_id", "must not be negative")
+	v.Check(
+		f.TagsMode == "" || validator.In(f.TagsMode, []string{TagsModeAll, TagsModeAny}),
+		"tags_mode",
+		"must be all or any",
+	)
+
+	// Results can only be sorted by relevance to a
+	// full-text search query.
+	v.Check(len(f.Search) <= 500, "q", "must not be more than 500 bytes long")
+	v.Check(
+		f.Search != "" || strings.TrimPrefix(f.Sort, "-") != "relevance",
+		"sort",
+		"must not be relevance without a search query",
+	)
+
+	// Results can only be sorted by distance from the
+	// center of a radius search.
+	if f.Near != nil {
+		ValidatePoint(v, *f.Near, f.RadiusKm)
+	}
+	v.Check(
+		f.Near != nil || strings.TrimPrefix(f.Sort, "-") != "distance",
+		"sort",
+		"must not be distance without near",
+	)
+
+	// Records can't have been created or updated in
+	// the future, so such a filter is a client error.
+	now := time.Now()
+	v.Check(
+		!f.CreatedAfter.After(now),
+		"created_after",
+		"must not be in the future",
+	)
+	v.Check(
+		!f.UpdatedSince.After(now),
+		"updated_since",
+		"must not be in the future",
+	)
+}
+
+// ValidateWindow runs the validator to validate a
+// from/to time window. The window must not be longer
+// than maxWindow.
+func ValidateWindow(v *validator.Validator, from, to time.Time) {
+	v.Check(to.After(from), "to", "must be later than from")
+	v.Check(
+		to.Sub(from) <= maxWindow,
+		"to",
+		"must not be more than 366 days after from",
+	)
 }
@@ -0,0 +1,132 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// MaxFreeBusyUsers limits the number of users in a
+// single free/busy query.
+const MaxFreeBusyUsers = 50
+
+// BusyInterval struct holds a half-open interval
+// [Start, End) when a user is busy.
+// Fields:
+// 1.		Start: Time the user becomes busy
+// 2.		End: Time the user is free again
+type BusyInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// In returns a copy of the interval with its times
+// converted to loc.
+func (b *BusyInterval) In(loc *time.Location) *BusyInterval {
+	return &BusyInterval{Start: b.Start.In(loc), End: b.End.In(loc)}
+}
+
+// Busy returns the intervals in the window [from, to)
+// when a user is busy, computed from the events they
+// own outside the trash. Overlapping and adjacent
+// intervals are merged, and intervals are cut to the
+// window. If viewerID is not 0, only events in the
+// user's calendars shared with the viewer are used.
+func (e EventModel) Busy(userID, viewerID int64, from, to time.Time) ([]*BusyInterval, error) {
+	// All day events are busy from midnight in their own
+	// time zone, while they are stored and selected by
+	// their UTC date, so the window is widened by a day
+	// on both sides to find them.
+	window := Filters{From: from.AddDate(0, 0, -1), To: to.AddDate(0, 0, 1)}
+	where, args := eventWhere(0, "", "", nil, window)
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM events
+		WHERE %s
+		AND user_id = ?
+		AND (? = 0 OR calendar_id IN (
+			SELECT calendar_id FROM calendar_shares WHERE user_id = ?
+		))
+	`,
+		eventColumns,
+		where,
+	)
+	args = append(args, userID, viewerID, viewerID)
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	// Cut the interval of each occurrence to the window.
+	// Events occupying a single instant don't make the
+	// user busy.
+	intervals := []*BusyInterval{}
+	for rows.Next() {
+		var event Event
+
+		err := scanEvent(rows, &event)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, occurrence := range event.Occurrences(window.From, window.To) {
+			start, end := occurrence.busyInterval()
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if start.Before(end) {
+				intervals = append(intervals, &BusyInterval{Start: start.UTC(), End: end.UTC()})
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return mergeIntervals(intervals), nil
+}
+
+// busyInterval returns the interval an event makes its
+// owner busy for. All day events float, so they are
+// busy for their whole days in the event's time zone.
+func (event *Event) busyInterval() (time.Time, time.Time) {
+	start, end := event.interval()
+	if event.AllDay {
+		loc := event.Location()
+		start = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+		end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, loc)
+	}
+	return start, end
+}
+
+// mergeIntervals sorts intervals by start, and merges
+// those which overlap or touch.
+func mergeIntervals(intervals []*BusyInterval) []*BusyInterval {
+	sort.Slice(intervals, func(i, j int) bool {
+		return intervals[i].Start.Before(intervals[j].Start)
+	})
+
+	merged := []*BusyInterval{}
+	for _, interval := range intervals {
+		last := len(merged) - 1
+		if last >= 0 && !interval.Start.After(merged[last].End) {
+			if interval.End.After(merged[last].End) {
+				merged[last].End = interval.End
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
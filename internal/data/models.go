@@ -9,26 +9,48 @@ import (
 // not found in the database.
 // ErrEditConflict is returned when a conflict race
 // condition happens in the database.
+// ErrInvalidSearch is returned when a full-text search
+// query has invalid syntax.
+// ErrInvalidCursor is returned when a pagination
+// cursor can't be read, or is for another sort.
 var (
 	ErrRecordNotFound = errors.New("record not found")
 	ErrEditConflict   = errors.New("edit conflict")
+	ErrInvalidSearch  = errors.New("invalid search query")
+	ErrInvalidCursor  = errors.New("invalid cursor")
 )
 
 // Models is a struct which wraps all database models.
 type Models struct {
+	Attachments AttachmentModel
+	Attendees   AttendeeModel
+	Calendars   CalendarModel
 	Events      EventModel
 	Permissions PermissionModel
+	Reminders   ReminderModel
+	Revisions   RevisionModel
+	Shares      ShareModel
+	Tags        TagModel
 	Tokens      TokenModel
 	Users       UserModel
+	Webhooks    WebhookModel
 }
 
 // NewModels returns a Models struct containing the
 // initialized database models.
 func NewModels(db *sql.DB) Models {
 	return Models{
+		Attachments: AttachmentModel{DB: db},
+		Attendees:   AttendeeModel{DB: db},
+		Calendars:   CalendarModel{DB: db},
 		Events:      EventModel{DB: db},
 		Permissions: PermissionModel{DB: db},
+		Reminders:   ReminderModel{DB: db},
+		Revisions:   RevisionModel{DB: db},
+		Shares:      ShareModel{DB: db},
+		Tags:        TagModel{DB: db},
 		Tokens:      TokenModel{DB: db},
 		Users:       UserModel{DB: db},
+		Webhooks:    WebhookModel{DB: db},
 	}
 }
@@ -0,0 +1,184 @@
+package data
+
+import (
+	"database/sql"
+	"math"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+// DriverName is the name of the SQLite driver to open
+// the database with. It is the go-sqlite3 driver with
+// the distance_km() function registered on each
+// connection, which radius searches use.
+const DriverName = "sqlite3_greenlight"
+
+// Define the limits on radius searches:
+//  1. earthRadiusKm: mean radius of the Earth
+//  2. MaxRadiusKm: half the Earth's circumference,
+//     which reaches every point
+const (
+	earthRadiusKm = 6371.0
+	MaxRadiusKm   = math.Pi * earthRadiusKm
+)
+
+func init() {
+	sql.Register(DriverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("distance_km", sqlDistanceKm, true)
+		},
+	})
+}
+
+// Place struct holds where an event takes place.
+// Fields:
+// 1.		Name: Name of the place
+// 2.		Address: Street address of the place
+// 3.		Latitude: Latitude in degrees, if known
+// 4.		Longitude: Longitude in degrees, if known
+type Place struct {
+	Name      string   `json:"name,omitempty"`
+	Address   string   `json:"address,omitempty"`
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+}
+
+// Point struct holds the coordinates, in degrees, at
+// the center of a radius search.
+type Point struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// ValidatePlace runs the validator to validate the
+// place of an event. A nil place is valid.
+func ValidatePlace(v *validator.Validator, place *Place) {
+	if place == nil {
+		return
+	}
+
+	v.Check(len(place.Name) <= 200, "location", "name must not be more than 200 bytes long")
+	v.Check(len(place.Address) <= 500, "location", "address must not be more than 500 bytes long")
+	v.Check(
+		(place.Latitude == nil) == (place.Longitude == nil),
+		"location",
+		"latitude and longitude must both be provided, or neither",
+	)
+	if place.Latitude != nil {
+		v.Check(*place.Latitude >= -90 && *place.Latitude <= 90, "location", "latitude must be between -90 and 90")
+	}
+	if place.Longitude != nil {
+		v.Check(*place.Longitude >= -180 && *place.Longitude <= 180, "location", "longitude must be between -180 and 180")
+	}
+}
+
+// ValidatePoint runs the validator to validate the
+// center and radius of a radius search.
+func ValidatePoint(v *validator.Validator, p Point, radiusKm float64) {
+	v.Check(p.Latitude >= -90 && p.Latitude <= 90, "near", "latitude must be between -90 and 90")
+	v.Check(p.Longitude >= -180 && p.Longitude <= 180, "near", "longitude must be between -180 and 180")
+	v.Check(radiusKm > 0, "radius_km", "must be greater than zero")
+	v.Check(radiusKm <= MaxRadiusKm, "radius_km", "must not be more than 20015")
+}
+
+// isZero reports whether a place has no values, so
+// the event has no place.
+func (place *Place) isZero() bool {
+	return place == nil || (place.Name == "" && place.Address == "" && place.Latitude == nil)
+}
+
+// columns returns the values of the location_name,
+// location_address, latitude and longitude columns for
+// a place, which may be nil.
+func (place *Place) columns() (string, string, interface{}, interface{}) {
+	if place == nil {
+		return "", "", nil, nil
+	}
+
+	var latitude, longitude interface{}
+	if place.Latitude != nil && place.Longitude != nil {
+		latitude, longitude = *place.Latitude, *place.Longitude
+	}
+	return place.Name, place.Address, latitude, longitude
+}
+
+// setDistance sets the distance of an event selected
+// by a list, which is only computed for a radius
+// search.
+func (event *Event) setDistance(distance float64, filters Filters) {
+	if filters.Near != nil {
+		event.Distance = &distance
+	}
+}
+
+// distance returns the distance of an event from the
+// center of a radius search, or 0 without one.
+func (event *Event) distance() float64 {
+	if event.Distance == nil {
+		return 0
+	}
+	return *event.Distance
+}
+
+// DistanceKm returns the great-circle distance in
+// kilometres between two points given in degrees,
+// using the haversine formula.
+func DistanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	dLat, dLng := radians(lat2-lat1), radians(lng2-lng1)
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(radians(lat1))*math.Cos(radians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// sqlDistanceKm is DistanceKm() as the distance_km()
+// SQL function. It returns NULL if any argument is
+// NULL, as for an event without coordinates.
+func sqlDistanceKm(lat1, lng1, lat2, lng2 interface{}) interface{} {
+	var values [4]float64
+	for i, arg := range []interface{}{lat1, lng1, lat2, lng2} {
+		switch arg := arg.(type) {
+		case float64:
+			values[i] = arg
+		case int64:
+			values[i] = float64(arg)
+		default:
+			return nil
+		}
+	}
+	return DistanceKm(values[0], values[1], values[2], values[3])
+}
+
+// boundingBox returns the smallest box of latitudes
+// and longitudes, in degrees, holding every point
+// within the radius of the center. If the box crosses
+// the 180th meridian, minLng is greater than maxLng.
+// If it reaches a pole, it holds every longitude.
+func boundingBox(center Point, radiusKm float64) (minLat, maxLat, minLng, maxLng float64) {
+	// The angular radius, in degrees.
+	r := radiusKm / earthRadiusKm * 180 / math.Pi
+
+	minLat, maxLat = center.Latitude-r, center.Latitude+r
+	if minLat <= -90 || maxLat >= 90 {
+		return math.Max(minLat, -90), math.Min(maxLat, 90), -180, 180
+	}
+
+	// The widest span of longitude is reached where a
+	// meridian touches the circle, rather than at the
+	// center's latitude.
+	dLng := math.Asin(math.Sin(radians(r))/math.Cos(radians(center.Latitude))) * 180 / math.Pi
+	minLng, maxLng = center.Longitude-dLng, center.Longitude+dLng
+	if minLng < -180 {
+		minLng += 360
+	}
+	if maxLng > 180 {
+		maxLng -= 360
+	}
+	return minLat, maxLat, minLng, maxLng
+}
+
+// radians converts degrees to radians.
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
@@ -0,0 +1,186 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal"
+)
+
+// Define the limits on event reminders:
+//  1. MaxReminders: reminders per event
+//  2. MaxReminderMinutes: minutes before the start a
+//     reminder can be sent, which is four weeks
+const (
+	MaxReminders       = 5
+	MaxReminderMinutes = 4 * 7 * 24 * 60
+)
+
+// Reminder struct holds a reminder which is due to be
+// sent for an event, or one occurrence of a recurring
+// event.
+// Fields:
+// 1.		Event: The event, or occurrence, the reminder is for
+// 2.		Minutes: Minutes before the start the reminder is sent
+// 3.		Email: Email of the event's owner
+// 4.		Name: Name of the event's owner
+type Reminder struct {
+	Event   *Event
+	Minutes int
+	Email   string
+	Name    string
+}
+
+// ReminderModel struct wraps an sql.DB connection pool.
+type ReminderModel struct {
+	DB *sql.DB
+}
+
+// Due returns the reminders due at now, including
+// those which have already been sent, which Claim()
+// skips. Reminders which fell due more than lookback
+// ago, such as while the server was stopped, are not
+// returned, so stale reminders are not sent.
+func (m ReminderModel) Due(now time.Time, lookback time.Duration) ([]*Reminder, error) {
+	// Select the events which have reminders and may
+	// start between the lookback and the longest
+	// reminder from now. The owner's email and name are
+	// selected after the event columns.
+	query := `
+		SELECT ` + eventColumns + `,
+		(SELECT email FROM users WHERE users.id = events.user_id),
+		(SELECT name FROM users WHERE users.id = events.user_id)
+		FROM events
+		WHERE reminders <> ''
+		AND deleted_at IS NULL
+		AND user_id IS NOT NULL
+		AND start < ?
+		AND (span_end IS NULL OR span_end > ?)
+	`
+
+	from := now.Add(-lookback).UTC()
+	to := now.Add(MaxReminderMinutes * time.Minute).Add(time.Minute).UTC()
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, to, from)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := []*Reminder{}
+	for rows.Next() {
+		var event Event
+		var email, name string
+
+		err := scanEvent(rows, &event, &email, &name)
+		if err != nil {
+			return nil, err
+		}
+
+		// A reminder is due once its time has passed, if it
+		// was not due before the lookback.
+		for _, occurrence := range event.Occurrences(from, to) {
+			for _, minutes := range event.Reminders {
+				due := occurrence.reminderStart().Add(-time.Duration(minutes) * time.Minute)
+				if due.After(now) || !due.After(from) {
+					continue
+				}
+
+				reminders = append(reminders, &Reminder{
+					Event:   occurrence,
+					Minutes: minutes,
+					Email:   email,
+					Name:    name,
+				})
+			}
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reminders, nil
+}
+
+// Claim records a reminder as delivered before it is
+// sent, so it is never sent twice, even across
+// restarts. It returns false if the reminder had
+// already been claimed.
+func (m ReminderModel) Claim(reminder *Reminder) (bool, error) {
+	query := `
+		INSERT INTO reminder_deliveries (event_id, occurrence_start, minutes, sent_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (event_id, occurrence_start, minutes) DO NOTHING
+	`
+
+	args := append(reminderArgs(reminder), internal.CurrentDate())
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// Release removes the delivery record of a claimed
+// reminder which could not be sent, so it is tried
+// again.
+func (m ReminderModel) Release(reminder *Reminder) error {
+	query := `
+		DELETE FROM reminder_deliveries
+		WHERE event_id = ? AND occurrence_start = ? AND minutes = ?
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, reminderArgs(reminder)...)
+	return err
+}
+
+// reminderStart returns the time reminders of an
+// event count back from. All day events start at
+// midnight in their own time zone.
+func (event *Event) reminderStart() time.Time {
+	if event.AllDay {
+		y, m, d := event.Start.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, event.Location())
+	}
+	return event.Start
+}
+
+// reminderArgs returns the placeholder parameters
+// identifying a reminder in the reminder_deliveries
+// table: the event ID, the start of the occurrence and
+// the minutes before it.
+func reminderArgs(reminder *Reminder) []interface{} {
+	return []interface{}{
+		reminderEventID(reminder.Event),
+		reminder.Event.Start.UTC(),
+		reminder.Minutes,
+	}
+}
+
+// reminderEventID returns the ID of the stored event
+// an event or expanded occurrence belongs to.
+func reminderEventID(event *Event) int64 {
+	if event.ParentID != 0 {
+		return event.ParentID
+	}
+	return event.ID
+}
@@ -0,0 +1,206 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// revisionColumns lists the event_revisions table
+// columns in the order scanEvent() expects them, so a
+// revision is scanned as the event it was.
+const revisionColumns = `
+	event_id, user_id, calendar_id, uid, title, description, tags,
+	all_day, start, end, time_zone, rrule, exdates, reminders,
+	` + eventLocationColumns + `,
+	created_at, updated_at, updated_by, deleted_at, version
+`
+
+// FieldChange struct holds a field which differs
+// between two versions of an event.
+// Fields:
+// 1.		Field: JSON name of the field
+// 2.		From: Value in the older version
+// 3.		To: Value in the newer version
+type FieldChange struct {
+	Field string          `json:"field"`
+	From  json.RawMessage `json:"from"`
+	To    json.RawMessage `json:"to"`
+}
+
+// RevisionModel struct wraps an sql.DB connection pool.
+// Revisions are the prior versions of events. They are
+// written by a trigger whenever an event's version is
+// incremented, and removed with the event when it is
+// purged.
+type RevisionModel struct {
+	DB *sql.DB
+}
+
+// GetAll returns the prior versions of an event, sorted
+// and paginated by the filters.
+func (m RevisionModel) GetAll(eventID int64, filters Filters) ([]*Event, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, COUNT(*) OVER()
+		FROM event_revisions
+		WHERE event_id = ?
+		ORDER BY %s %s
+		LIMIT ? OFFSET ?
+	`,
+		revisionColumns,
+		filters.sortColumn(),
+		filters.sortDirection(),
+	)
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, eventID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*Event{}
+	for rows.Next() {
+		var revision Event
+
+		err := scanEvent(rows, &revision, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// Get fetches a prior version of an event.
+func (m RevisionModel) Get(eventID int64, version int32) (*Event, error) {
+	if eventID < 1 || version < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + revisionColumns + `
+		FROM event_revisions
+		WHERE event_id = ? AND version = ?
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var revision Event
+
+	err := scanEvent(m.DB.QueryRowContext(ctx, query, eventID, version), &revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &revision, nil
+}
+
+// Revert copies the details of an older version of an
+// event onto the event, ready to be saved as a new
+// version with Update(). The event keeps its ID, UID,
+// creation time and version, so the update is checked
+// against the version the event was read at. The owner
+// and calendar are not copied, since moving the event
+// back depends on who may edit the calendar now.
+func (event *Event) Revert(revision *Event) {
+	event.Title = revision.Title
+	event.Description = revision.Description
+	event.Tags = revision.Tags
+	event.AllDay = revision.AllDay
+	event.Start = revision.Start
+	event.End = revision.End
+	event.TimeZone = revision.TimeZone
+	event.RRule = revision.RRule
+	event.ExDates = revision.ExDates
+	event.Reminders = revision.Reminders
+	event.Place = revision.Place
+}
+
+// DiffEvents returns the fields which differ between
+// two versions of an event, in the order they appear
+// in an event. Fields which only describe a version,
+// such as its update time, are not compared. Empty and
+// missing lists are treated as the same.
+func DiffEvents(from, to *Event) ([]*FieldChange, error) {
+	fields := []struct {
+		name     string
+		from, to interface{}
+	}{
+		{"user_id", from.UserID, to.UserID},
+		{"calendar_id", from.CalendarID, to.CalendarID},
+		{"title", from.Title, to.Title},
+		{"description", from.Description, to.Description},
+		{"tags", from.Tags, to.Tags},
+		{"all_day", from.AllDay, to.AllDay},
+		{"start", from.Start, to.Start},
+		{"end", from.End, to.End},
+		{"time_zone", from.TimeZone, to.TimeZone},
+		{"rrule", from.RRule, to.RRule},
+		{"exdates", from.ExDates, to.ExDates},
+		{"reminders", from.Reminders, to.Reminders},
+		{"location", from.Place, to.Place},
+		{"deleted_at", from.DeletedAt, to.DeletedAt},
+	}
+
+	// Compare the JSON encoding of each field, which is
+	// what clients see, so times are equal if they are
+	// written the same.
+	changes := []*FieldChange{}
+	for _, field := range fields {
+		fromJSON, err := diffJSON(field.from)
+		if err != nil {
+			return nil, err
+		}
+		toJSON, err := diffJSON(field.to)
+		if err != nil {
+			return nil, err
+		}
+
+		if !bytes.Equal(fromJSON, toJSON) {
+			changes = append(changes, &FieldChange{
+				Field: field.name,
+				From:  fromJSON,
+				To:    toJSON,
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// diffJSON returns the JSON encoding of a field value
+// for DiffEvents(). Empty lists are encoded as null, the
+// same as missing ones.
+func diffJSON(value interface{}) (json.RawMessage, error) {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Equal(js, []byte("[]")) {
+		return json.RawMessage("null"), nil
+	}
+	return js, nil
+}
@@ -0,0 +1,192 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+// Define the limits on meeting slot suggestions:
+//  1. MaxSlotSuggestions: slots returned by a search
+//  2. MaxSlotDuration: length of a meeting, buffer or
+//     minimum notice
+//  3. SlotStep: time between the starts of candidate
+//     slots, counted from midnight
+const (
+	MaxSlotSuggestions = 50
+	MaxSlotDuration    = 24 * time.Hour
+	SlotStep           = 15 * time.Minute
+)
+
+// Weekdays maps the short day names used in working
+// hours to days of the week.
+var Weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// WorkingHours struct holds the times of day meetings
+// may be suggested at.
+// Fields:
+// 1.		Start: Time after midnight the working day starts
+// 2.		End: Time after midnight the working day ends
+// 3.		Days: Days of the week worked
+// 4.		Location: Time zone the working hours are in
+type WorkingHours struct {
+	Start    time.Duration
+	End      time.Duration
+	Days     []time.Weekday
+	Location *time.Location
+}
+
+// SlotQuery struct holds the constraints of a search
+// for meeting slots.
+// Fields:
+// 1.		From: Start of the search window
+// 2.		To: End of the search window
+// 3.		Duration: Length of the meeting
+// 4.		Buffer: Free time needed between the meeting and other events
+// 5.		MinNotice: Shortest time from now the meeting may start in
+// 6.		WorkingHours: Times of day the meeting may be at, or nil for any time
+// 7.		Limit: Number of slots to suggest
+type SlotQuery struct {
+	From         time.Time
+	To           time.Time
+	Duration     time.Duration
+	Buffer       time.Duration
+	MinNotice    time.Duration
+	WorkingHours *WorkingHours
+	Limit        int
+}
+
+// Slot struct holds a suggested meeting time.
+// Fields:
+// 1.		Rank: Position of the slot in the suggestions, from 1
+// 2.		Start: Start of the meeting
+// 3.		End: End of the meeting
+type Slot struct {
+	Rank  int       `json:"rank"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// ValidateSlotQuery runs the validator to validate
+// the constraints of a slot search.
+func ValidateSlotQuery(v *validator.Validator, q *SlotQuery) {
+	ValidateWindow(v, q.From, q.To)
+	v.Check(q.Duration > 0, "duration", "must be greater than zero")
+	v.Check(q.Duration <= MaxSlotDuration, "duration", "must not be more than 1440 minutes")
+	v.Check(q.Buffer >= 0, "buffer", "must not be negative")
+	v.Check(q.Buffer <= MaxSlotDuration, "buffer", "must not be more than 1440 minutes")
+	v.Check(q.MinNotice >= 0, "min_notice", "must not be negative")
+	v.Check(q.MinNotice <= maxWindow, "min_notice", "must not be more than 366 days")
+	v.Check(q.Limit > 0, "limit", "must be greater than zero")
+	v.Check(q.Limit <= MaxSlotSuggestions, "limit", fmt.Sprintf("must be a maximum of %d", MaxSlotSuggestions))
+
+	if hours := q.WorkingHours; hours != nil {
+		v.Check(hours.Start < hours.End, "working_hours", "must end later than they start")
+		v.Check(hours.End-hours.Start >= q.Duration, "working_hours", "must be at least as long as the meeting")
+		v.Check(len(hours.Days) > 0, "working_hours", "must contain at least one day")
+	}
+}
+
+// SuggestSlots returns up to the query limit of
+// meeting slots in the query window when nobody is
+// busy, ranked earliest first. Slots start on a
+// multiple of SlotStep after midnight, are at least
+// the buffer away from any busy interval, and are not
+// earlier than the minimum notice after now. With
+// working hours, slots lie inside a working day. The
+// busy intervals may belong to several users, in any
+// order.
+func SuggestSlots(q *SlotQuery, busy []*BusyInterval, now time.Time) []*Slot {
+	// Pad each busy interval with the buffer, so a slot
+	// only has to avoid the padded intervals.
+	padded := make([]*BusyInterval, 0, len(busy))
+	for _, interval := range busy {
+		padded = append(padded, &BusyInterval{
+			Start: interval.Start.Add(-q.Buffer),
+			End:   interval.End.Add(q.Buffer),
+		})
+	}
+	padded = mergeIntervals(padded)
+
+	loc := time.UTC
+	if q.WorkingHours != nil {
+		loc = q.WorkingHours.Location
+	}
+
+	earliest := q.From
+	if notice := now.Add(q.MinNotice); notice.After(earliest) {
+		earliest = notice
+	}
+
+	slots := []*Slot{}
+	next := 0
+	for start := alignSlot(earliest, loc); len(slots) < q.Limit; {
+		end := start.Add(q.Duration)
+		if end.After(q.To) {
+			break
+		}
+
+		// Skip the busy intervals which end before the
+		// slot. If the next one overlaps the slot, try
+		// again once it ends.
+		for next < len(padded) && !padded[next].End.After(start) {
+			next++
+		}
+		if next < len(padded) && padded[next].Start.Before(end) {
+			start = alignSlot(padded[next].End, loc)
+			continue
+		}
+
+		if q.WorkingHours.contain(start, end) {
+			slots = append(slots, &Slot{Rank: len(slots) + 1, Start: start, End: end})
+			start = alignSlot(end, loc)
+			continue
+		}
+		start = start.Add(SlotStep)
+	}
+
+	return slots
+}
+
+// contain reports whether a slot lies inside one
+// working day. nil working hours contain every slot.
+func (hours *WorkingHours) contain(start, end time.Time) bool {
+	if hours == nil {
+		return true
+	}
+
+	local := start.In(hours.Location)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, hours.Location)
+
+	worked := false
+	for _, day := range hours.Days {
+		if local.Weekday() == day {
+			worked = true
+			break
+		}
+	}
+
+	return worked &&
+		!midnight.Add(hours.Start).After(start) &&
+		!end.After(midnight.Add(hours.End))
+}
+
+// alignSlot returns the first slot start at or after
+// t, which is the next multiple of SlotStep after
+// midnight in loc.
+func alignSlot(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	steps := (t.Sub(midnight) + SlotStep - 1) / SlotStep
+	return midnight.Add(steps * SlotStep).UTC()
+}
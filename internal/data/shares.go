@@ -0,0 +1,231 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+// Define the roles a calendar can be shared with, from
+// the least to the most access:
+//  1. RoleFreeBusy: see when the owner is busy, but no
+//     event details
+//  2. RoleViewer: see events
+//  3. RoleEditor: see, create, update and delete events
+//  4. RoleOwner: edit, share and delete the calendar
+//
+// The owner of a calendar, and users with the
+// "events:admin" permission, have the RoleOwner role.
+const (
+	RoleFreeBusy = "freebusy"
+	RoleViewer   = "viewer"
+	RoleEditor   = "editor"
+	RoleOwner    = "owner"
+)
+
+// Roles lists the roles in order of increasing access.
+var Roles = []string{RoleFreeBusy, RoleViewer, RoleEditor, RoleOwner}
+
+// RoleIncludes reports whether the role has at least
+// the access of the required role. No role ("")
+// includes nothing.
+func RoleIncludes(role, required string) bool {
+	return roleRank(role) >= roleRank(required) && roleRank(role) > 0
+}
+
+// roleRank returns the position of a role in Roles,
+// counting from 1, or 0 if it is not a role.
+func roleRank(role string) int {
+	for i, r := range Roles {
+		if r == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Share struct
+// Fields:
+// 1.		ID: Unique ID for share
+// 2.		CalendarID: ID of the shared calendar
+// 3.		UserID: ID of the user the calendar is shared with
+// 4.		Name: Name of the user the calendar is shared with
+// 5.		Email: Email of the user the calendar is shared with
+// 6.		Role: Access granted, one of Roles
+// 7.		CreatedAt: Timestamp when the calendar was shared
+// 8.		UpdatedAt: Timestamp when the role was last changed
+type Share struct {
+	ID         int64     `json:"id"`
+	CalendarID int64     `json:"calendar_id"`
+	UserID     int64     `json:"user_id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// ShareModel struct wraps an sql.DB connection pool.
+type ShareModel struct {
+	DB *sql.DB
+}
+
+// ValidateShare runs the validator to validate shares.
+func ValidateShare(v *validator.Validator, share *Share) {
+	v.Check(validator.In(share.Role, Roles), "role", "must be one of freebusy, viewer, editor or owner")
+}
+
+// Upsert shares a calendar with a user, or changes the
+// role of an existing share. The share's ID and
+// timestamps are set from the stored record.
+func (m ShareModel) Upsert(share *Share) error {
+	query := `
+		INSERT INTO calendar_shares (calendar_id, user_id, role, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (calendar_id, user_id)
+		DO UPDATE SET role = excluded.role, updated_at = excluded.updated_at
+		RETURNING id, created_at, updated_at
+	`
+
+	args := []interface{}{
+		share.CalendarID,
+		share.UserID,
+		share.Role,
+		internal.CurrentDate(),
+		internal.CurrentDate(),
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&share.ID,
+		&share.CreatedAt,
+		&share.UpdatedAt,
+	)
+}
+
+// GetAllForCalendar returns the shares of a calendar,
+// with the name and email of each user, sorted by
+// email.
+func (m ShareModel) GetAllForCalendar(calendarID int64) ([]*Share, error) {
+	query := `
+		SELECT s.id, s.calendar_id, s.user_id, u.name, u.email, s.role, s.created_at, s.updated_at
+		FROM calendar_shares s
+		INNER JOIN users u ON u.id = s.user_id
+		WHERE s.calendar_id = ?
+		ORDER BY u.email ASC
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, calendarID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := []*Share{}
+	for rows.Next() {
+		var share Share
+
+		err := rows.Scan(
+			&share.ID,
+			&share.CalendarID,
+			&share.UserID,
+			&share.Name,
+			&share.Email,
+			&share.Role,
+			&share.CreatedAt,
+			&share.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		shares = append(shares, &share)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shares, nil
+}
+
+// Role returns the role a calendar is shared with a
+// user, or "" if it is not shared with them.
+func (m ShareModel) Role(calendarID, userID int64) (string, error) {
+	query := `
+		SELECT role
+		FROM calendar_shares
+		WHERE calendar_id = ? AND user_id = ?
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role string
+
+	err := m.DB.QueryRowContext(ctx, query, calendarID, userID).Scan(&role)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return "", err
+	}
+	return role, nil
+}
+
+// SharedWith reports whether any calendar owned by a
+// user is shared with another user, with any role.
+func (m ShareModel) SharedWith(ownerID, userID int64) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM calendar_shares s
+			INNER JOIN calendars c
+			ON c.id = s.calendar_id
+			WHERE c.user_id = ? AND s.user_id = ?
+		)
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var shared bool
+
+	err := m.DB.QueryRowContext(ctx, query, ownerID, userID).Scan(&shared)
+	return shared, err
+}
+
+// Delete revokes a share of a calendar by ID.
+func (m ShareModel) Delete(id, calendarID int64) error {
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(
+		ctx,
+		`DELETE FROM calendar_shares WHERE id = ? AND calendar_id = ?`,
+		id,
+		calendarID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+// Define the limits on event tags:
+//  1. MaxTags: tags per event
+//  2. MaxTagBytes: length of a tag name
+const (
+	MaxTags     = 20
+	MaxTagBytes = 50
+)
+
+// Define the ways a list of tags filters events:
+//  1. TagsModeAll: events with every tag
+//  2. TagsModeAny: events with at least one tag
+const (
+	TagsModeAll = "all"
+	TagsModeAny = "any"
+)
+
+// Tag struct
+// Fields:
+// 1.		ID: Unique ID for tag
+// 2.		Name: Tag name, unique for the user
+// 3.		Count: Number of events with the tag
+type Tag struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TagModel struct wraps an sql.DB connection pool.
+// Tags belong to the owner of the events they are used
+// on, and are removed once no event uses them.
+type TagModel struct {
+	DB *sql.DB
+}
+
+// ValidateTag runs the validator to validate tags.
+func ValidateTag(v *validator.Validator, tag *Tag) {
+	v.Check(tag.Name != "", "name", "must be provided")
+	v.Check(validTagName(tag.Name), "name", "must not be more than 50 bytes long or contain commas")
+}
+
+// validTagName reports whether a tag name can be
+// stored. Tags are filtered with a comma-delimited
+// query string value, so they can't contain commas.
+func validTagName(name string) bool {
+	return len(name) <= MaxTagBytes && !strings.Contains(name, ",")
+}
+
+// GetAll returns the tags of a user, with the number
+// of events using each tag, sorted by name. Events in
+// the trash are not counted, and tags only used on
+// them are not returned.
+func (m TagModel) GetAll(userID int64) ([]*Tag, error) {
+	query := `
+		SELECT t.id, t.name, COUNT(et.event_id)
+		FROM tags t
+		INNER JOIN event_tags et
+		ON t.id = et.tag_id
+		INNER JOIN events e
+		ON e.id = et.event_id AND e.deleted_at IS NULL
+		WHERE t.user_id = ?
+		GROUP BY t.id
+		ORDER BY t.name ASC
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*Tag{}
+	for rows.Next() {
+		var tag Tag
+
+		err := rows.Scan(&tag.ID, &tag.Name, &tag.Count)
+		if err != nil {
+			return nil, err
+		}
+
+		tags = append(tags, &tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
+
+// Get fetches a tag of a user by ID.
+func (m TagModel) Get(id, userID int64) (*Tag, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getTag(ctx, m.DB, id, userID)
+}
+
+// getTag fetches a tag of a user by ID, with its
+// number of events outside the trash, using q, which
+// may be the connection pool or a transaction.
+func getTag(ctx context.Context, q querier, id, userID int64) (*Tag, error) {
+	query := `
+		SELECT t.id, t.name, (
+			SELECT COUNT(*) FROM event_tags et
+			INNER JOIN events e
+			ON e.id = et.event_id AND e.deleted_at IS NULL
+			WHERE et.tag_id = t.id
+		)
+		FROM tags t
+		WHERE t.id = ? AND t.user_id = ?
+	`
+
+	var tag Tag
+
+	err := q.QueryRowContext(ctx, query, id, userID).Scan(&tag.ID, &tag.Name, &tag.Count)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &tag, nil
+}
+
+// Rename renames a tag of a user, updating every event
+// using it. If the user already has a tag with the new
+// name, the tag is merged into it: its events are given
+// the other tag, and the renamed tag is removed. The
+// tag the events now have is returned, with the events
+// outside the trash which had the renamed tag. The
+// version of each event is incremented, since its tags
+// changed, and the user is recorded as having updated
+// it.
+func (m TagModel) Rename(tag *Tag, userID int64, name string) (*Tag, []*Event, error) {
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Begin the transaction. Rollback() is a no-op once
+	// the transaction has been committed.
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	ids, err := queryEventIDs(
+		ctx,
+		tx,
+		`UPDATE events SET updated_at = ?, updated_by = ?, version = version + 1
+		WHERE id IN (SELECT event_id FROM event_tags WHERE tag_id = ?)
+		RETURNING id`,
+		internal.CurrentDate(),
+		userID,
+		tag.ID,
+	)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Look for another tag of the user with the name.
+	var targetID int64
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT id FROM tags WHERE user_id = ? AND name = ? AND id <> ?`,
+		userID,
+		name,
+		tag.ID,
+	).Scan(&targetID)
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		// Rename the tag.
+		targetID = tag.ID
+		_, err = tx.ExecContext(ctx, `UPDATE tags SET name = ? WHERE id = ?`, name, tag.ID)
+	case err == nil:
+		// Merge the tag into the other tag. Events with
+		// both tags keep the other tag where it was. The
+		// renamed tag is removed by a trigger once its
+		// last event is moved.
+		_, err = tx.ExecContext(
+			ctx,
+			`INSERT OR IGNORE INTO event_tags (event_id, tag_id, position)
+			SELECT event_id, ?, position FROM event_tags WHERE tag_id = ?`,
+			targetID,
+			tag.ID,
+		)
+		if err == nil {
+			_, err = tx.ExecContext(ctx, `DELETE FROM event_tags WHERE tag_id = ?`, tag.ID)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	target, err := getTag(ctx, tx, targetID, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Fetch the changed events, with their new tags.
+	changed, err := getEvents(ctx, tx, ids)
+	if err != nil {
+		return nil, nil, err
+	}
+	events := []*Event{}
+	for _, event := range changed {
+		if event.DeletedAt == nil {
+			events = append(events, event)
+		}
+	}
+
+	return target, events, tx.Commit()
+}
+
+// setEventTags stores the tags of an event using q,
+// which may be the connection pool or a transaction.
+// Tags are created for the event's owner as needed,
+// and tags the event no longer has are unlinked from
+// it, which removes them once no event uses them.
+func setEventTags(ctx context.Context, q querier, event *Event) error {
+	ids := make([]interface{}, 0, len(event.Tags)+1)
+	ids = append(ids, event.ID)
+
+	for i, name := range event.Tags {
+		// Create the tag if the owner doesn't have it.
+		_, err := q.ExecContext(
+			ctx,
+			`INSERT OR IGNORE INTO tags (user_id, name) VALUES (?, ?)`,
+			event.UserID,
+			name,
+		)
+		if err != nil {
+			return err
+		}
+
+		var id int64
+		err = q.QueryRowContext(
+			ctx,
+			`SELECT id FROM tags WHERE user_id = ? AND name = ?`,
+			event.UserID,
+			name,
+		).Scan(&id)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, id)
+
+		// Link the tag to the event, keeping the order
+		// the tags were given in.
+		_, err = q.ExecContext(
+			ctx,
+			`INSERT INTO event_tags (event_id, tag_id, position) VALUES (?, ?, ?)
+			ON CONFLICT (event_id, tag_id) DO UPDATE SET position = excluded.position`,
+			event.ID,
+			id,
+			i,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Unlink the tags the event no longer has.
+	query := `DELETE FROM event_tags WHERE event_id = ?`
+	if len(ids) > 1 {
+		query += ` AND tag_id NOT IN (` + placeholders(len(ids)-1) + `)`
+	}
+
+	_, err := q.ExecContext(ctx, query, ids...)
+	return err
+}
+
+// placeholders returns n comma-separated "?"
+// placeholder parameters, for an IN (...) list.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -14,21 +14,26 @@ import (
 // Define constants for the token scope.
 //  1. Activation
 //  2. Authentication
+//  3. Feed (read-only access to the iCalendar feed)
+//  4. RSVP (replying to an event invitation)
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authenticaion"
+	ScopeFeed           = "feed"
+	ScopeRSVP           = "rsvp"
 )
 
 // Token defines a struct to hold data for an individual
 // token. This includes the plaintext and hashed
-// versions of the token, associated userID, expiry
-// time, and scope.
+// versions of the token, associated userID or
+// attendeeID, expiry time, and scope.
 type Token struct {
-	Plaintext string    `json:"token"`
-	Hash      []byte    `json:"-"`
-	userID    int64     `json:"-"`
-	Expiry    time.Time `json:"expiry"`
-	Scope     string    `json:"-"`
+	Plaintext  string    `json:"token"`
+	Hash       []byte    `json:"-"`
+	userID     int64     `json:"-"`
+	attendeeID int64     `json:"-"`
+	Expiry     time.Time `json:"expiry"`
+	Scope      string    `json:"-"`
 }
 
 // TokenModel defines the TokenModel type.
@@ -136,19 +141,50 @@ func (m TokenModel) New(
 	return token, err
 }
 
+// NewForAttendee method creates an RSVP token for an
+// event attendee, who may not be a registered user,
+// and inserts it in the tokens table. The attendee's
+// earlier RSVP tokens are replaced.
+func (m TokenModel) NewForAttendee(attendeeID int64, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(0, ttl, ScopeRSVP)
+	if err != nil {
+		return nil, err
+	}
+	token.attendeeID = attendeeID
+
+	// Create a context with 3 second timeout
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(
+		ctx,
+		`DELETE FROM tokens WHERE scope = ? AND attendee_id = ?`,
+		ScopeRSVP,
+		attendeeID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(token)
+	return token, err
+}
+
 // Insert method adds the data for the specific token
-// to the tokens table.
+// to the tokens table. Tokens belong to either a user
+// or an attendee, and the other ID is stored as NULL.
 func (m TokenModel) Insert(token *Token) error {
 	// Create SQL query
 	query := `
-		INSERT INTO tokens (hash, user_id, expiry, scope)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO tokens (hash, user_id, attendee_id, expiry, scope)
+		VALUES (?, NULLIF(?, 0), NULLIF(?, 0), ?, ?)
 	`
 
 	// Create an args variable to hold the values
 	args := []interface{}{
 		token.Hash,
 		token.userID,
+		token.attendeeID,
 		token.Expiry,
 		token.Scope,
 	}
@@ -0,0 +1,261 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal"
+)
+
+// GetDeleted fetches an event in the trash by ID.
+func (e EventModel) GetDeleted(id int64) (*Event, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + eventColumns + `
+		FROM events
+		WHERE id = ?
+		AND deleted_at IS NOT NULL
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var event Event
+
+	err := scanEvent(e.DB.QueryRowContext(ctx, query, id), &event)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &event, nil
+}
+
+// GetAllDeleted returns the events in the trash,
+// sorted and paginated by the filters. If ownerID is
+// not 0, only events owned by that user, or in
+// calendars shared with them as an editor or above,
+// are returned.
+func (e EventModel) GetAllDeleted(ownerID int64, filters Filters) ([]*Event, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, COUNT(*) OVER()
+		FROM events
+		WHERE deleted_at IS NOT NULL
+		AND (? = 0 OR user_id = ? OR calendar_id IN (
+			SELECT calendar_id FROM calendar_shares
+			WHERE user_id = ? AND role IN (?, ?)
+		))
+		ORDER BY %s %s, id ASC
+		LIMIT ? OFFSET ?
+	`,
+		eventColumns,
+		filters.sortColumn(),
+		filters.sortDirection(),
+	)
+
+	args := []interface{}{
+		ownerID,
+		ownerID,
+		ownerID,
+		RoleEditor,
+		RoleOwner,
+		filters.limit(),
+		filters.offset(),
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := e.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	events := []*Event{}
+	for rows.Next() {
+		var event Event
+
+		err := scanEvent(rows, &event, &totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		events = append(events, &event)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return events, metadata, nil
+}
+
+// Restore takes an event out of the trash, and sets
+// its new updated time and version. The event's
+// UpdatedBy is the user restoring it. If its calendar
+// has been deleted, so it has none, it is restored to
+// its owner's default calendar.
+func (e EventModel) Restore(event *Event) error {
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := e.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(
+		ctx,
+		`SELECT EXISTS (SELECT 1 FROM calendars WHERE id = ?)`,
+		event.CalendarID,
+	).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	calendarID := event.CalendarID
+	if !exists {
+		calendar, err := getDefaultCalendar(ctx, tx, event.UserID)
+		if err != nil {
+			return err
+		}
+		calendarID = calendar.ID
+	}
+
+	query := `
+		UPDATE events
+		SET
+		deleted_at = NULL,
+		calendar_id = ?,
+		updated_at = ?,
+		updated_by = NULLIF(?, 0),
+		version = version + 1
+		WHERE id = ?
+		AND deleted_at IS NOT NULL
+		RETURNING updated_at, version
+	`
+
+	args := []interface{}{
+		calendarID,
+		internal.CurrentDate(),
+		event.UpdatedBy,
+		event.ID,
+	}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(
+		&event.UpdatedAt,
+		&event.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	event.CalendarID = calendarID
+	event.DeletedAt = nil
+	return nil
+}
+
+// Purge permanently deletes an event in the trash.
+// Its attendees, tags, attachments and reminder
+// deliveries are deleted by triggers, and the blobs of
+// its attachments recorded as orphaned.
+func (e EventModel) Purge(id int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := e.DB.ExecContext(
+		ctx,
+		`DELETE FROM events WHERE id = ? AND deleted_at IS NOT NULL`,
+		id,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeDeleted permanently deletes the events moved to
+// the trash before a time, in a single transaction,
+// returning the events purged.
+func (e EventModel) PurgeDeleted(before time.Time) ([]*Event, error) {
+	// Create a context with a 30 second timeout, since
+	// the trash may hold many events.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Begin the transaction. Rollback() is a no-op once
+	// the transaction has been committed.
+	tx, err := e.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Fetch the events before they are deleted, since
+	// their tags are removed with them.
+	ids, err := queryEventIDs(
+		ctx,
+		tx,
+		`SELECT id FROM events WHERE deleted_at IS NOT NULL AND deleted_at < ?`,
+		before.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	events, err := getEvents(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`DELETE FROM events WHERE deleted_at IS NOT NULL AND deleted_at < ?`,
+		before.UTC(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return events, tx.Commit()
+}
@@ -155,6 +155,46 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
+// Get retrieves the User details from the database
+// by ID.
+func (m UserModel) Get(id int64) (*User, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, name, email, password_hash, activated, created_at, updated_at, version
+		FROM users
+		WHERE id = ?
+	`
+
+	var user User
+
+	// Create a context with a 3 second timeout.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
 // Update the details for a specific user. Check
 // against the version field to prevent any race
 // conditions during the request cycle. Also check
@@ -275,7 +315,11 @@ func (m UserModel) GetForToken(
 	// details of the user associated with the token
 	// hash.
 	query := `
-		SELECT * FROM users
+		SELECT
+		users.id, users.name, users.email, users.password_hash,
+		users.activated, users.created_at, users.updated_at, users.version,
+		tokens.hash, tokens.user_id, tokens.expiry, tokens.scope
+		FROM users
 		INNER JOIN tokens
 		ON users.id = tokens.user_id
 		WHERE tokens.hash = ?
@@ -0,0 +1,673 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/robwestbrook/greenlight/internal"
+	"github.com/robwestbrook/greenlight/internal/validator"
+)
+
+// Define the statuses of a webhook delivery:
+//  1. DeliveryPending: waiting to be sent, or to be
+//     tried again
+//  2. DeliverySucceeded: the webhook's URL accepted it
+//  3. DeliveryFailed: every attempt to send it failed
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// Define the limits on webhook secrets:
+//  1. MinWebhookSecretLength: shortest secret in bytes
+//  2. MaxWebhookSecretLength: longest secret in bytes
+const (
+	MinWebhookSecretLength = 16
+	MaxWebhookSecretLength = 256
+)
+
+// maxListedDeliveries is the number of a webhook's
+// most recent deliveries GetDeliveries() returns.
+const maxListedDeliveries = 100
+
+// Webhook struct holds a subscription to changes to
+// the events its owner can see.
+// Fields:
+// 1.		ID: Unique ID for webhook
+// 2.		UserID: ID of the user who owns the webhook
+// 3.		URL: URL payloads are POSTed to
+// 4.		EventTypes: Types of change sent, from EventChangeTypes
+// 5.		Secret: Key payloads are signed with, only set when it is created or changed
+// 6.		Active: Whether payloads are sent
+// 7.		CreatedAt: Timestamp when webhook was created
+// 8.		UpdatedAt: Timestamp when webhook was updated
+// 9.		Version: Version starts at 1 and incremented on each update
+type Webhook struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"user_id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Version    int32     `json:"version"`
+}
+
+// WebhookDelivery struct holds a payload queued to be
+// sent to a webhook.
+// Fields:
+// 1.		ID: Unique ID for delivery
+// 2.		WebhookID: ID of the webhook it is sent to
+// 3.		EventType: Type of change, from EventChangeTypes
+// 4.		EventID: ID of the changed event
+// 5.		Status: DeliveryPending, DeliverySucceeded or DeliveryFailed
+// 6.		NextAttemptAt: Timestamp when it is next tried, while pending
+// 7.		Attempts: History of the attempts to send it
+// 8.		CreatedAt: Timestamp when it was queued
+// 9.		AttemptsMade: Number of attempts made to send it
+// 10.	URL: URL of the webhook, to send it to
+// 11.	Secret: Secret of the webhook, to sign it with
+// 12.	Payload: JSON body sent
+type WebhookDelivery struct {
+	ID            int64             `json:"id"`
+	WebhookID     int64             `json:"webhook_id"`
+	EventType     string            `json:"event_type"`
+	EventID       int64             `json:"event_id"`
+	Status        string            `json:"status"`
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"`
+	Attempts      []*WebhookAttempt `json:"attempts"`
+	CreatedAt     time.Time         `json:"created_at"`
+	AttemptsMade  int               `json:"-"`
+	URL           string            `json:"-"`
+	Secret        string            `json:"-"`
+	Payload       []byte            `json:"-"`
+}
+
+// WebhookAttempt struct holds the outcome of an
+// attempt to send a delivery.
+// Fields:
+// 1.		StatusCode: HTTP status of the response, 0 if none was received
+// 2.		Error: Why the attempt failed, empty if it succeeded
+// 3.		DurationMs: Time taken in milliseconds
+// 4.		AttemptedAt: Timestamp when it was attempted
+type WebhookAttempt struct {
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+// WebhookModel struct wraps an sql.DB connection pool.
+type WebhookModel struct {
+	DB *sql.DB
+}
+
+// ValidateWebhook runs the validator to validate
+// webhooks. The secret is only checked if it is set.
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(len(webhook.URL) <= 2048, "url", "must not be more than 2048 bytes long")
+	u, err := url.Parse(webhook.URL)
+	v.Check(
+		webhook.URL == "" || err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+		"url",
+		"must be an absolute http or https URL",
+	)
+
+	v.Check(len(webhook.EventTypes) > 0, "event_types", "must contain at least 1 event type")
+	v.Check(validator.Unique(webhook.EventTypes), "event_types", "must not contain duplicate values")
+	for _, eventType := range webhook.EventTypes {
+		if !validator.In(eventType, EventChangeTypes) {
+			v.AddError("event_types", "must only contain "+strings.Join(EventChangeTypes, ", "))
+			break
+		}
+	}
+
+	if webhook.Secret != "" {
+		v.Check(len(webhook.Secret) >= MinWebhookSecretLength, "secret", "must be at least 16 bytes long")
+		v.Check(len(webhook.Secret) <= MaxWebhookSecretLength, "secret", "must not be more than 256 bytes long")
+	}
+}
+
+// webhookColumns lists the webhooks table columns in
+// the order scanWebhook() expects them. The secret is
+// not selected, so it is only returned when it is set.
+const webhookColumns = `
+	id, user_id, url, event_types, active, created_at, updated_at, version
+`
+
+// scanWebhook scans a row selected with webhookColumns
+// into a webhook.
+func scanWebhook(row rowScanner, webhook *Webhook) error {
+	var eventTypes string
+
+	err := row.Scan(
+		&webhook.ID,
+		&webhook.UserID,
+		&webhook.URL,
+		&eventTypes,
+		&webhook.Active,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+		&webhook.Version,
+	)
+	if eventTypes != "" {
+		webhook.EventTypes = strings.Split(eventTypes, ",")
+	}
+	return err
+}
+
+// Insert a new record into the webhooks table. The
+// webhook must have a secret.
+func (m WebhookModel) Insert(webhook *Webhook) error {
+	query := `
+		INSERT INTO webhooks (user_id, url, event_types, secret, active, created_at, updated_at, version)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id, created_at, updated_at, version
+	`
+
+	args := []interface{}{
+		webhook.UserID,
+		webhook.URL,
+		internal.SliceToString(webhook.EventTypes),
+		webhook.Secret,
+		webhook.Active,
+		internal.CurrentDate(),
+		internal.CurrentDate(),
+		1,
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&webhook.ID,
+		&webhook.CreatedAt,
+		&webhook.UpdatedAt,
+		&webhook.Version,
+	)
+}
+
+// Get fetches a specific record by ID from the
+// webhooks table. If ownerID is not 0, only a webhook
+// owned by that user is returned.
+func (m WebhookModel) Get(id int64, ownerID int64) (*Webhook, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE id = ?
+		AND (? = 0 OR user_id = ?)
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var webhook Webhook
+
+	err := scanWebhook(m.DB.QueryRowContext(ctx, query, id, ownerID, ownerID), &webhook)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &webhook, nil
+}
+
+// GetAll returns the webhooks owned by a user, in the
+// order they were created. If ownerID is 0, the
+// webhooks of every user are returned.
+func (m WebhookModel) GetAll(ownerID int64) ([]*Webhook, error) {
+	query := `
+		SELECT ` + webhookColumns + `
+		FROM webhooks
+		WHERE (? = 0 OR user_id = ?)
+		ORDER BY id ASC
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ownerID, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+
+		err := scanWebhook(rows, &webhook)
+		if err != nil {
+			return nil, err
+		}
+
+		webhooks = append(webhooks, &webhook)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Update updates a specific record by ID in the
+// webhooks table, checking the version to prevent
+// edit conflicts. The secret is only changed if it is
+// set. If ownerID is not 0, only a webhook owned by
+// that user is updated.
+func (m WebhookModel) Update(webhook *Webhook, ownerID int64) error {
+	query := `
+		UPDATE webhooks
+		SET
+		url = ?,
+		event_types = ?,
+		secret = COALESCE(NULLIF(?, ''), secret),
+		active = ?,
+		updated_at = ?,
+		version = version + 1
+		WHERE id = ? AND version = ?
+		AND (? = 0 OR user_id = ?)
+		RETURNING updated_at, version
+	`
+
+	args := []interface{}{
+		webhook.URL,
+		internal.SliceToString(webhook.EventTypes),
+		webhook.Secret,
+		webhook.Active,
+		internal.CurrentDate(),
+		webhook.ID,
+		webhook.Version,
+		ownerID,
+		ownerID,
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// If no row is found, the webhook has been deleted
+	// or the version has changed.
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.UpdatedAt, &webhook.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes a specific record by ID from the
+// webhooks table. Its deliveries, and their attempts,
+// are deleted by triggers. If ownerID is not 0, only a
+// webhook owned by that user is deleted.
+func (m WebhookModel) Delete(id int64, ownerID int64) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(
+		ctx,
+		`DELETE FROM webhooks WHERE id = ? AND (? = 0 OR user_id = ?)`,
+		id,
+		ownerID,
+		ownerID,
+	)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Enqueue queues a payload for a change to an event,
+// to be sent to every active webhook for the type of
+// change whose owner can see the event: its owner,
+// users its calendar is shared with to view or edit
+// it, and admins. It returns the number of deliveries
+// queued.
+func (m WebhookModel) Enqueue(eventType string, event *Event, payload []byte) (int64, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event_type, event_id, payload, status, attempts, next_attempt_at, created_at, updated_at)
+		SELECT id, ?, ?, ?, ?, 0, ?, ?, ?
+		FROM webhooks
+		WHERE active = 1
+		AND instr(',' || event_types || ',', ',' || ? || ',') > 0
+		AND (user_id = ?
+			OR user_id IN (
+				SELECT user_id FROM calendar_shares
+				WHERE calendar_id = ? AND role <> ?
+			)
+			OR user_id IN (
+				SELECT up.user_id FROM users_permissions up
+				INNER JOIN permissions p
+				ON p.id = up.permission_id
+				WHERE p.code = 'events:admin'
+			)
+		)
+	`
+
+	now := internal.CurrentDate()
+	args := []interface{}{
+		eventType,
+		event.ID,
+		string(payload),
+		DeliveryPending,
+		now,
+		now,
+		now,
+		eventType,
+		event.UserID,
+		event.CalendarID,
+		RoleFreeBusy,
+	}
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DueDeliveries returns up to limit pending deliveries
+// whose next attempt is due at now, oldest first, with
+// the number of attempts made, and the URL and secret
+// of their webhook.
+func (m WebhookModel) DueDeliveries(now time.Time, limit int) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT d.id, d.webhook_id, d.event_type, d.event_id, d.payload, d.status,
+		d.next_attempt_at, d.created_at, d.attempts, w.url, w.secret
+		FROM webhook_deliveries d
+		INNER JOIN webhooks w
+		ON w.id = d.webhook_id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.next_attempt_at ASC, d.id ASC
+		LIMIT ?
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, DeliveryPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		var payload string
+
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.EventType,
+			&delivery.EventID,
+			&payload,
+			&delivery.Status,
+			&delivery.NextAttemptAt,
+			&delivery.CreatedAt,
+			&delivery.AttemptsMade,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Payload = []byte(payload)
+
+		deliveries = append(deliveries, &delivery)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// ClaimDelivery postpones the next attempt of a due
+// delivery until lease, before it is sent, so it is
+// not sent twice at once. If the sender stops before
+// recording the attempt, the delivery is tried again
+// once the lease has passed. It returns false if the
+// delivery had already been claimed, or is no longer
+// pending.
+func (m WebhookModel) ClaimDelivery(delivery *WebhookDelivery, now, lease time.Time) (bool, error) {
+	query := `
+		UPDATE webhook_deliveries
+		SET next_attempt_at = ?
+		WHERE id = ? AND status = ? AND next_attempt_at <= ?
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, lease.UTC(), delivery.ID, DeliveryPending, now.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rowsAffected == 1, nil
+}
+
+// RecordAttempt adds an attempt to the history of a
+// delivery, and sets the delivery's status, in a
+// single transaction. A pending delivery is tried again
+// at next.
+func (m WebhookModel) RecordAttempt(
+	delivery *WebhookDelivery,
+	attempt *WebhookAttempt,
+	status string,
+	next time.Time,
+) error {
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms, attempted_at)
+		VALUES (?, NULLIF(?, 0), ?, ?, ?)`,
+		delivery.ID,
+		attempt.StatusCode,
+		attempt.Error,
+		attempt.DurationMs,
+		attempt.AttemptedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+
+	// Finished deliveries have no next attempt.
+	var nextAttemptAt interface{}
+	if status == DeliveryPending {
+		nextAttemptAt = next.UTC()
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`UPDATE webhook_deliveries
+		SET status = ?, attempts = attempts + 1, next_attempt_at = ?, updated_at = ?
+		WHERE id = ?`,
+		status,
+		nextAttemptAt,
+		internal.CurrentDate(),
+		delivery.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetDeliveries returns the most recent deliveries of
+// a webhook, newest first, with the history of their
+// attempts.
+func (m WebhookModel) GetDeliveries(webhookID int64) ([]*WebhookDelivery, error) {
+	query := `
+		SELECT id, webhook_id, event_type, event_id, status, next_attempt_at, created_at
+		FROM webhook_deliveries
+		WHERE webhook_id = ?
+		ORDER BY id DESC
+		LIMIT ?
+	`
+
+	// Create a context with a 3 second timeout and defer.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookID, maxListedDeliveries)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []*WebhookDelivery{}
+	byID := make(map[int64]*WebhookDelivery)
+	for rows.Next() {
+		delivery := WebhookDelivery{Attempts: []*WebhookAttempt{}}
+
+		err := rows.Scan(
+			&delivery.ID,
+			&delivery.WebhookID,
+			&delivery.EventType,
+			&delivery.EventID,
+			&delivery.Status,
+			&delivery.NextAttemptAt,
+			&delivery.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		deliveries = append(deliveries, &delivery)
+		byID[delivery.ID] = &delivery
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(deliveries) == 0 {
+		return deliveries, nil
+	}
+
+	// Add the attempts of the listed deliveries, oldest
+	// first.
+	attemptRows, err := m.DB.QueryContext(
+		ctx,
+		`SELECT delivery_id, status_code, error, duration_ms, attempted_at
+		FROM webhook_delivery_attempts
+		WHERE delivery_id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE webhook_id = ?
+			ORDER BY id DESC
+			LIMIT ?
+		)
+		ORDER BY id ASC`,
+		webhookID,
+		maxListedDeliveries,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer attemptRows.Close()
+
+	for attemptRows.Next() {
+		var deliveryID int64
+		var statusCode sql.NullInt64
+		var attempt WebhookAttempt
+
+		err := attemptRows.Scan(
+			&deliveryID,
+			&statusCode,
+			&attempt.Error,
+			&attempt.DurationMs,
+			&attempt.AttemptedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attempt.StatusCode = int(statusCode.Int64)
+
+		if delivery, ok := byID[deliveryID]; ok {
+			delivery.Attempts = append(delivery.Attempts, &attempt)
+		}
+	}
+	if err = attemptRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// PruneDeliveries deletes the finished deliveries
+// queued before a time, with their attempts, returning
+// the number of deliveries deleted. Pending deliveries
+// are kept.
+func (m WebhookModel) PruneDeliveries(before time.Time) (int64, error) {
+	// Create a context with a 30 second timeout, since
+	// there may be many deliveries.
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(
+		ctx,
+		`DELETE FROM webhook_deliveries WHERE status <> ? AND created_at < ?`,
+		DeliveryPending,
+		before.UTC(),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,493 @@
+// Package ical reads and writes the RFC 5545
+// iCalendar format used by calendar clients such as
+// Outlook, Apple Calendar and Thunderbird.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Define the date and time value formats.
+//  1. DateTimeFormat: a UTC DATE-TIME value
+//  2. LocalDateTimeFormat: a floating or TZID DATE-TIME value
+//  3. DateFormat: a DATE value
+const (
+	DateTimeFormat      = "20060102T150405Z"
+	LocalDateTimeFormat = "20060102T150405"
+	DateFormat          = "20060102"
+)
+
+// maxLineLength is the maximum length of a content
+// line in octets, not including the line break.
+const maxLineLength = 75
+
+// Param holds a single property parameter, such as
+// VALUE=DATE or TZID=Europe/Berlin.
+type Param struct {
+	Name  string
+	Value string
+}
+
+// Property holds a single content line.
+type Property struct {
+	Name   string
+	Params []Param
+	Value  string
+}
+
+// Param returns the value of the named parameter, or
+// the empty string if it is not present.
+func (p Property) Param(name string) string {
+	for _, param := range p.Params {
+		if strings.EqualFold(param.Name, name) {
+			return param.Value
+		}
+	}
+	return ""
+}
+
+// Component holds a calendar component, such as
+// VCALENDAR or VEVENT, with its properties and any
+// nested components.
+type Component struct {
+	Name       string
+	Properties []Property
+	Components []*Component
+}
+
+// NewComponent returns an empty component.
+func NewComponent(name string) *Component {
+	return &Component{Name: name}
+}
+
+// Add appends a property to the component. The value
+// must already be escaped if it is a TEXT value.
+func (c *Component) Add(name, value string, params ...Param) {
+	c.Properties = append(c.Properties, Property{
+		Name:   name,
+		Params: params,
+		Value:  value,
+	})
+}
+
+// AddComponent appends a nested component.
+func (c *Component) AddComponent(child *Component) {
+	c.Components = append(c.Components, child)
+}
+
+// Encode writes the component, and all nested
+// components, to w as folded, CRLF terminated
+// content lines.
+func (c *Component) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	c.encode(bw)
+	return bw.Flush()
+}
+
+// encode writes the component to a buffered writer.
+func (c *Component) encode(w *bufio.Writer) {
+	writeLine(w, "BEGIN:"+c.Name)
+
+	for _, p := range c.Properties {
+		var line strings.Builder
+		line.WriteString(p.Name)
+		for _, param := range p.Params {
+			line.WriteString(";" + param.Name + "=" + quoteParam(param.Value))
+		}
+		line.WriteString(":" + p.Value)
+		writeLine(w, line.String())
+	}
+
+	for _, child := range c.Components {
+		child.encode(w)
+	}
+
+	writeLine(w, "END:"+c.Name)
+}
+
+// writeLine writes a content line, folding it so no
+// line is longer than maxLineLength octets. Folded
+// lines continue with a single space. Lines are only
+// split between UTF-8 characters.
+func writeLine(w *bufio.Writer, line string) {
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n ")
+		line = line[cut:]
+
+		// The leading space of a continuation line
+		// counts towards its length.
+		limit = maxLineLength - 1
+	}
+	w.WriteString(line + "\r\n")
+}
+
+// quoteParam double quotes a parameter value if it
+// contains a character that is not allowed unquoted.
+func quoteParam(value string) string {
+	if strings.ContainsAny(value, ";:,") {
+		return `"` + strings.ReplaceAll(value, `"`, "") + `"`
+	}
+	return value
+}
+
+// EscapeText escapes a TEXT value: backslashes,
+// semicolons, commas and newlines.
+func EscapeText(s string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(s)
+}
+
+// FormatDateTime formats t as a UTC DATE-TIME value.
+func FormatDateTime(t time.Time) string {
+	return t.UTC().Format(DateTimeFormat)
+}
+
+// FormatLocalDateTime formats t as a DATE-TIME value
+// in its own location, for use with a TZID parameter.
+func FormatLocalDateTime(t time.Time) string {
+	return t.Format(LocalDateTimeFormat)
+}
+
+// FormatDate formats t as a DATE value.
+func FormatDate(t time.Time) string {
+	return t.Format(DateFormat)
+}
+
+// Get returns the first property with the given name.
+// The boolean is false if there is no such property.
+func (c *Component) Get(name string) (Property, bool) {
+	for _, p := range c.Properties {
+		if strings.EqualFold(p.Name, name) {
+			return p, true
+		}
+	}
+	return Property{}, false
+}
+
+// GetAll returns every property with the given name.
+func (c *Component) GetAll(name string) []Property {
+	var props []Property
+	for _, p := range c.Properties {
+		if strings.EqualFold(p.Name, name) {
+			props = append(props, p)
+		}
+	}
+	return props
+}
+
+// Children returns the nested components with the
+// given name, such as the VEVENTs of a VCALENDAR.
+func (c *Component) Children(name string) []*Component {
+	var children []*Component
+	for _, child := range c.Components {
+		if strings.EqualFold(child.Name, name) {
+			children = append(children, child)
+		}
+	}
+	return children
+}
+
+// Decode reads an iCalendar stream from r and returns
+// its top level component, normally a VCALENDAR.
+// Folded lines are unfolded, and both CRLF and bare LF
+// line endings are accepted.
+func Decode(r io.Reader) (*Component, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use a stack to track the component currently
+	// being read.
+	var root *Component
+	var stack []*Component
+
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+
+		p, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		switch strings.ToUpper(p.Name) {
+		case "BEGIN":
+			c := NewComponent(strings.ToUpper(p.Value))
+			if len(stack) > 0 {
+				stack[len(stack)-1].AddComponent(c)
+			} else if root == nil {
+				root = c
+			} else {
+				return nil, fmt.Errorf("line %d: more than one top level component", i+1)
+			}
+			stack = append(stack, c)
+
+		case "END":
+			if len(stack) == 0 || !strings.EqualFold(stack[len(stack)-1].Name, p.Value) {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, p.Value)
+			}
+			stack = stack[:len(stack)-1]
+
+		default:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: property outside of a component", i+1)
+			}
+			stack[len(stack)-1].Properties = append(stack[len(stack)-1].Properties, p)
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("no calendar component found")
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("missing END:%s", stack[len(stack)-1].Name)
+	}
+
+	return root, nil
+}
+
+// unfold reads the content lines from r, joining
+// folded continuation lines (lines starting with a
+// space or tab) onto the line before.
+func unfold(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseLine parses a single unfolded content line of
+// the form NAME;PARAM=VALUE;...:VALUE. Parameter
+// values may be double quoted.
+func parseLine(line string) (Property, error) {
+	var p Property
+
+	// Read the property name.
+	i := strings.IndexAny(line, ";:")
+	if i <= 0 {
+		return p, fmt.Errorf("malformed content line %q", line)
+	}
+	p.Name = strings.ToUpper(line[:i])
+	rest := line[i:]
+
+	// Read the parameters, if any, up to the first
+	// colon outside of a quoted string.
+	for strings.HasPrefix(rest, ";") {
+		rest = rest[1:]
+
+		eq := strings.IndexByte(rest, '=')
+		if eq <= 0 {
+			return p, fmt.Errorf("malformed parameter in %q", line)
+		}
+		param := Param{Name: strings.ToUpper(rest[:eq])}
+		rest = rest[eq+1:]
+
+		var value strings.Builder
+		quoted := false
+		j := 0
+		for ; j < len(rest); j++ {
+			ch := rest[j]
+			if ch == '"' {
+				quoted = !quoted
+				continue
+			}
+			if !quoted && (ch == ';' || ch == ':') {
+				break
+			}
+			value.WriteByte(ch)
+		}
+		if quoted {
+			return p, fmt.Errorf("unterminated quoted parameter in %q", line)
+		}
+		param.Value = value.String()
+		p.Params = append(p.Params, param)
+		rest = rest[j:]
+	}
+
+	if !strings.HasPrefix(rest, ":") {
+		return p, fmt.Errorf("missing value in %q", line)
+	}
+	p.Value = rest[1:]
+
+	return p, nil
+}
+
+// UnescapeText reverses EscapeText.
+func UnescapeText(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n', 'N':
+				b.WriteByte('\n')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// SplitText splits a multi-valued TEXT value, such as
+// CATEGORIES, on unescaped commas and unescapes each
+// value.
+func SplitText(s string) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, UnescapeText(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(values, UnescapeText(s[start:]))
+}
+
+// ParseTime parses a DATE or DATE-TIME property, such
+// as DTSTART. The boolean is true for DATE values.
+// DATE-TIME values ending in "Z" are UTC, values with
+// a TZID parameter are read in the time zone zones
+// resolves it to, and floating values are read as UTC.
+func ParseTime(p Property, zones Zones) (time.Time, bool, error) {
+	times, isDate, err := ParseTimes(p, zones)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(times) != 1 {
+		return time.Time{}, false, fmt.Errorf("%s must contain a single value", p.Name)
+	}
+	return times[0], isDate, nil
+}
+
+// ParseTimes parses a property which may hold a comma
+// separated list of DATE or DATE-TIME values, such as
+// EXDATE. The boolean is true for DATE values.
+func ParseTimes(p Property, zones Zones) ([]time.Time, bool, error) {
+	loc := time.UTC
+	if tzid := p.Param("TZID"); tzid != "" {
+		var err error
+		loc, err = zones.Location(tzid)
+		if err != nil {
+			return nil, false, fmt.Errorf("%s has an unknown TZID %q", p.Name, tzid)
+		}
+	}
+
+	isDate := strings.EqualFold(p.Param("VALUE"), "DATE")
+
+	var times []time.Time
+	for _, value := range strings.Split(p.Value, ",") {
+		var t time.Time
+		var err error
+
+		switch {
+		case isDate || len(value) == len(DateFormat):
+			isDate = true
+			t, err = time.ParseInLocation(DateFormat, value, time.UTC)
+		case strings.HasSuffix(value, "Z"):
+			t, err = time.Parse(DateTimeFormat, value)
+		default:
+			t, err = time.ParseInLocation(LocalDateTimeFormat, value, loc)
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("%s has an invalid date or date-time %q", p.Name, value)
+		}
+		times = append(times, t)
+	}
+
+	return times, isDate, nil
+}
+
+// ParseDuration parses a DURATION value, such as
+// "PT1H30M", "P1D" or "-PT15M".
+func ParseDuration(s string) (time.Duration, error) {
+	invalid := fmt.Errorf("invalid duration %q", s)
+
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign = -1
+		s = s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, invalid
+	}
+	s = s[1:]
+
+	var d time.Duration
+	inTime := false
+	n := 0
+	digits := false
+	for _, ch := range s {
+		switch {
+		case ch >= '0' && ch <= '9':
+			n = n*10 + int(ch-'0')
+			digits = true
+			continue
+		case ch == 'T' && !inTime && !digits:
+			inTime = true
+			continue
+		}
+		if !digits {
+			return 0, invalid
+		}
+
+		switch {
+		case ch == 'W' && !inTime:
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case ch == 'D' && !inTime:
+			d += time.Duration(n) * 24 * time.Hour
+		case ch == 'H' && inTime:
+			d += time.Duration(n) * time.Hour
+		case ch == 'M' && inTime:
+			d += time.Duration(n) * time.Minute
+		case ch == 'S' && inTime:
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, invalid
+		}
+		n = 0
+		digits = false
+	}
+	if digits {
+		return 0, invalid
+	}
+
+	return sign * d, nil
+}
@@ -0,0 +1,236 @@
+package ical
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Timezone returns a VTIMEZONE component describing
+// loc, which must accompany any TZID parameter naming
+// it. The daylight saving changes of loc in year are
+// written as yearly recurring observances starting in
+// that year, in the way most calendar clients describe
+// time zones. A zone without changes in year has a
+// single STANDARD observance.
+func Timezone(loc *time.Location, year int) *Component {
+	vtimezone := NewComponent("VTIMEZONE")
+	vtimezone.Add("TZID", loc.String())
+
+	transitions := yearTransitions(loc, year)
+	if len(transitions) == 0 {
+		name, offset := time.Date(year, time.January, 1, 0, 0, 0, 0, loc).Zone()
+
+		standard := NewComponent("STANDARD")
+		standard.Add("DTSTART", fmt.Sprintf("%04d0101T000000", year))
+		standard.Add("TZOFFSETFROM", formatOffset(offset))
+		standard.Add("TZOFFSETTO", formatOffset(offset))
+		standard.Add("TZNAME", name)
+		vtimezone.AddComponent(standard)
+		return vtimezone
+	}
+
+	for _, t := range transitions {
+		_, from := t.Add(-time.Second).In(loc).Zone()
+		name, to := t.In(loc).Zone()
+
+		kind := "STANDARD"
+		if t.In(loc).IsDST() {
+			kind = "DAYLIGHT"
+		}
+
+		// The observance starts at the wall clock time of
+		// the change, in the offset in use before it.
+		local := t.In(time.FixedZone("", from))
+
+		observance := NewComponent(kind)
+		observance.Add("DTSTART", local.Format(LocalDateTimeFormat))
+		observance.Add("RRULE", fmt.Sprintf(
+			"FREQ=YEARLY;BYMONTH=%d;BYDAY=%s",
+			local.Month(),
+			ordinalWeekday(local),
+		))
+		observance.Add("TZOFFSETFROM", formatOffset(from))
+		observance.Add("TZOFFSETTO", formatOffset(to))
+		observance.Add("TZNAME", name)
+		vtimezone.AddComponent(observance)
+	}
+
+	return vtimezone
+}
+
+// yearTransitions returns the instants in year at
+// which the UTC offset of loc changes. Each day is
+// checked for a change, which is then found to the
+// second by bisection.
+func yearTransitions(loc *time.Location, year int) []time.Time {
+	var transitions []time.Time
+
+	day := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+	end := day.AddDate(1, 0, 0)
+	for ; day.Before(end); day = day.AddDate(0, 0, 1) {
+		next := day.AddDate(0, 0, 1)
+		_, before := day.In(loc).Zone()
+		_, after := next.In(loc).Zone()
+		if before == after {
+			continue
+		}
+
+		lo, hi := day, next
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2).Truncate(time.Second)
+			if _, offset := mid.In(loc).Zone(); offset == before {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		transitions = append(transitions, hi)
+	}
+
+	return transitions
+}
+
+// ordinalWeekday returns the BYDAY value matching the
+// date of t in a yearly rule, such as "2SU" for the
+// second Sunday of the month, or "-1SU" for the last.
+func ordinalWeekday(t time.Time) string {
+	days := [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+	daysInMonth := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if t.Day() > daysInMonth-7 {
+		return "-1" + days[t.Weekday()]
+	}
+	return fmt.Sprintf("%d%s", (t.Day()-1)/7+1, days[t.Weekday()])
+}
+
+// formatOffset formats a UTC offset in seconds as a
+// UTC-OFFSET value, such as "+0100" or "-0430".
+func formatOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	s := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset/60%60)
+	if offset%60 != 0 {
+		s += fmt.Sprintf("%02d", offset%60)
+	}
+	return s
+}
+
+// Zones maps the TZIDs defined by the VTIMEZONE
+// components of a calendar to IANA time zone names.
+type Zones map[string]string
+
+// CalendarZones returns the time zones defined by the
+// VTIMEZONE components of a calendar. A VTIMEZONE is
+// resolved to the IANA zone in its X-LIC-LOCATION
+// property, which many clients add, or, if it only has
+// one UTC offset of whole hours, to the Etc/GMT zone
+// with that offset. Other VTIMEZONEs are left out, and
+// their TZIDs are resolved by name by Location().
+func CalendarZones(calendar *Component) Zones {
+	zones := make(Zones)
+	for _, vtimezone := range calendar.Children("VTIMEZONE") {
+		tzid, ok := vtimezone.Get("TZID")
+		if !ok || tzid.Value == "" {
+			continue
+		}
+
+		if p, ok := vtimezone.Get("X-LIC-LOCATION"); ok {
+			if _, err := time.LoadLocation(p.Value); err == nil {
+				zones[tzid.Value] = p.Value
+				continue
+			}
+		}
+
+		if name, ok := fixedZoneName(vtimezone); ok {
+			zones[tzid.Value] = name
+		}
+	}
+	return zones
+}
+
+// fixedZoneName returns the Etc/GMT zone of a
+// VTIMEZONE whose observances all have the same UTC
+// offset of whole hours. The sign of an Etc/GMT zone
+// is the reverse of its offset, so UTC+3 is Etc/GMT-3.
+func fixedZoneName(vtimezone *Component) (string, bool) {
+	var observances []*Component
+	observances = append(observances, vtimezone.Children("STANDARD")...)
+	observances = append(observances, vtimezone.Children("DAYLIGHT")...)
+	if len(observances) == 0 {
+		return "", false
+	}
+
+	offset := 0
+	for i, observance := range observances {
+		p, ok := observance.Get("TZOFFSETTO")
+		if !ok {
+			return "", false
+		}
+		o, err := parseOffset(p.Value)
+		if err != nil || i > 0 && o != offset {
+			return "", false
+		}
+		offset = o
+	}
+
+	hours := offset / 3600
+	switch {
+	case offset%3600 != 0 || hours < -12 || hours > 14:
+		return "", false
+	case hours == 0:
+		return "Etc/UTC", true
+	case hours > 0:
+		return fmt.Sprintf("Etc/GMT-%d", hours), true
+	default:
+		return fmt.Sprintf("Etc/GMT+%d", -hours), true
+	}
+}
+
+// parseOffset parses a UTC-OFFSET value, such as
+// "-0500" or "+053000", into seconds east of UTC.
+func parseOffset(s string) (int, error) {
+	invalid := fmt.Errorf("invalid UTC offset %q", s)
+	if len(s) != 5 && len(s) != 7 || s[0] != '+' && s[0] != '-' {
+		return 0, invalid
+	}
+
+	seconds := 0
+	for i, unit := range []int{3600, 60, 1} {
+		if 1+2*i >= len(s) {
+			break
+		}
+		n, err := strconv.Atoi(s[1+2*i : 3+2*i])
+		if err != nil || n < 0 {
+			return 0, invalid
+		}
+		seconds += n * unit
+	}
+	if s[0] == '-' {
+		seconds = -seconds
+	}
+	return seconds, nil
+}
+
+// Location returns the time zone a TZID parameter
+// names, whose String() is its IANA name. The TZID may
+// be an IANA time zone name, a TZID defined by one of
+// the calendar's VTIMEZONEs, or a Windows time zone
+// name, such as "Eastern Standard Time", used by
+// Outlook and Exchange.
+func (z Zones) Location(tzid string) (*time.Location, error) {
+	if loc, err := time.LoadLocation(strings.TrimPrefix(tzid, "/")); err == nil {
+		return loc, nil
+	}
+	if name, ok := z[tzid]; ok {
+		return time.LoadLocation(name)
+	}
+	if name, ok := windowsZones[tzid]; ok {
+		return time.LoadLocation(name)
+	}
+	return nil, fmt.Errorf("unknown time zone %q", tzid)
+}
@@ -3,6 +3,8 @@ package internal
 import (
 	"crypto/rand"
 	"encoding/base64"
+	"fmt"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -11,6 +13,15 @@ import (
 // date and time to a SQLite-friendly datetime.
 const dbTimeFormat = "2006-01-02 15:04:05"
 
+// queryTimeFormats defines the formats accepted for
+// dates and times supplied in a query string.
+var queryTimeFormats = []string{
+	dbTimeFormat,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
 // StringToTime function takes in a time string
 // from SQLite. It returns a GO time.Time format.
 // A METHOD on the APPLICATION struct.
@@ -35,10 +46,88 @@ func TimeToString(timeToCovert time.Time) string {
 	return ""
 }
 
+// ParseTimeString function parses a date or date and
+// time string in any of the queryTimeFormats. Unlike
+// StringToTime, an error is returned if the string
+// cannot be parsed.
+func ParseTimeString(stringToConvert string) (time.Time, error) {
+	var err error
+	for _, layout := range queryTimeFormats {
+		var res time.Time
+		res, err = time.Parse(layout, stringToConvert)
+		if err == nil {
+			return res, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// StringToTimeIn function parses a date and time
+// string from a request. Strings with a UTC offset,
+// such as RFC 3339 times, are read as that instant.
+// Strings without an offset are read as a wall clock
+// time in loc. The time is returned in UTC, or as the
+// zero time if the string is empty. An error is
+// returned if the string cannot be parsed.
+func StringToTimeIn(stringToConvert string, loc *time.Location) (time.Time, error) {
+	if stringToConvert == "" {
+		return time.Time{}, nil
+	}
+	if res, err := time.Parse(time.RFC3339, stringToConvert); err == nil {
+		return res.UTC(), nil
+	}
+	var err error
+	for _, layout := range queryTimeFormats {
+		var res time.Time
+		res, err = time.ParseInLocation(layout, stringToConvert, loc)
+		if err == nil {
+			return res.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// StringToDate function parses a date, or a date and
+// time string from a request, keeping only the date.
+// Dates float: they are returned as midnight UTC on the
+// date as written, whatever UTC offset the string has,
+// so they are never shifted between time zones. The
+// zero time is returned if the string is empty. An
+// error is returned if the string cannot be parsed.
+func StringToDate(stringToConvert string) (time.Time, error) {
+	if stringToConvert == "" {
+		return time.Time{}, nil
+	}
+	res, err := ParseTimeString(stringToConvert)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return FloatingDate(res), nil
+}
+
+// FloatingDate function returns midnight UTC on the
+// date t falls on in its own location.
+func FloatingDate(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// LoadTimeZone function loads an IANA time zone, such
+// as "Europe/Berlin" or "UTC". Unlike time.LoadLocation,
+// the empty name and "Local" are rejected, since they
+// depend on the server's configuration.
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return time.LoadLocation(name)
+}
+
 // CurrentDate function generates a GO time.Time
-// for the current date and time.
+// for the current date and time in UTC, so that
+// stored times compare correctly as strings.
 func CurrentDate() time.Time {
-	return time.Now()
+	return time.Now().UTC()
 }
 
 // StringToSlice converts a comma-delimited string
@@ -69,6 +158,64 @@ func SliceToString(s []string) string {
 	return ""
 }
 
+// TimesToString converts a slice of Go time.Time
+// values into a comma-delimited string for SQLite.
+func TimesToString(times []time.Time) string {
+	s := make([]string, len(times))
+	for i, t := range times {
+		s[i] = TimeToString(t)
+	}
+	return SliceToString(s)
+}
+
+// StringToTimes converts a comma-delimited string from
+// SQLite into a slice of Go time.Time values.
+func StringToTimes(str string) []time.Time {
+	if str == "" {
+		return nil
+	}
+
+	return StringsToTimes(strings.Split(str, ","))
+}
+
+// StringsToTimes converts a slice of time strings
+// into a slice of Go time.Time values.
+func StringsToTimes(strs []string) []time.Time {
+	var times []time.Time
+	for _, s := range strs {
+		times = append(times, StringToTime(s))
+	}
+	return times
+}
+
+// IntsToString converts a slice of integers into a
+// comma-delimited string for SQLite.
+func IntsToString(ints []int) string {
+	s := make([]string, len(ints))
+	for i, n := range ints {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ",")
+}
+
+// StringToInts converts a comma-delimited string from
+// SQLite into a slice of integers. Values which are not
+// integers are skipped.
+func StringToInts(str string) []int {
+	if str == "" {
+		return nil
+	}
+
+	var ints []int
+	for _, s := range strings.Split(str, ",") {
+		n, err := strconv.Atoi(s)
+		if err == nil {
+			ints = append(ints, n)
+		}
+	}
+	return ints
+}
+
 // GenerateRandomString generate a random string of
 // a supplied length.
 func GenerateRandomString(length int) (string, error) {
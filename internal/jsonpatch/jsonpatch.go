@@ -0,0 +1,518 @@
+// Package jsonpatch applies JSON Merge Patch (RFC 7396)
+// and JSON Patch (RFC 6902) documents to JSON
+// documents. JSON Patch supports the add, remove,
+// replace, move, copy and test operations, with
+// JSON Pointer (RFC 6901) paths including array
+// indexes and "-" for the end of an array.
+package jsonpatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Define the errors returned when a patch can't be
+// applied:
+//  1. ErrInvalidPatch: the patch is not valid JSON, or
+//     not a valid JSON Patch document
+//  2. ErrPathNotFound: an operation refers to a
+//     location which doesn't exist in the document
+//  3. ErrTestFailed: a test operation failed
+var (
+	ErrInvalidPatch = errors.New("invalid patch")
+	ErrPathNotFound = errors.New("path not found")
+	ErrTestFailed   = errors.New("test failed")
+)
+
+// operation holds one operation of a JSON Patch
+// document. A Value of nil means the member was left
+// out, while JSON null is kept as "null".
+type operation struct {
+	Op    string          `json:"op"`
+	Path  *string         `json:"path"`
+	From  *string         `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// MergePatch applies a JSON Merge Patch to a document,
+// returning the patched document. Members of the patch
+// replace the members of the document, nested objects
+// are merged, and null members remove the member from
+// the document.
+func MergePatch(doc []byte, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	return json.Marshal(mergePatch(target, p))
+}
+
+// mergePatch merges a patch value into a target value,
+// following the MergePatch algorithm of RFC 7396.
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+	for name, value := range p {
+		if value == nil {
+			delete(t, name)
+		} else {
+			t[name] = mergePatch(t[name], value)
+		}
+	}
+	return t
+}
+
+// MergePatchMembers returns the names of the
+// top-level members of a document which a JSON Merge
+// Patch changes, sorted by name. A patch which isn't an object
+// replaces the whole document, and has no members.
+func MergePatchMembers(patch []byte) ([]string, error) {
+	p, err := decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	object, ok := p.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	members := make([]string, 0, len(object))
+	for name := range object {
+		members = append(members, name)
+	}
+	sort.Strings(members)
+	return members, nil
+}
+
+// Apply applies a JSON Patch to a document, returning
+// the patched document. The operations are applied in
+// order, and if any fails the error says which, and no
+// document is returned.
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	target, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var operations []operation
+	err = json.Unmarshal(patch, &operations)
+	if err != nil {
+		return nil, fmt.Errorf("%w: must be a JSON array of operations", ErrInvalidPatch)
+	}
+
+	for i, op := range operations {
+		target, err = op.apply(target)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s): %w", i, op.Op, err)
+		}
+	}
+
+	return json.Marshal(target)
+}
+
+// Members returns the names of the top-level members
+// of a document which the operations of a JSON Patch
+// refer to, in their path or from location. A location
+// which is the whole document has no member.
+func Members(patch []byte) ([]string, error) {
+	var operations []operation
+	err := json.Unmarshal(patch, &operations)
+	if err != nil {
+		return nil, fmt.Errorf("%w: must be a JSON array of operations", ErrInvalidPatch)
+	}
+
+	var members []string
+	for _, op := range operations {
+		for _, pointer := range []*string{op.Path, op.From} {
+			if pointer == nil {
+				continue
+			}
+			path, err := parsePointer(*pointer)
+			if err != nil {
+				return nil, err
+			}
+			if len(path) > 0 {
+				members = append(members, path[0])
+			}
+		}
+	}
+	return members, nil
+}
+
+// apply applies the operation to a document, returning
+// the patched document.
+func (op operation) apply(doc interface{}) (interface{}, error) {
+	if op.Path == nil {
+		return nil, fmt.Errorf("%w: path must be provided", ErrInvalidPatch)
+	}
+	path, err := parsePointer(*op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		value, err := op.value()
+		if err != nil {
+			return nil, err
+		}
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			return replace(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equal(current, value) {
+				return nil, fmt.Errorf("%w: %s does not have the expected value", ErrTestFailed, *op.Path)
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		return remove(doc, path)
+
+	case "move", "copy":
+		if op.From == nil {
+			return nil, fmt.Errorf("%w: from must be provided", ErrInvalidPatch)
+		}
+		from, err := parsePointer(*op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "copy" {
+			// Copy the value, so the two locations don't
+			// share maps or slices.
+			value, err = deepCopy(value)
+			if err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		}
+
+		// A location can't be moved into one of its own
+		// children.
+		if strings.HasPrefix(*op.Path, *op.From+"/") {
+			return nil, fmt.Errorf("%w: path must not be inside from", ErrInvalidPatch)
+		}
+		doc, err = remove(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, path, value)
+
+	default:
+		return nil, fmt.Errorf("%w: op must be add, remove, replace, move, copy or test", ErrInvalidPatch)
+	}
+}
+
+// value decodes the value member of the operation.
+func (op operation) value() (interface{}, error) {
+	if op.Value == nil {
+		return nil, fmt.Errorf("%w: value must be provided", ErrInvalidPatch)
+	}
+	value, err := decode(op.Value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return value, nil
+}
+
+// parsePointer splits a JSON Pointer into its
+// reference tokens, unescaping "~1" to "/" and "~0"
+// to "~". The empty pointer refers to the whole
+// document and has no tokens.
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: %q must be empty or start with /", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// get returns the value at a location in a document.
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, notFound(token)
+			}
+			doc = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, notFound(token)
+		}
+	}
+	return doc, nil
+}
+
+// add adds a value to a document: a member of an
+// object is added or replaced, and a value is inserted
+// into an array before the index, or at the end for
+// "-". Adding at the root replaces the document.
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i := len(node)
+			if token != "-" {
+				var err error
+				i, err = arrayIndex(token, len(node))
+				if err != nil {
+					return nil, err
+				}
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		default:
+			return nil, notFound(token)
+		}
+	})
+}
+
+// remove removes the value at a location from a
+// document. The whole document can't be removed.
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("%w: the whole document can't be removed", ErrInvalidPatch)
+	}
+
+	return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, notFound(token)
+			}
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:i], node[i+1:]...), nil
+		default:
+			return nil, notFound(token)
+		}
+	})
+}
+
+// replace replaces the value at a location in a
+// document, which must exist.
+func replace(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	return update(doc, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, notFound(token)
+			}
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			node[i] = value
+			return node, nil
+		default:
+			return nil, notFound(token)
+		}
+	})
+}
+
+// update walks a document to the parent of the
+// location at the end of a path, which must not be
+// empty, and replaces the parent with the value
+// returned by change. Arrays may be reallocated when
+// they grow or shrink, so each container on the way
+// is stored back in its own parent.
+func update(
+	doc interface{},
+	path []string,
+	change func(parent interface{}, token string) (interface{}, error),
+) (interface{}, error) {
+	if len(path) == 1 {
+		return change(doc, path[0])
+	}
+
+	token := path[0]
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[token]
+		if !ok {
+			return nil, notFound(token)
+		}
+		child, err := update(child, path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[token] = child
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(token, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		child, err := update(node[i], path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = child
+		return node, nil
+	default:
+		return nil, notFound(token)
+	}
+}
+
+// arrayIndex reads an array index token, which must
+// be a number without leading zeros no greater than
+// max.
+func arrayIndex(token string, max int) (int, error) {
+	if token == "" || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrInvalidPatch, token)
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("%w: %q is not an array index", ErrInvalidPatch, token)
+	}
+	if i > max {
+		return 0, notFound(token)
+	}
+	return i, nil
+}
+
+// notFound returns an ErrPathNotFound error for a
+// reference token.
+func notFound(token string) error {
+	return fmt.Errorf("%w: %q", ErrPathNotFound, token)
+}
+
+// decode decodes a JSON value, keeping numbers as
+// json.Number so they are written back as they were.
+func decode(js []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	var value interface{}
+	err := dec.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("must contain a single JSON value")
+	}
+	return value, nil
+}
+
+// deepCopy returns a copy of a decoded JSON value
+// sharing no maps or slices with it.
+func deepCopy(value interface{}) (interface{}, error) {
+	js, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return decode(js)
+}
+
+// equal reports whether two decoded JSON values are
+// equal, as the test operation defines it: numbers are
+// compared by value, arrays element by element in
+// order, and objects member by member in any order.
+func equal(a, b interface{}) bool {
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case bool:
+		b, ok := b.(bool)
+		return ok && a == b
+	case string:
+		b, ok := b.(string)
+		return ok && a == b
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for name, value := range a {
+			other, ok := b[name]
+			if !ok || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
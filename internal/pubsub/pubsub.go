@@ -0,0 +1,225 @@
+// Package pubsub is an in-process publish/subscribe
+// broker. Published messages are sent to every
+// subscriber, and the most recent are kept in a
+// bounded replay buffer, so a subscriber which
+// reconnects can resume after the last message it
+// received.
+package pubsub
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Define the errors a Broker returns:
+//  1. ErrClosed: the broker has been closed
+//  2. ErrReplayGap: messages after the ID can't be
+//     replayed, since they are no longer buffered, or
+//     the ID was not given out by this broker
+//  3. ErrSlowSubscriber: a subscription was closed
+//     because it fell behind
+var (
+	ErrClosed         = errors.New("broker closed")
+	ErrReplayGap      = errors.New("messages can't be replayed")
+	ErrSlowSubscriber = errors.New("subscriber too slow")
+)
+
+// subscriptionBuffer is the number of messages a
+// subscription holds before it falls behind.
+const subscriptionBuffer = 64
+
+// Message struct holds a published message.
+// Fields:
+// 1.		ID: Sequence number, which increases with each message
+// 2.		Type: Type of message, such as "event.created"
+// 3.		Data: Payload sent to subscribers
+// 4.		Value: Value the message is about, which subscribers may filter on
+type Message struct {
+	ID    uint64
+	Type  string
+	Data  []byte
+	Value interface{}
+}
+
+// Broker sends published messages to subscribers. It
+// is safe for concurrent use.
+type Broker struct {
+	mu     sync.Mutex
+	lastID uint64
+	buffer []Message
+	next   int
+	full   bool
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// New returns a Broker which keeps the last size
+// messages for replay. Message IDs start from the
+// current time in microseconds, so they keep
+// increasing when the server is restarted, and IDs
+// given out before a restart are not mistaken for new
+// ones.
+func New(size int) *Broker {
+	return &Broker{
+		lastID: uint64(time.Now().UnixMicro()),
+		buffer: make([]Message, size),
+		subs:   make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish sends a message to every subscriber, and
+// adds it to the replay buffer. Subscribers which have
+// fallen behind are closed with ErrSlowSubscriber,
+// rather than blocking the publisher.
+func (b *Broker) Publish(typ string, data []byte, value interface{}) Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	msg := Message{ID: b.lastID, Type: typ, Data: data, Value: value}
+
+	if len(b.buffer) > 0 {
+		b.buffer[b.next] = msg
+		b.next = (b.next + 1) % len(b.buffer)
+		if b.next == 0 {
+			b.full = true
+		}
+	}
+
+	for sub := range b.subs {
+		select {
+		case sub.c <- msg:
+		default:
+			b.remove(sub, ErrSlowSubscriber)
+		}
+	}
+
+	return msg
+}
+
+// Subscribe returns a subscription to the messages
+// published from now on.
+func (b *Broker) Subscribe() (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribe()
+}
+
+// SubscribeAfter returns a subscription to the
+// messages published from now on, and the buffered
+// messages after the one with the ID, which were
+// missed. If they can't all be replayed, ErrReplayGap
+// is returned with the subscription, and no messages.
+func (b *Broker) SubscribeAfter(id uint64) (*Subscription, []Message, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub, err := b.subscribe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The buffered messages run from the oldest to
+	// lastID. The message with the ID must be among
+	// them, or be the one just before the oldest.
+	buffered := b.buffered()
+	oldest := b.lastID + 1
+	if len(buffered) > 0 {
+		oldest = buffered[0].ID
+	}
+	if id > b.lastID || id+1 < oldest {
+		return sub, nil, ErrReplayGap
+	}
+
+	replay := []Message{}
+	for _, msg := range buffered {
+		if msg.ID > id {
+			replay = append(replay, msg)
+		}
+	}
+	return sub, replay, nil
+}
+
+// Close closes every subscription with ErrClosed, and
+// stops new subscriptions. Messages can still be
+// published.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.remove(sub, ErrClosed)
+	}
+}
+
+// subscribe adds a subscription. The lock must be
+// held.
+func (b *Broker) subscribe() (*Subscription, error) {
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	sub := &Subscription{
+		broker: b,
+		c:      make(chan Message, subscriptionBuffer),
+	}
+	b.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// remove closes a subscription with the error, if it
+// is still open. The lock must be held.
+func (b *Broker) remove(sub *Subscription, err error) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	sub.err = err
+	close(sub.c)
+}
+
+// buffered returns the messages in the replay buffer,
+// oldest first. The lock must be held.
+func (b *Broker) buffered() []Message {
+	if b.full {
+		return append(append([]Message{}, b.buffer[b.next:]...), b.buffer[:b.next]...)
+	}
+	return append([]Message{}, b.buffer[:b.next]...)
+}
+
+// Subscription receives the messages published to a
+// Broker.
+type Subscription struct {
+	broker *Broker
+	c      chan Message
+	err    error
+}
+
+// C returns the channel messages are received on. It
+// is closed when the subscription is closed, after
+// which Err() reports why.
+func (s *Subscription) C() <-chan Message {
+	return s.c
+}
+
+// Err returns ErrClosed if the broker was closed, or
+// ErrSlowSubscriber if the subscription fell behind,
+// once C() is closed. It returns nil if the
+// subscription was closed by Close(), or is open.
+func (s *Subscription) Err() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	return s.err
+}
+
+// Close stops the subscription, and closes C().
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.broker.remove(s, nil)
+}
@@ -0,0 +1,582 @@
+// Package rrule implements the subset of the RFC 5545
+// recurrence rule grammar used by events. Supported
+// rule parts are FREQ, INTERVAL, BYDAY, BYMONTHDAY,
+// COUNT, UNTIL and WKST.
+package rrule
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequency defines the type for the FREQ rule part.
+type Frequency string
+
+// Define constants for the supported frequencies.
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// maxPeriods caps the number of periods (days, weeks,
+// months or years) walked while expanding a rule.
+const maxPeriods = 100_000
+
+// maxGapYears caps the time walked without finding an
+// occurrence, from dtstart or the previous occurrence.
+// It protects the server from rules which never
+// produce an occurrence, such as "FREQ=YEARLY;
+// BYMONTHDAY=31;BYDAY=1MO", which would otherwise be
+// walked through maxPeriods periods. The longest real
+// gaps, such as a February 29 which falls on a
+// Monday, are well under a century.
+const maxGapYears = 100
+
+// periodsPerYear is the most periods of each frequency
+// in a year.
+var periodsPerYear = map[Frequency]int{
+	Daily:   366,
+	Weekly:  53,
+	Monthly: 12,
+	Yearly:  1,
+}
+
+// untilLayouts are the two UNTIL value formats allowed
+// by RFC 5545: a UTC DATE-TIME or a DATE.
+var untilLayouts = []string{
+	"20060102T150405Z",
+	"20060102T150405",
+	"20060102",
+}
+
+// weekdays maps the two letter RFC 5545 day codes to
+// Go weekdays.
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// WeekdayNum holds a single BYDAY entry. N is the
+// optional ordinal ("1MO" is the first Monday, "-1FR"
+// the last Friday). An N of zero means every such day.
+type WeekdayNum struct {
+	N       int
+	Weekday time.Weekday
+}
+
+// Rule holds a parsed recurrence rule.
+// Fields:
+//  1. Freq: DAILY, WEEKLY, MONTHLY or YEARLY
+//  2. Interval: number of periods between repeats
+//  3. ByDay: days of the week the rule expands to
+//  4. ByMonthDay: days of the month the rule expands to
+//  5. Count: maximum number of occurrences (0 = none)
+//  6. Until: last possible occurrence (zero = none)
+//  7. WeekStart: first day of the week (default Monday)
+type Rule struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+	WeekStart  time.Weekday
+}
+
+// Parse parses an RRULE value such as
+// "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE;COUNT=10". An
+// optional leading "RRULE:" is ignored.
+func Parse(s string) (*Rule, error) {
+	r := &Rule{Interval: 1, WeekStart: time.Monday}
+
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "RRULE:")
+
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return nil, fmt.Errorf("malformed rule part %q", part)
+		}
+
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			freq := Frequency(strings.ToUpper(value))
+			switch freq {
+			case Daily, Weekly, Monthly, Yearly:
+				r.Freq = freq
+			default:
+				return nil, fmt.Errorf("unsupported FREQ value %q", value)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, errors.New("INTERVAL must be a positive integer")
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, errors.New("COUNT must be a positive integer")
+			}
+			r.Count = n
+		case "UNTIL":
+			t, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wn, err := parseWeekdayNum(day)
+				if err != nil {
+					return nil, err
+				}
+				r.ByDay = append(r.ByDay, wn)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(day)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("invalid BYMONTHDAY value %q", day)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, n)
+			}
+		case "WKST":
+			wd, ok := weekdays[strings.ToUpper(value)]
+			if !ok {
+				return nil, fmt.Errorf("invalid WKST value %q", value)
+			}
+			r.WeekStart = wd
+		default:
+			return nil, fmt.Errorf("unsupported rule part %q", name)
+		}
+	}
+
+	// Check the rule parts make sense together.
+	if r.Freq == "" {
+		return nil, errors.New("FREQ must be provided")
+	}
+	if r.Count > 0 && !r.Until.IsZero() {
+		return nil, errors.New("COUNT and UNTIL must not both be provided")
+	}
+	if r.Freq == Daily || r.Freq == Weekly {
+		for _, wn := range r.ByDay {
+			if wn.N != 0 {
+				return nil, errors.New("BYDAY ordinals are only allowed with MONTHLY or YEARLY")
+			}
+		}
+	}
+	if r.Freq == Weekly && len(r.ByMonthDay) > 0 {
+		return nil, errors.New("BYMONTHDAY is not allowed with WEEKLY")
+	}
+
+	return r, nil
+}
+
+// parseUntil parses an UNTIL value in any of the
+// untilLayouts formats.
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range untilLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid UNTIL value %q", value)
+}
+
+// parseWeekdayNum parses a single BYDAY entry such as
+// "MO", "2TU" or "-1FR".
+func parseWeekdayNum(s string) (WeekdayNum, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY value %q", s)
+	}
+
+	wd, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return WeekdayNum{}, fmt.Errorf("invalid BYDAY value %q", s)
+	}
+
+	wn := WeekdayNum{Weekday: wd}
+	if ordinal := s[:len(s)-2]; ordinal != "" {
+		n, err := strconv.Atoi(ordinal)
+		if err != nil || n == 0 || n < -53 || n > 53 {
+			return WeekdayNum{}, fmt.Errorf("invalid BYDAY value %q", s)
+		}
+		wn.N = n
+	}
+	return wn, nil
+}
+
+// String returns the rule in its canonical RRULE form.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wn := range r.ByDay {
+			days[i] = wn.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, n := range r.ByMonthDay {
+			days[i] = strconv.Itoa(n)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilLayouts[0]))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+dayCode(r.WeekStart))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// String returns the BYDAY form of a WeekdayNum.
+func (wn WeekdayNum) String() string {
+	if wn.N == 0 {
+		return dayCode(wn.Weekday)
+	}
+	return strconv.Itoa(wn.N) + dayCode(wn.Weekday)
+}
+
+// dayCode returns the two letter code for a weekday.
+func dayCode(wd time.Weekday) string {
+	for code, day := range weekdays {
+		if day == wd {
+			return code
+		}
+	}
+	return ""
+}
+
+// Bounded reports whether the rule ends, either
+// through COUNT or UNTIL.
+func (r *Rule) Bounded() bool {
+	return r.Count > 0 || !r.Until.IsZero()
+}
+
+// Between returns the start times of the occurrences
+// beginning at or after from and before to. The first
+// occurrence is never earlier than dtstart, and the
+// wall clock time of every occurrence is taken from
+// dtstart in dtstart's location. Occurrences listed in
+// exdates are skipped, but still count towards COUNT.
+func (r *Rule) Between(dtstart, from, to time.Time, exdates []time.Time) []time.Time {
+	var occurrences []time.Time
+
+	r.iterate(dtstart, from, func(t time.Time) bool {
+		if !t.Before(to) {
+			return false
+		}
+		if !t.Before(from) && !excluded(t, exdates) {
+			occurrences = append(occurrences, t)
+		}
+		return true
+	})
+
+	return occurrences
+}
+
+// Last returns the start time of the final occurrence.
+// The boolean is false when the rule repeats forever
+// or never produces an occurrence.
+func (r *Rule) Last(dtstart time.Time) (time.Time, bool) {
+	if !r.Bounded() {
+		return time.Time{}, false
+	}
+
+	var last time.Time
+	r.iterate(dtstart, time.Time{}, func(t time.Time) bool {
+		last = t
+		return true
+	})
+
+	return last, !last.IsZero()
+}
+
+// First returns the start time of the first
+// occurrence. The boolean is false when the rule
+// never produces an occurrence, or none is found
+// within maxGapYears of dtstart.
+func (r *Rule) First(dtstart time.Time) (time.Time, bool) {
+	var first time.Time
+	found := false
+	r.iterate(dtstart, time.Time{}, func(t time.Time) bool {
+		first = t
+		found = true
+		return false
+	})
+
+	return first, found
+}
+
+// excluded reports whether t is listed in exdates.
+func excluded(t time.Time, exdates []time.Time) bool {
+	for _, ex := range exdates {
+		if t.Equal(ex) {
+			return true
+		}
+	}
+	return false
+}
+
+// iterate walks the occurrences of the rule in order,
+// calling yield for each one until yield returns false
+// or the rule ends. When the rule has no COUNT, whole
+// periods before skipTo are jumped over, since they
+// cannot affect the result. The walk stops once
+// maxGapYears worth of periods pass without an
+// occurrence.
+func (r *Rule) iterate(dtstart, skipTo time.Time, yield func(time.Time) bool) {
+	first := 0
+	if r.Count == 0 && skipTo.After(dtstart) {
+		first = r.periodsBetween(dtstart, skipTo) - 1
+		if first < 0 {
+			first = 0
+		}
+	}
+
+	// With a large interval each period spans years, so
+	// at least 8 periods are allowed, which covers the
+	// gap between February 29s across a century.
+	maxGap := maxGapYears * periodsPerYear[r.Freq] / r.Interval
+	if maxGap < 8 {
+		maxGap = 8
+	}
+
+	count := 0
+	lastMatch := first
+	for i := first; i < first+maxPeriods; i++ {
+		if i-lastMatch > maxGap {
+			return
+		}
+		for _, t := range r.period(dtstart, i) {
+			if t.Before(dtstart) {
+				continue
+			}
+			lastMatch = i
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return
+			}
+			if !yield(t) {
+				return
+			}
+			count++
+			if r.Count > 0 && count >= r.Count {
+				return
+			}
+		}
+	}
+}
+
+// periodsBetween returns the number of whole rule
+// periods between dtstart and t.
+func (r *Rule) periodsBetween(dtstart, t time.Time) int {
+	var n int
+	switch r.Freq {
+	case Daily:
+		n = int(t.Sub(dtstart).Hours() / 24)
+	case Weekly:
+		n = int(t.Sub(dtstart).Hours() / (24 * 7))
+	case Monthly:
+		n = (t.Year()-dtstart.Year())*12 + int(t.Month()) - int(dtstart.Month())
+	case Yearly:
+		n = t.Year() - dtstart.Year()
+	}
+	return n / r.Interval
+}
+
+// period returns the sorted candidate occurrences in
+// the i-th period (day, week, month or year) after
+// dtstart, before the COUNT and UNTIL limits apply.
+func (r *Rule) period(dtstart time.Time, i int) []time.Time {
+	y, m, d := dtstart.Date()
+	step := i * r.Interval
+
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		day := date(y, m, d+step, dtstart)
+		if r.matchesWeekday(day) && r.matchesMonthDay(day) {
+			days = append(days, day)
+		}
+
+	case Weekly:
+		offset := (int(dtstart.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := date(y, m, d-offset+step*7, dtstart)
+		for j := 0; j < 7; j++ {
+			day := weekStart.AddDate(0, 0, j)
+			day = date(day.Year(), day.Month(), day.Day(), dtstart)
+			if len(r.ByDay) == 0 && day.Weekday() != dtstart.Weekday() {
+				continue
+			}
+			if r.matchesWeekday(day) {
+				days = append(days, day)
+			}
+		}
+
+	case Monthly:
+		first := date(y, m+time.Month(step), 1, dtstart)
+		days = r.monthDays(first.Year(), first.Month(), dtstart)
+
+	case Yearly:
+		year := y + step
+		switch {
+		case len(r.ByDay) == 0 && len(r.ByMonthDay) == 0:
+			if d <= daysIn(year, m) {
+				days = append(days, date(year, m, d, dtstart))
+			}
+		case len(r.ByDay) > 0 && len(r.ByMonthDay) == 0:
+			days = r.yearWeekdays(year, dtstart)
+		default:
+			for month := time.January; month <= time.December; month++ {
+				days = append(days, r.monthDays(year, month, dtstart)...)
+			}
+		}
+	}
+
+	sort.Slice(days, func(a, b int) bool { return days[a].Before(days[b]) })
+	return days
+}
+
+// monthDays returns the candidate days in a month,
+// expanding BYMONTHDAY and BYDAY. When both are given,
+// BYDAY limits the BYMONTHDAY set. When neither is
+// given, the day of the month of dtstart is used.
+func (r *Rule) monthDays(year int, month time.Month, dtstart time.Time) []time.Time {
+	n := daysIn(year, month)
+
+	var days []time.Time
+	for day := 1; day <= n; day++ {
+		t := date(year, month, day, dtstart)
+
+		switch {
+		case len(r.ByMonthDay) > 0:
+			if !r.matchesMonthDay(t) {
+				continue
+			}
+			if len(r.ByDay) > 0 && !r.matchesOrdinal(t, day, n) {
+				continue
+			}
+		case len(r.ByDay) > 0:
+			if !r.matchesOrdinal(t, day, n) {
+				continue
+			}
+		default:
+			if day != dtstart.Day() {
+				continue
+			}
+		}
+		days = append(days, t)
+	}
+	return days
+}
+
+// yearWeekdays returns the days of a year which match
+// BYDAY, with ordinals counted within the year.
+func (r *Rule) yearWeekdays(year int, dtstart time.Time) []time.Time {
+	n := time.Date(year, time.December, 31, 0, 0, 0, 0, time.UTC).YearDay()
+
+	var days []time.Time
+	for yd := 1; yd <= n; yd++ {
+		t := date(year, time.January, yd, dtstart)
+		if r.matchesOrdinal(t, yd, n) {
+			days = append(days, t)
+		}
+	}
+	return days
+}
+
+// matchesWeekday reports whether t falls on one of the
+// BYDAY weekdays, ignoring ordinals. An empty BYDAY
+// matches every day.
+func (r *Rule) matchesWeekday(t time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	for _, wn := range r.ByDay {
+		if wn.Weekday == t.Weekday() {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesOrdinal reports whether t matches a BYDAY
+// entry, where pos is the 1-based position of t within
+// a span of n days (a month or a year).
+func (r *Rule) matchesOrdinal(t time.Time, pos, n int) bool {
+	for _, wn := range r.ByDay {
+		if wn.Weekday != t.Weekday() {
+			continue
+		}
+		switch {
+		case wn.N == 0:
+			return true
+		case wn.N > 0 && (pos-1)/7+1 == wn.N:
+			return true
+		case wn.N < 0 && (n-pos)/7+1 == -wn.N:
+			return true
+		}
+	}
+	return false
+}
+
+// matchesMonthDay reports whether t falls on one of
+// the BYMONTHDAY days. Negative values count back from
+// the end of the month. An empty BYMONTHDAY matches
+// every day.
+func (r *Rule) matchesMonthDay(t time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	n := daysIn(t.Year(), t.Month())
+	for _, md := range r.ByMonthDay {
+		if md == t.Day() || (md < 0 && n+md+1 == t.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+// date builds a time on the given (normalized) date
+// using the wall clock time and location of ref.
+func date(year int, month time.Month, day int, ref time.Time) time.Time {
+	return time.Date(
+		year, month, day,
+		ref.Hour(), ref.Minute(), ref.Second(), ref.Nanosecond(),
+		ref.Location(),
+	)
+}
+
+// daysIn returns the number of days in a month.
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
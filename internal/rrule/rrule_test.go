@@ -0,0 +1,284 @@
+package rrule
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mustParse parses a rule, failing the test if it is
+// not valid.
+func mustParse(t *testing.T, s string) *Rule {
+	t.Helper()
+
+	r, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) returned error: %v", s, err)
+	}
+	return r
+}
+
+// utc returns a time on a date at 09:00 UTC.
+func utc(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 9, 0, 0, 0, time.UTC)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"daily", "FREQ=DAILY", "FREQ=DAILY"},
+		{"prefix and case", "RRULE:freq=weekly;byday=mo,we", "FREQ=WEEKLY;BYDAY=MO,WE"},
+		{"interval and count", "FREQ=WEEKLY;INTERVAL=2;COUNT=10", "FREQ=WEEKLY;INTERVAL=2;COUNT=10"},
+		{"default interval dropped", "FREQ=DAILY;INTERVAL=1", "FREQ=DAILY"},
+		{"ordinals", "FREQ=MONTHLY;BYDAY=1MO,-1FR", "FREQ=MONTHLY;BYDAY=1MO,-1FR"},
+		{"month days", "FREQ=MONTHLY;BYMONTHDAY=1,-1", "FREQ=MONTHLY;BYMONTHDAY=1,-1"},
+		{"until date", "FREQ=DAILY;UNTIL=20261231", "FREQ=DAILY;UNTIL=20261231T000000Z"},
+		{"week start", "FREQ=WEEKLY;WKST=SU", "FREQ=WEEKLY;WKST=SU"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mustParse(t, tt.input).String()
+			if got != tt.want {
+				t.Errorf("got %q; want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"no freq", "COUNT=3"},
+		{"unsupported freq", "FREQ=HOURLY"},
+		{"malformed part", "FREQ=DAILY;COUNT"},
+		{"zero interval", "FREQ=DAILY;INTERVAL=0"},
+		{"negative count", "FREQ=DAILY;COUNT=-1"},
+		{"bad until", "FREQ=DAILY;UNTIL=tomorrow"},
+		{"count and until", "FREQ=DAILY;COUNT=2;UNTIL=20261231"},
+		{"bad day", "FREQ=WEEKLY;BYDAY=XX"},
+		{"ordinal with weekly", "FREQ=WEEKLY;BYDAY=1MO"},
+		{"month day out of range", "FREQ=MONTHLY;BYMONTHDAY=32"},
+		{"month day with weekly", "FREQ=WEEKLY;BYMONTHDAY=1"},
+		{"unsupported part", "FREQ=DAILY;BYHOUR=9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			if err == nil {
+				t.Errorf("Parse(%q) returned no error", tt.input)
+			}
+		})
+	}
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		dtstart time.Time
+		from    time.Time
+		to      time.Time
+		exdates []time.Time
+		want    []time.Time
+	}{
+		{
+			name:    "daily count",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: utc(2026, time.March, 1),
+			from:    utc(2026, time.January, 1),
+			to:      utc(2027, time.January, 1),
+			want:    []time.Time{utc(2026, time.March, 1), utc(2026, time.March, 2), utc(2026, time.March, 3)},
+		},
+		{
+			name:    "window inside endless rule",
+			rule:    "FREQ=DAILY;INTERVAL=2",
+			dtstart: utc(2026, time.March, 1),
+			from:    utc(2026, time.March, 10),
+			to:      utc(2026, time.March, 15),
+			want:    []time.Time{utc(2026, time.March, 11), utc(2026, time.March, 13)},
+		},
+		{
+			name:    "weekly by day",
+			rule:    "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+			dtstart: utc(2026, time.March, 2),
+			from:    utc(2026, time.January, 1),
+			to:      utc(2027, time.January, 1),
+			want: []time.Time{
+				utc(2026, time.March, 2), utc(2026, time.March, 4),
+				utc(2026, time.March, 9), utc(2026, time.March, 11),
+			},
+		},
+		{
+			name:    "monthly last friday",
+			rule:    "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: utc(2026, time.January, 1),
+			from:    utc(2026, time.January, 1),
+			to:      utc(2027, time.January, 1),
+			want:    []time.Time{utc(2026, time.January, 30), utc(2026, time.February, 27), utc(2026, time.March, 27)},
+		},
+		{
+			name:    "monthly skips short months",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3",
+			dtstart: utc(2026, time.January, 31),
+			from:    utc(2026, time.January, 1),
+			to:      utc(2027, time.January, 1),
+			want:    []time.Time{utc(2026, time.January, 31), utc(2026, time.March, 31), utc(2026, time.May, 31)},
+		},
+		{
+			name:    "yearly leap day",
+			rule:    "FREQ=YEARLY;COUNT=2",
+			dtstart: utc(2024, time.February, 29),
+			from:    utc(2024, time.January, 1),
+			to:      utc(2040, time.January, 1),
+			want:    []time.Time{utc(2024, time.February, 29), utc(2028, time.February, 29)},
+		},
+		{
+			name:    "until is inclusive",
+			rule:    "FREQ=DAILY;UNTIL=20260303T090000Z",
+			dtstart: utc(2026, time.March, 1),
+			from:    utc(2026, time.January, 1),
+			to:      utc(2027, time.January, 1),
+			want:    []time.Time{utc(2026, time.March, 1), utc(2026, time.March, 2), utc(2026, time.March, 3)},
+		},
+		{
+			name:    "exdates count towards count",
+			rule:    "FREQ=DAILY;COUNT=3",
+			dtstart: utc(2026, time.March, 1),
+			from:    utc(2026, time.January, 1),
+			to:      utc(2027, time.January, 1),
+			exdates: []time.Time{utc(2026, time.March, 2)},
+			want:    []time.Time{utc(2026, time.March, 1), utc(2026, time.March, 3)},
+		},
+		{
+			name:    "never matches",
+			rule:    "FREQ=YEARLY;BYMONTHDAY=31;BYDAY=1MO",
+			dtstart: utc(2026, time.January, 1),
+			from:    utc(2026, time.January, 1),
+			to:      utc(9999, time.January, 1),
+			want:    nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mustParse(t, tt.rule).Between(tt.dtstart, tt.from, tt.to, tt.exdates)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBetweenKeepsWallClock(t *testing.T) {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	// The occurrences either side of the change to
+	// daylight saving time are both at 09:00 local.
+	dtstart := time.Date(2026, time.March, 7, 9, 0, 0, 0, loc)
+	got := mustParse(t, "FREQ=DAILY;COUNT=2").Between(dtstart, dtstart, dtstart.AddDate(0, 0, 7), nil)
+
+	if len(got) != 2 {
+		t.Fatalf("got %d occurrences; want 2", len(got))
+	}
+	for _, occurrence := range got {
+		if occurrence.Hour() != 9 {
+			t.Errorf("got %v; want 09:00 local", occurrence)
+		}
+	}
+	if d := got[1].Sub(got[0]); d != 23*time.Hour {
+		t.Errorf("got %v between occurrences; want 23h", d)
+	}
+}
+
+func TestFirstAndLast(t *testing.T) {
+	tests := []struct {
+		name      string
+		rule      string
+		dtstart   time.Time
+		wantFirst time.Time
+		wantLast  time.Time
+		firstOK   bool
+		lastOK    bool
+	}{
+		{
+			name:      "bounded",
+			rule:      "FREQ=WEEKLY;COUNT=3",
+			dtstart:   utc(2026, time.March, 2),
+			wantFirst: utc(2026, time.March, 2),
+			wantLast:  utc(2026, time.March, 16),
+			firstOK:   true,
+			lastOK:    true,
+		},
+		{
+			name:      "first after dtstart",
+			rule:      "FREQ=MONTHLY;BYMONTHDAY=13;BYDAY=FR;COUNT=1",
+			dtstart:   utc(2026, time.January, 1),
+			wantFirst: utc(2026, time.February, 13),
+			wantLast:  utc(2026, time.February, 13),
+			firstOK:   true,
+			lastOK:    true,
+		},
+		{
+			name:      "endless",
+			rule:      "FREQ=DAILY",
+			dtstart:   utc(2026, time.March, 1),
+			wantFirst: utc(2026, time.March, 1),
+			firstOK:   true,
+		},
+		{
+			name:    "until before dtstart",
+			rule:    "FREQ=DAILY;UNTIL=20260101",
+			dtstart: utc(2026, time.March, 1),
+		},
+		{
+			name:    "never matches",
+			rule:    "FREQ=YEARLY;BYMONTHDAY=31;BYDAY=1MO;COUNT=1",
+			dtstart: utc(2026, time.January, 1),
+		},
+		{
+			name:    "never matches monthly",
+			rule:    "FREQ=MONTHLY;BYMONTHDAY=30;BYDAY=1MO",
+			dtstart: utc(2026, time.January, 1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := mustParse(t, tt.rule)
+
+			first, ok := r.First(tt.dtstart)
+			if ok != tt.firstOK || !first.Equal(tt.wantFirst) {
+				t.Errorf("First() = %v, %t; want %v, %t", first, ok, tt.wantFirst, tt.firstOK)
+			}
+
+			last, ok := r.Last(tt.dtstart)
+			if ok != tt.lastOK || !last.Equal(tt.wantLast) {
+				t.Errorf("Last() = %v, %t; want %v, %t", last, ok, tt.wantLast, tt.lastOK)
+			}
+		})
+	}
+}
+
+func TestNeverMatchingRuleIsBounded(t *testing.T) {
+	r := mustParse(t, "FREQ=YEARLY;BYMONTHDAY=31;BYDAY=1MO;COUNT=1")
+	dtstart := utc(2026, time.January, 1)
+
+	start := time.Now()
+	for i := 0; i < 10; i++ {
+		r.Last(dtstart)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("10 calls to Last() took %v; want well under 1s", elapsed)
+	}
+}
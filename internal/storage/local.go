@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Local stores blobs as files in a directory on the
+// local filesystem. Each blob is named by its checksum,
+// in a subdirectory named by the first two characters
+// of the checksum, so no one directory grows too large.
+type Local struct {
+	dir string
+}
+
+// NewLocal returns a Local storing blobs in dir, which
+// is created if it doesn't exist.
+func NewLocal(dir string) (*Local, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, err
+	}
+	return &Local{dir: dir}, nil
+}
+
+// Put stores the content read from r. It is written to
+// a temporary file while its checksum is computed, and
+// then renamed to the checksum, so a blob is never
+// seen partly written. Storing content which is
+// already stored replaces the file with an identical
+// one.
+func (l *Local) Put(r io.Reader) (Blob, error) {
+	tmp, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return Blob{}, err
+	}
+	// Removing the temporary file fails once it has been
+	// renamed, so the error is ignored.
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), r)
+	if err != nil {
+		tmp.Close()
+		return Blob{}, err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return Blob{}, err
+	}
+
+	blob := Blob{Checksum: hex.EncodeToString(hash.Sum(nil)), Size: size}
+	path := l.path(blob.Checksum)
+	err = os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		return Blob{}, err
+	}
+	err = os.Rename(tmp.Name(), path)
+	if err != nil {
+		return Blob{}, err
+	}
+
+	return blob, nil
+}
+
+// Open returns the file of the blob with the checksum.
+func (l *Local) Open(checksum string) (io.ReadSeekCloser, error) {
+	if !ValidChecksum(checksum) {
+		return nil, ErrInvalidChecksum
+	}
+
+	file, err := os.Open(l.path(checksum))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return file, nil
+}
+
+// Delete removes the file of the blob with the
+// checksum.
+func (l *Local) Delete(checksum string) error {
+	if !ValidChecksum(checksum) {
+		return ErrInvalidChecksum
+	}
+
+	err := os.Remove(l.path(checksum))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// path returns the path of the file of a blob. The
+// checksum must be valid.
+func (l *Local) path(checksum string) string {
+	return filepath.Join(l.dir, checksum[:2], checksum)
+}
@@ -0,0 +1,63 @@
+// Package storage stores the contents of uploaded
+// files as blobs addressed by the SHA-256 checksum of
+// their content, so the same content is only stored
+// once. Storage is an interface, so blobs can be kept
+// somewhere other than the local filesystem.
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// Define the errors returned by a Storage:
+//  1. ErrNotFound: no blob is stored with the checksum
+//  2. ErrInvalidChecksum: the checksum is not a
+//     lowercase hex SHA-256 checksum
+var (
+	ErrNotFound        = errors.New("blob not found")
+	ErrInvalidChecksum = errors.New("invalid checksum")
+)
+
+// Storage is implemented by the places blobs can be
+// stored. Implementations must be safe for concurrent
+// use.
+type Storage interface {
+	// Put stores the content read from r until EOF, and
+	// returns the blob it is stored as. If reading r
+	// fails, nothing is stored and the error is returned.
+	Put(r io.Reader) (Blob, error)
+
+	// Open returns the content of the blob with the
+	// checksum, or ErrNotFound.
+	Open(checksum string) (io.ReadSeekCloser, error)
+
+	// Delete removes the blob with the checksum.
+	// Removing a blob which is not stored is not an
+	// error.
+	Delete(checksum string) error
+}
+
+// Blob struct describes stored content.
+// Fields:
+// 1.		Checksum: Lowercase hex SHA-256 checksum of the content
+// 2.		Size: Size of the content in bytes
+type Blob struct {
+	Checksum string
+	Size     int64
+}
+
+// ValidChecksum reports whether s is a lowercase hex
+// SHA-256 checksum, which is safe to use in a file
+// name.
+func ValidChecksum(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -6,10 +6,11 @@ import (
 	"golang.org/x/exp/slices"
 )
 
-// Define a regular expression for checking email
-// addresses.
+// Define regular expressions for checking email
+// addresses and "#rrggbb" hex colors.
 var (
 	EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zAZ0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+	ColorRX = regexp.MustCompile("^#[0-9a-fA-F]{6}$")
 )
 
 // Validator defines a struct that contains a map
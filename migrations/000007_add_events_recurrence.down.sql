@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS event_recurrence_end_idx;
+ALTER TABLE events DROP COLUMN recurrence_end;
+ALTER TABLE events DROP COLUMN exdates;
+ALTER TABLE events DROP COLUMN rrule;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE events ADD COLUMN rrule TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN exdates TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN recurrence_end DATETIME;
+CREATE INDEX IF NOT EXISTS event_recurrence_end_idx
+ON events (recurrence_end);
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS event_uid_idx;
+ALTER TABLE events DROP COLUMN uid;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE events ADD COLUMN uid TEXT;
+UPDATE events SET uid = 'event-' || id || '@greenlight' WHERE uid IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS event_uid_idx
+ON events (uid);
\ No newline at end of file
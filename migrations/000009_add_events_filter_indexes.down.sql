@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS event_updated_at_idx;
+DROP INDEX IF EXISTS event_created_at_idx;
+DROP INDEX IF EXISTS event_all_day_idx;
+DROP INDEX IF EXISTS event_span_end_idx;
+DROP INDEX IF EXISTS event_start_idx;
+UPDATE events SET span_end = NULL WHERE rrule = '';
+ALTER TABLE events RENAME COLUMN span_end TO recurrence_end;
+CREATE INDEX IF NOT EXISTS event_recurrence_end_idx
+ON events (recurrence_end);
@@ -0,0 +1,22 @@
+ALTER TABLE events RENAME COLUMN recurrence_end TO span_end;
+DROP INDEX IF EXISTS event_recurrence_end_idx;
+UPDATE events SET span_end = CASE
+    WHEN all_day THEN datetime(date(MAX(start, end)), '+1 day') || '+00:00'
+    ELSE MAX(start, end)
+END
+WHERE rrule = '';
+UPDATE events SET span_end = datetime(date(span_end), '+1 day') || '+00:00'
+WHERE rrule <> '' AND all_day AND span_end IS NOT NULL;
+UPDATE events SET
+    created_at = strftime('%Y-%m-%d %H:%M:%f', created_at) || '+00:00',
+    updated_at = strftime('%Y-%m-%d %H:%M:%f', updated_at) || '+00:00';
+CREATE INDEX IF NOT EXISTS event_start_idx
+ON events (start);
+CREATE INDEX IF NOT EXISTS event_span_end_idx
+ON events (span_end);
+CREATE INDEX IF NOT EXISTS event_all_day_idx
+ON events (all_day);
+CREATE INDEX IF NOT EXISTS event_created_at_idx
+ON events (created_at);
+CREATE INDEX IF NOT EXISTS event_updated_at_idx
+ON events (updated_at);
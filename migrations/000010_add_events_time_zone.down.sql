@@ -0,0 +1 @@
+ALTER TABLE events DROP COLUMN time_zone;
\ No newline at end of file
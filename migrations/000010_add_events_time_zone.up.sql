@@ -0,0 +1 @@
+ALTER TABLE events ADD COLUMN time_zone TEXT NOT NULL DEFAULT 'UTC';
\ No newline at end of file
@@ -0,0 +1,8 @@
+DELETE FROM users_permissions
+WHERE permission_id IN (SELECT id FROM permissions WHERE code = 'events:admin');
+DELETE FROM permissions WHERE code = 'events:admin';
+DROP INDEX IF EXISTS event_user_uid_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS event_uid_idx
+ON events (uid);
+DROP INDEX IF EXISTS event_user_id_idx;
+ALTER TABLE events DROP COLUMN user_id;
@@ -0,0 +1,9 @@
+ALTER TABLE events ADD COLUMN user_id INTEGER REFERENCES users(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS event_user_id_idx
+ON events (user_id);
+DROP INDEX IF EXISTS event_uid_idx;
+CREATE UNIQUE INDEX IF NOT EXISTS event_user_uid_idx
+ON events (user_id, uid);
+INSERT INTO permissions(code)
+VALUES
+('events:admin');
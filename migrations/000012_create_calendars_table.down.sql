@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS event_calendar_id_idx;
+ALTER TABLE events DROP COLUMN calendar_id;
+DROP TABLE IF EXISTS calendars;
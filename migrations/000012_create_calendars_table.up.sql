@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS calendars (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  color TEXT NOT NULL DEFAULT '',
+  time_zone TEXT NOT NULL DEFAULT 'UTC',
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  version INTEGER NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS calendar_user_id_idx
+ON calendars (user_id);
+ALTER TABLE events ADD COLUMN calendar_id INTEGER REFERENCES calendars(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS event_calendar_id_idx
+ON events (calendar_id);
+INSERT INTO calendars (user_id, name, created_at, updated_at)
+SELECT DISTINCT user_id, 'Calendar',
+  strftime('%Y-%m-%d %H:%M:%f', 'now') || '+00:00',
+  strftime('%Y-%m-%d %H:%M:%f', 'now') || '+00:00'
+FROM events
+WHERE user_id IS NOT NULL;
+UPDATE events SET calendar_id = (
+  SELECT id FROM calendars WHERE calendars.user_id = events.user_id
+)
+WHERE user_id IS NOT NULL;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS calendar_shares (
+  id INTEGER PRIMARY KEY,
+  calendar_id INTEGER NOT NULL REFERENCES calendars(id) ON DELETE CASCADE,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  role TEXT NOT NULL,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  UNIQUE (calendar_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS calendar_share_user_id_idx
+ON calendar_shares (user_id);
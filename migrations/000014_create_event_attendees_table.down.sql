@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS tokens_attendee_delete;
+DROP TRIGGER IF EXISTS event_attendees_event_delete;
+DELETE FROM tokens WHERE attendee_id IS NOT NULL;
+DROP INDEX IF EXISTS token_attendee_id_idx;
+ALTER TABLE tokens DROP COLUMN attendee_id;
+DROP TABLE IF EXISTS event_attendees;
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS event_attendees (
+  id INTEGER PRIMARY KEY,
+  event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  name TEXT NOT NULL DEFAULT '',
+  email TEXT NOT NULL,
+  status TEXT NOT NULL DEFAULT 'needs-action',
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  version INTEGER NOT NULL DEFAULT 1,
+  UNIQUE (event_id, email)
+);
+CREATE INDEX IF NOT EXISTS event_attendee_user_id_idx
+ON event_attendees (user_id);
+
+-- RSVP tokens belong to an attendee, who may not be a
+-- registered user.
+ALTER TABLE tokens ADD COLUMN attendee_id INTEGER
+REFERENCES event_attendees(id) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS token_attendee_id_idx
+ON tokens (attendee_id);
+
+-- Foreign keys are not enforced, so remove the
+-- attendees of deleted events, and the tokens of
+-- removed attendees, with triggers.
+CREATE TRIGGER IF NOT EXISTS event_attendees_event_delete
+AFTER DELETE ON events
+BEGIN
+  DELETE FROM event_attendees WHERE event_id = OLD.id;
+END;
+CREATE TRIGGER IF NOT EXISTS tokens_attendee_delete
+AFTER DELETE ON event_attendees
+BEGIN
+  DELETE FROM tokens WHERE attendee_id = OLD.id;
+END;
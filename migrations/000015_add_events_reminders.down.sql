@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS reminder_deliveries_event_delete;
+DROP TABLE IF EXISTS reminder_deliveries;
+DROP INDEX IF EXISTS event_reminders_idx;
+ALTER TABLE events DROP COLUMN reminders;
@@ -0,0 +1,22 @@
+ALTER TABLE events ADD COLUMN reminders TEXT NOT NULL DEFAULT '';
+CREATE INDEX IF NOT EXISTS event_reminders_idx
+ON events (start) WHERE reminders <> '';
+
+-- Each reminder sent is recorded, so it is never sent
+-- twice. The occurrence start identifies the occurrence
+-- of a recurring event.
+CREATE TABLE IF NOT EXISTS reminder_deliveries (
+  event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  occurrence_start DATETIME NOT NULL,
+  minutes INTEGER NOT NULL,
+  sent_at DATETIME NOT NULL,
+  PRIMARY KEY (event_id, occurrence_start, minutes)
+);
+
+-- Foreign keys are not enforced, so remove the
+-- deliveries of deleted events with a trigger.
+CREATE TRIGGER IF NOT EXISTS reminder_deliveries_event_delete
+AFTER DELETE ON events
+BEGIN
+  DELETE FROM reminder_deliveries WHERE event_id = OLD.id;
+END;
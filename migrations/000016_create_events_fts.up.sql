@@ -0,0 +1,37 @@
+-- Full-text index over the event title, description
+-- and tags. It is an external content table, reading
+-- the indexed text from the events table, so the text
+-- is not stored twice. SQLite must be built with FTS5.
+CREATE VIRTUAL TABLE IF NOT EXISTS events_fts USING fts5 (
+  title,
+  description,
+  tags,
+  content = 'events',
+  content_rowid = 'id',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+-- Keep the index in sync with the events table.
+CREATE TRIGGER IF NOT EXISTS events_fts_insert
+AFTER INSERT ON events
+BEGIN
+  INSERT INTO events_fts (rowid, title, description, tags)
+  VALUES (NEW.id, NEW.title, NEW.description, NEW.tags);
+END;
+CREATE TRIGGER IF NOT EXISTS events_fts_delete
+AFTER DELETE ON events
+BEGIN
+  INSERT INTO events_fts (events_fts, rowid, title, description, tags)
+  VALUES ('delete', OLD.id, OLD.title, OLD.description, OLD.tags);
+END;
+CREATE TRIGGER IF NOT EXISTS events_fts_update
+AFTER UPDATE OF title, description, tags ON events
+BEGIN
+  INSERT INTO events_fts (events_fts, rowid, title, description, tags)
+  VALUES ('delete', OLD.id, OLD.title, OLD.description, OLD.tags);
+  INSERT INTO events_fts (rowid, title, description, tags)
+  VALUES (NEW.id, NEW.title, NEW.description, NEW.tags);
+END;
+
+-- Index the existing events.
+INSERT INTO events_fts (events_fts) VALUES ('rebuild');
@@ -0,0 +1,55 @@
+DROP TRIGGER IF EXISTS events_fts_tag_rename;
+DROP TRIGGER IF EXISTS events_fts_tag_delete;
+DROP TRIGGER IF EXISTS events_fts_tag_insert;
+DROP TRIGGER IF EXISTS events_fts_update;
+DROP TRIGGER IF EXISTS events_fts_delete;
+DROP TRIGGER IF EXISTS events_fts_insert;
+DROP TABLE IF EXISTS events_fts;
+
+-- Move the tags back into a comma-delimited column.
+ALTER TABLE events ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+UPDATE events SET tags = COALESCE((
+  SELECT group_concat(t.name, ',' ORDER BY et.position)
+  FROM event_tags et
+  INNER JOIN tags t
+  ON t.id = et.tag_id
+  WHERE et.event_id = events.id
+), '');
+
+DROP TRIGGER IF EXISTS tags_unused_delete;
+DROP TRIGGER IF EXISTS event_tags_event_delete;
+DROP TABLE IF EXISTS event_tags;
+DROP TABLE IF EXISTS tags;
+CREATE INDEX IF NOT EXISTS event_tags_idx
+ON events (tags);
+
+-- Restore the full-text index over the events table.
+CREATE VIRTUAL TABLE IF NOT EXISTS events_fts USING fts5 (
+  title,
+  description,
+  tags,
+  content = 'events',
+  content_rowid = 'id',
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+CREATE TRIGGER IF NOT EXISTS events_fts_insert
+AFTER INSERT ON events
+BEGIN
+  INSERT INTO events_fts (rowid, title, description, tags)
+  VALUES (NEW.id, NEW.title, NEW.description, NEW.tags);
+END;
+CREATE TRIGGER IF NOT EXISTS events_fts_delete
+AFTER DELETE ON events
+BEGIN
+  INSERT INTO events_fts (events_fts, rowid, title, description, tags)
+  VALUES ('delete', OLD.id, OLD.title, OLD.description, OLD.tags);
+END;
+CREATE TRIGGER IF NOT EXISTS events_fts_update
+AFTER UPDATE OF title, description, tags ON events
+BEGIN
+  INSERT INTO events_fts (events_fts, rowid, title, description, tags)
+  VALUES ('delete', OLD.id, OLD.title, OLD.description, OLD.tags);
+  INSERT INTO events_fts (rowid, title, description, tags)
+  VALUES (NEW.id, NEW.title, NEW.description, NEW.tags);
+END;
+INSERT INTO events_fts (events_fts) VALUES ('rebuild');
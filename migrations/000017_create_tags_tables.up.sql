@@ -0,0 +1,153 @@
+-- Tags belong to the owner of the events they are
+-- used on, so each user can rename or merge their own
+-- tags. Events without an owner have tags of user 0.
+CREATE TABLE IF NOT EXISTS tags (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL,
+  name TEXT NOT NULL,
+  UNIQUE (user_id, name)
+);
+
+-- The index on the old tags column has the name of the
+-- new table, so it is dropped first.
+DROP INDEX IF EXISTS event_tags_idx;
+
+CREATE TABLE IF NOT EXISTS event_tags (
+  event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (event_id, tag_id)
+);
+CREATE INDEX IF NOT EXISTS event_tag_tag_id_idx
+ON event_tags (tag_id);
+
+-- Split the comma-delimited tags of each event, keeping
+-- their order, and move them into the new tables.
+CREATE TABLE event_tags_split AS
+WITH RECURSIVE split (event_id, user_id, name, rest, position) AS (
+  SELECT id, COALESCE(user_id, 0), '', tags || ',', -1
+  FROM events
+  WHERE tags <> ''
+  UNION ALL
+  SELECT
+    event_id,
+    user_id,
+    substr(rest, 1, instr(rest, ',') - 1),
+    substr(rest, instr(rest, ',') + 1),
+    position + 1
+  FROM split
+  WHERE rest <> ''
+)
+SELECT event_id, user_id, name, MIN(position) AS position
+FROM split
+WHERE position >= 0 AND name <> ''
+GROUP BY event_id, user_id, name;
+
+INSERT OR IGNORE INTO tags (user_id, name)
+SELECT DISTINCT user_id, name FROM event_tags_split;
+
+INSERT INTO event_tags (event_id, tag_id, position)
+SELECT s.event_id, t.id, s.position
+FROM event_tags_split s
+INNER JOIN tags t
+ON t.user_id = s.user_id AND t.name = s.name;
+
+DROP TABLE event_tags_split;
+
+-- Foreign keys are not enforced, so remove the tags of
+-- deleted events, and tags no longer used on any
+-- event, with triggers.
+CREATE TRIGGER IF NOT EXISTS event_tags_event_delete
+AFTER DELETE ON events
+BEGIN
+  DELETE FROM event_tags WHERE event_id = OLD.id;
+END;
+CREATE TRIGGER IF NOT EXISTS tags_unused_delete
+AFTER DELETE ON event_tags
+WHEN NOT EXISTS (SELECT 1 FROM event_tags WHERE tag_id = OLD.tag_id)
+BEGIN
+  DELETE FROM tags WHERE id = OLD.tag_id;
+END;
+
+-- The full-text index read the tags from the events
+-- table, which no longer has them. Replace it with an
+-- index holding its own copy of the text, which the
+-- triggers keep in sync with the events and tags.
+DROP TRIGGER IF EXISTS events_fts_update;
+DROP TRIGGER IF EXISTS events_fts_delete;
+DROP TRIGGER IF EXISTS events_fts_insert;
+DROP TABLE IF EXISTS events_fts;
+
+ALTER TABLE events DROP COLUMN tags;
+
+CREATE VIRTUAL TABLE IF NOT EXISTS events_fts USING fts5 (
+  title,
+  description,
+  tags,
+  tokenize = 'unicode61 remove_diacritics 2'
+);
+
+INSERT INTO events_fts (rowid, title, description, tags)
+SELECT e.id, e.title, e.description, COALESCE((
+  SELECT group_concat(t.name, ' ' ORDER BY et.position)
+  FROM event_tags et
+  INNER JOIN tags t
+  ON t.id = et.tag_id
+  WHERE et.event_id = e.id
+), '')
+FROM events e;
+
+CREATE TRIGGER IF NOT EXISTS events_fts_insert
+AFTER INSERT ON events
+BEGIN
+  INSERT INTO events_fts (rowid, title, description, tags)
+  VALUES (NEW.id, NEW.title, NEW.description, '');
+END;
+CREATE TRIGGER IF NOT EXISTS events_fts_delete
+AFTER DELETE ON events
+BEGIN
+  DELETE FROM events_fts WHERE rowid = OLD.id;
+END;
+CREATE TRIGGER IF NOT EXISTS events_fts_update
+AFTER UPDATE OF title, description ON events
+BEGIN
+  UPDATE events_fts
+  SET title = NEW.title, description = NEW.description
+  WHERE rowid = NEW.id;
+END;
+CREATE TRIGGER IF NOT EXISTS events_fts_tag_insert
+AFTER INSERT ON event_tags
+BEGIN
+  UPDATE events_fts SET tags = COALESCE((
+    SELECT group_concat(t.name, ' ' ORDER BY et.position)
+    FROM event_tags et
+    INNER JOIN tags t
+    ON t.id = et.tag_id
+    WHERE et.event_id = NEW.event_id
+  ), '')
+  WHERE rowid = NEW.event_id;
+END;
+CREATE TRIGGER IF NOT EXISTS events_fts_tag_delete
+AFTER DELETE ON event_tags
+BEGIN
+  UPDATE events_fts SET tags = COALESCE((
+    SELECT group_concat(t.name, ' ' ORDER BY et.position)
+    FROM event_tags et
+    INNER JOIN tags t
+    ON t.id = et.tag_id
+    WHERE et.event_id = OLD.event_id
+  ), '')
+  WHERE rowid = OLD.event_id;
+END;
+CREATE TRIGGER IF NOT EXISTS events_fts_tag_rename
+AFTER UPDATE OF name ON tags
+BEGIN
+  UPDATE events_fts SET tags = COALESCE((
+    SELECT group_concat(t.name, ' ' ORDER BY et.position)
+    FROM event_tags et
+    INNER JOIN tags t
+    ON t.id = et.tag_id
+    WHERE et.event_id = events_fts.rowid
+  ), '')
+  WHERE rowid IN (SELECT event_id FROM event_tags WHERE tag_id = NEW.id);
+END;
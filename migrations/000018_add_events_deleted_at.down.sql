@@ -0,0 +1,3 @@
+DELETE FROM events WHERE deleted_at IS NOT NULL;
+DROP INDEX IF EXISTS event_deleted_at_idx;
+ALTER TABLE events DROP COLUMN deleted_at;
@@ -0,0 +1,5 @@
+-- Deleted events are moved to the trash by setting
+-- deleted_at, and purged from the trash later.
+ALTER TABLE events ADD COLUMN deleted_at DATETIME;
+CREATE INDEX IF NOT EXISTS event_deleted_at_idx
+ON events (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS event_revisions_event_delete;
+DROP TRIGGER IF EXISTS event_revisions_insert;
+DROP TABLE IF EXISTS event_revisions;
+ALTER TABLE events DROP COLUMN updated_by;
@@ -0,0 +1,62 @@
+-- The user who made the latest version of an event.
+ALTER TABLE events ADD COLUMN updated_by INTEGER REFERENCES users(id);
+
+-- Each prior version of an event is kept, with the
+-- user who made it and when.
+CREATE TABLE IF NOT EXISTS event_revisions (
+  event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  version INTEGER NOT NULL,
+  user_id INTEGER,
+  calendar_id INTEGER,
+  uid TEXT,
+  title TEXT NOT NULL,
+  description TEXT NOT NULL,
+  tags TEXT NOT NULL,
+  all_day INTEGER NOT NULL,
+  start DATETIME,
+  end DATETIME,
+  time_zone TEXT NOT NULL,
+  rrule TEXT NOT NULL,
+  exdates TEXT NOT NULL,
+  reminders TEXT NOT NULL,
+  created_at DATETIME,
+  updated_at DATETIME,
+  updated_by INTEGER,
+  deleted_at DATETIME,
+  PRIMARY KEY (event_id, version)
+);
+
+-- Every statement which changes an event increments
+-- its version, so the old row is copied into the
+-- revisions when the version changes. The tags are
+-- copied before they are changed, since they are
+-- stored after the event is updated.
+CREATE TRIGGER IF NOT EXISTS event_revisions_insert
+AFTER UPDATE OF version ON events
+WHEN NEW.version <> OLD.version
+BEGIN
+  INSERT OR IGNORE INTO event_revisions (
+    event_id, version, user_id, calendar_id, uid, title, description, tags,
+    all_day, start, end, time_zone, rrule, exdates, reminders,
+    created_at, updated_at, updated_by, deleted_at
+  )
+  VALUES (
+    OLD.id, OLD.version, OLD.user_id, OLD.calendar_id, OLD.uid, OLD.title, OLD.description, COALESCE((
+      SELECT group_concat(t.name, ',' ORDER BY et.position)
+      FROM event_tags et
+      INNER JOIN tags t
+      ON t.id = et.tag_id
+      WHERE et.event_id = OLD.id
+    ), ''),
+    OLD.all_day, OLD.start, OLD.end, OLD.time_zone, OLD.rrule, OLD.exdates, OLD.reminders,
+    OLD.created_at, OLD.updated_at, OLD.updated_by, OLD.deleted_at
+  );
+END;
+
+-- Foreign keys are not enforced, so remove the
+-- revisions of deleted events with a trigger.
+CREATE TRIGGER IF NOT EXISTS event_revisions_event_delete
+AFTER DELETE ON events
+BEGIN
+  DELETE FROM event_revisions WHERE event_id = OLD.id;
+END;
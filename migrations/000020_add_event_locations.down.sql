@@ -0,0 +1,33 @@
+DROP TRIGGER IF EXISTS event_revisions_insert;
+CREATE TRIGGER IF NOT EXISTS event_revisions_insert
+AFTER UPDATE OF version ON events
+WHEN NEW.version <> OLD.version
+BEGIN
+  INSERT OR IGNORE INTO event_revisions (
+    event_id, version, user_id, calendar_id, uid, title, description, tags,
+    all_day, start, end, time_zone, rrule, exdates, reminders,
+    created_at, updated_at, updated_by, deleted_at
+  )
+  VALUES (
+    OLD.id, OLD.version, OLD.user_id, OLD.calendar_id, OLD.uid, OLD.title, OLD.description, COALESCE((
+      SELECT group_concat(t.name, ',' ORDER BY et.position)
+      FROM event_tags et
+      INNER JOIN tags t
+      ON t.id = et.tag_id
+      WHERE et.event_id = OLD.id
+    ), ''),
+    OLD.all_day, OLD.start, OLD.end, OLD.time_zone, OLD.rrule, OLD.exdates, OLD.reminders,
+    OLD.created_at, OLD.updated_at, OLD.updated_by, OLD.deleted_at
+  );
+END;
+
+ALTER TABLE event_revisions DROP COLUMN longitude;
+ALTER TABLE event_revisions DROP COLUMN latitude;
+ALTER TABLE event_revisions DROP COLUMN location_address;
+ALTER TABLE event_revisions DROP COLUMN location_name;
+
+DROP INDEX IF EXISTS event_latitude_longitude_idx;
+ALTER TABLE events DROP COLUMN longitude;
+ALTER TABLE events DROP COLUMN latitude;
+ALTER TABLE events DROP COLUMN location_address;
+ALTER TABLE events DROP COLUMN location_name;
@@ -0,0 +1,42 @@
+-- Where an event takes place: a name, an address and
+-- optional coordinates in degrees. Both coordinates
+-- are set, or neither.
+ALTER TABLE events ADD COLUMN location_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN location_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN latitude REAL;
+ALTER TABLE events ADD COLUMN longitude REAL;
+
+-- Radius searches select a bounding box of
+-- coordinates before computing distances.
+CREATE INDEX IF NOT EXISTS event_latitude_longitude_idx ON events (latitude, longitude);
+
+-- Revisions keep the location of each version.
+ALTER TABLE event_revisions ADD COLUMN location_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE event_revisions ADD COLUMN location_address TEXT NOT NULL DEFAULT '';
+ALTER TABLE event_revisions ADD COLUMN latitude REAL;
+ALTER TABLE event_revisions ADD COLUMN longitude REAL;
+
+DROP TRIGGER IF EXISTS event_revisions_insert;
+CREATE TRIGGER IF NOT EXISTS event_revisions_insert
+AFTER UPDATE OF version ON events
+WHEN NEW.version <> OLD.version
+BEGIN
+  INSERT OR IGNORE INTO event_revisions (
+    event_id, version, user_id, calendar_id, uid, title, description, tags,
+    all_day, start, end, time_zone, rrule, exdates, reminders,
+    location_name, location_address, latitude, longitude,
+    created_at, updated_at, updated_by, deleted_at
+  )
+  VALUES (
+    OLD.id, OLD.version, OLD.user_id, OLD.calendar_id, OLD.uid, OLD.title, OLD.description, COALESCE((
+      SELECT group_concat(t.name, ',' ORDER BY et.position)
+      FROM event_tags et
+      INNER JOIN tags t
+      ON t.id = et.tag_id
+      WHERE et.event_id = OLD.id
+    ), ''),
+    OLD.all_day, OLD.start, OLD.end, OLD.time_zone, OLD.rrule, OLD.exdates, OLD.reminders,
+    OLD.location_name, OLD.location_address, OLD.latitude, OLD.longitude,
+    OLD.created_at, OLD.updated_at, OLD.updated_by, OLD.deleted_at
+  );
+END;
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS orphaned_blobs_attachment_insert;
+DROP TRIGGER IF EXISTS orphaned_blobs_attachment_delete;
+DROP TRIGGER IF EXISTS event_attachments_event_delete;
+DROP TABLE IF EXISTS orphaned_blobs;
+DROP TABLE IF EXISTS event_attachments;
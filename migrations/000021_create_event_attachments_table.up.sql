@@ -0,0 +1,46 @@
+-- The contents of attachments are stored outside the
+-- database, in files named by the SHA-256 checksum of
+-- their content, so attachments with the same content
+-- share a file.
+CREATE TABLE IF NOT EXISTS event_attachments (
+  id INTEGER PRIMARY KEY,
+  event_id INTEGER NOT NULL REFERENCES events(id) ON DELETE CASCADE,
+  user_id INTEGER REFERENCES users(id) ON DELETE SET NULL,
+  filename TEXT NOT NULL,
+  content_type TEXT NOT NULL,
+  size INTEGER NOT NULL,
+  checksum TEXT NOT NULL,
+  created_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS event_attachment_event_id_idx
+ON event_attachments (event_id);
+CREATE INDEX IF NOT EXISTS event_attachment_checksum_idx
+ON event_attachments (checksum);
+
+-- Files no longer used by any attachment, waiting to
+-- be removed from storage.
+CREATE TABLE IF NOT EXISTS orphaned_blobs (
+  checksum TEXT PRIMARY KEY
+);
+
+-- Foreign keys are not enforced, so remove the
+-- attachments of deleted events with a trigger. When
+-- the last attachment using a file is removed, the
+-- file is recorded as orphaned, and it stops being
+-- orphaned if the same content is attached again.
+CREATE TRIGGER IF NOT EXISTS event_attachments_event_delete
+AFTER DELETE ON events
+BEGIN
+  DELETE FROM event_attachments WHERE event_id = OLD.id;
+END;
+CREATE TRIGGER IF NOT EXISTS orphaned_blobs_attachment_delete
+AFTER DELETE ON event_attachments
+WHEN NOT EXISTS (SELECT 1 FROM event_attachments WHERE checksum = OLD.checksum)
+BEGIN
+  INSERT OR IGNORE INTO orphaned_blobs (checksum) VALUES (OLD.checksum);
+END;
+CREATE TRIGGER IF NOT EXISTS orphaned_blobs_attachment_insert
+AFTER INSERT ON event_attachments
+BEGIN
+  DELETE FROM orphaned_blobs WHERE checksum = NEW.checksum;
+END;
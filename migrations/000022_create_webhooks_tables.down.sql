@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS webhook_delivery_attempts_delivery_delete;
+DROP TRIGGER IF EXISTS webhook_deliveries_webhook_delete;
+DROP TABLE IF EXISTS webhook_delivery_attempts;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhooks;
@@ -0,0 +1,65 @@
+-- Webhooks POST a JSON payload to a URL when events
+-- the webhook's owner can see are created, updated or
+-- deleted. event_types is a comma-delimited list, and
+-- the secret signs each payload.
+CREATE TABLE IF NOT EXISTS webhooks (
+  id INTEGER PRIMARY KEY,
+  user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+  url TEXT NOT NULL,
+  event_types TEXT NOT NULL,
+  secret TEXT NOT NULL,
+  active INTEGER NOT NULL DEFAULT 1,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL,
+  version INTEGER NOT NULL DEFAULT 1
+);
+CREATE INDEX IF NOT EXISTS webhook_user_id_idx
+ON webhooks (user_id);
+
+-- The delivery queue. Each payload is queued for every
+-- webhook it is sent to, and is pending until it is
+-- delivered, or has failed too many times. Pending
+-- deliveries are sent once next_attempt_at has passed.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+  id INTEGER PRIMARY KEY,
+  webhook_id INTEGER NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+  event_type TEXT NOT NULL,
+  event_id INTEGER NOT NULL,
+  payload TEXT NOT NULL,
+  status TEXT NOT NULL,
+  attempts INTEGER NOT NULL DEFAULT 0,
+  next_attempt_at DATETIME,
+  created_at DATETIME NOT NULL,
+  updated_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_delivery_webhook_id_idx
+ON webhook_deliveries (webhook_id);
+CREATE INDEX IF NOT EXISTS webhook_delivery_next_attempt_at_idx
+ON webhook_deliveries (status, next_attempt_at);
+
+-- The history of each attempt to send a delivery.
+-- status_code is NULL if no response was received.
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+  id INTEGER PRIMARY KEY,
+  delivery_id INTEGER NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+  status_code INTEGER,
+  error TEXT NOT NULL,
+  duration_ms INTEGER NOT NULL,
+  attempted_at DATETIME NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempt_delivery_id_idx
+ON webhook_delivery_attempts (delivery_id);
+
+-- Foreign keys are not enforced, so remove the
+-- deliveries of deleted webhooks, and the attempts of
+-- deleted deliveries, with triggers.
+CREATE TRIGGER IF NOT EXISTS webhook_deliveries_webhook_delete
+AFTER DELETE ON webhooks
+BEGIN
+  DELETE FROM webhook_deliveries WHERE webhook_id = OLD.id;
+END;
+CREATE TRIGGER IF NOT EXISTS webhook_delivery_attempts_delivery_delete
+AFTER DELETE ON webhook_deliveries
+BEGIN
+  DELETE FROM webhook_delivery_attempts WHERE delivery_id = OLD.id;
+END;